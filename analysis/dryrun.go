@@ -0,0 +1,100 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/albertocavalcante/starlark-go-copybara/core"
+	"github.com/albertocavalcante/starlark-go-copybara/diff"
+	"github.com/albertocavalcante/starlark-go-copybara/migrate"
+)
+
+// FileChange describes the effect of the workflow transformations on a file.
+// For deleted files Path is the original path; for added files it is the
+// new path.
+type FileChange = diff.FileDiff
+
+// DryRun simulates a workflow without making changes.
+//
+// It materializes the origin into a scratch directory, runs every
+// transformation and reports the per-file effect of the transformations.
+// The destination is never read or written.
+type DryRun struct {
+	Workflow *core.Workflow
+
+	// Changes lists the changed files as "<op> <path>", e.g.
+	// "MODIFIED src/main.go", sorted by path.
+	Changes []string
+
+	// Files holds the per-file changes with their unified diffs, in the
+	// same order as Changes.
+	Files []FileChange
+
+	Errors []error
+}
+
+// NewDryRun creates a new dry run for the given workflow.
+func NewDryRun(wf *core.Workflow) *DryRun {
+	return &DryRun{
+		Workflow: wf,
+	}
+}
+
+// Execute performs the dry run.
+func (d *DryRun) Execute() error {
+	d.Changes = nil
+	d.Files = nil
+	d.Errors = nil
+
+	if err := d.execute(); err != nil {
+		d.Errors = append(d.Errors, err)
+		return err
+	}
+	return nil
+}
+
+func (d *DryRun) execute() error {
+	origin, err := migrate.ResolveOrigin(d.Workflow.Origin())
+	if err != nil {
+		return err
+	}
+
+	changes, err := origin.Changes("")
+	if err != nil {
+		return fmt.Errorf("failed to read origin changes: %w", err)
+	}
+
+	workDir, err := os.MkdirTemp("", "copybara-dryrun-")
+	if err != nil {
+		return fmt.Errorf("failed to create scratch directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(workDir) }()
+
+	checkoutDir, err := migrate.Checkout(origin, d.Workflow.OriginFiles(), workDir)
+	if err != nil {
+		return err
+	}
+
+	before, err := diff.Snapshot(checkoutDir)
+	if err != nil {
+		return err
+	}
+
+	tctx := migrate.NewContext(d.Workflow, checkoutDir, changes)
+	tctx.DryRun = true
+	if err := migrate.ApplyTransformations(context.Background(), d.Workflow, tctx); err != nil {
+		return err
+	}
+
+	after, err := diff.Snapshot(checkoutDir)
+	if err != nil {
+		return err
+	}
+
+	d.Files = diff.Compare(before, after)
+	for _, f := range d.Files {
+		d.Changes = append(d.Changes, fmt.Sprintf("%s %s", f.Op, f.Path))
+	}
+	return nil
+}
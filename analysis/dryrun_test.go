@@ -0,0 +1,157 @@
+package analysis_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+
+	"github.com/albertocavalcante/starlark-go-copybara/analysis"
+	"github.com/albertocavalcante/starlark-go-copybara/authoring"
+	"github.com/albertocavalcante/starlark-go-copybara/core"
+	"github.com/albertocavalcante/starlark-go-copybara/folder"
+	"github.com/albertocavalcante/starlark-go-copybara/vcs"
+)
+
+// evalWorkflow evaluates a config and returns its first workflow.
+func evalWorkflow(t *testing.T, config string) *core.Workflow {
+	t.Helper()
+
+	thread := &starlark.Thread{Name: "test"}
+	predeclared := starlark.StringDict{
+		"core":      core.Module,
+		"folder":    folder.Module,
+		"authoring": authoring.Module,
+		"glob":      core.Globals()["glob"],
+	}
+	if _, err := starlark.ExecFile(thread, "copy.bara.sky", config, predeclared); err != nil {
+		t.Fatalf("failed to evaluate config: %v", err)
+	}
+
+	workflows := core.RegisteredWorkflows(thread)
+	if len(workflows) == 0 {
+		t.Fatal("no workflow defined")
+	}
+	return workflows[0]
+}
+
+func TestDryRunExecute(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	files := map[string]string{
+		"src/main.go": "package main\n\nfunc main() {}\n",
+		"docs/old.md": "obsolete\n",
+		"README.md":   "# Project\n",
+	}
+	for path, content := range files {
+		fullPath := filepath.Join(src, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wf := evalWorkflow(t, `
+core.workflow(
+    name = "default",
+    origin = folder.origin(path = "`+src+`"),
+    destination = folder.destination(path = "`+dst+`"),
+    transformations = [
+        core.replace("package main", "package lib", paths = ["**/*.go"]),
+        core.move("src/main.go", "lib/main.go"),
+        core.remove(["docs/**"]),
+    ],
+)
+`)
+
+	dr := analysis.NewDryRun(wf)
+	if err := dr.Execute(); err != nil {
+		t.Fatalf("Execute() error: %v", err)
+	}
+	if len(dr.Errors) != 0 {
+		t.Errorf("unexpected errors: %v", dr.Errors)
+	}
+
+	want := []string{
+		"DELETED docs/old.md",
+		"ADDED lib/main.go",
+		"DELETED src/main.go",
+	}
+	if !slices.Equal(dr.Changes, want) {
+		t.Errorf("Changes = %q, want %q", dr.Changes, want)
+	}
+	if len(dr.Files) != len(want) {
+		t.Fatalf("Files = %+v, want %d entries", dr.Files, len(want))
+	}
+	if dr.Files[1].Path != "lib/main.go" || dr.Files[1].Op != vcs.FileAdded {
+		t.Errorf("Files[1] = %s %s, want %s lib/main.go", dr.Files[1].Op, dr.Files[1].Path, vcs.FileAdded)
+	}
+
+	added := dr.Files[1].Diff
+	if !strings.Contains(added, "+++ b/lib/main.go") || !strings.Contains(added, "+package lib\n") {
+		t.Errorf("unexpected diff for added file:\n%s", added)
+	}
+
+	// The origin and destination are left untouched
+	if content, _ := os.ReadFile(filepath.Join(src, "src/main.go")); string(content) != files["src/main.go"] {
+		t.Error("dry run modified the origin")
+	}
+	if entries, _ := os.ReadDir(dst); len(entries) != 0 {
+		t.Error("dry run wrote to the destination")
+	}
+}
+
+func TestDryRunModifiedDiff(t *testing.T) {
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("one\ntwo\nthree\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	wf := evalWorkflow(t, `
+core.workflow(
+    name = "default",
+    origin = folder.origin(path = "`+src+`"),
+    destination = folder.destination(),
+    transformations = [core.replace("two", "TWO")],
+)
+`)
+
+	dr := analysis.NewDryRun(wf)
+	if err := dr.Execute(); err != nil {
+		t.Fatalf("Execute() error: %v", err)
+	}
+	if len(dr.Files) != 1 || dr.Files[0].Op != vcs.FileModified {
+		t.Fatalf("unexpected changes: %+v", dr.Files)
+	}
+
+	want := "--- a/a.txt\n+++ b/a.txt\n@@ -1,3 +1,3 @@\n one\n-two\n+TWO\n three\n"
+	if dr.Files[0].Diff != want {
+		t.Errorf("Diff =\n%s\nwant:\n%s", dr.Files[0].Diff, want)
+	}
+}
+
+func TestDryRunTransformationError(t *testing.T) {
+	src := t.TempDir()
+
+	wf := evalWorkflow(t, `
+core.workflow(
+    name = "default",
+    origin = folder.origin(path = "`+src+`"),
+    destination = folder.destination(),
+    transformations = [core.move("missing", "other")],
+)
+`)
+
+	dr := analysis.NewDryRun(wf)
+	if err := dr.Execute(); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(dr.Errors) != 1 {
+		t.Errorf("expected 1 recorded error, got %v", dr.Errors)
+	}
+}
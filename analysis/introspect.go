@@ -2,49 +2,305 @@
 package analysis
 
 import (
-	"fmt"
+	"go.starlark.net/starlark"
 
+	"github.com/albertocavalcante/starlark-go-copybara/authoring"
 	"github.com/albertocavalcante/starlark-go-copybara/core"
 )
 
 // WorkflowInfo contains information about a workflow.
+//
+// WorkflowInfo is JSON-serializable.
 type WorkflowInfo struct {
-	Name            string
-	OriginType      string
-	DestinationType string
-	Transformations []TransformInfo
+	Name             string          `json:"name"`
+	Mode             string          `json:"mode"`
+	ReversibleCheck  bool            `json:"reversible_check"`
+	NoopBehavior     string          `json:"noop_behavior"`
+	OriginType       string          `json:"origin_type,omitempty"`
+	Origin           map[string]any  `json:"origin,omitempty"`
+	DestinationType  string          `json:"destination_type,omitempty"`
+	Destination      map[string]any  `json:"destination,omitempty"`
+	Authoring        *AuthoringInfo  `json:"authoring,omitempty"`
+	OriginFiles      *GlobInfo       `json:"origin_files,omitempty"`
+	DestinationFiles *GlobInfo       `json:"destination_files,omitempty"`
+	Transformations  []TransformInfo `json:"transformations"`
+}
+
+// AuthoringInfo contains information about the workflow authoring.
+type AuthoringInfo struct {
+	Type          string   `json:"type"`
+	Mode          string   `json:"mode"`
+	DefaultAuthor string   `json:"default_author,omitempty"`
+	Allowlist     []string `json:"allowlist,omitempty"`
+}
+
+// GlobInfo contains the include and exclude patterns of a glob.
+type GlobInfo struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude,omitempty"`
 }
 
 // TransformInfo contains information about a transformation.
 type TransformInfo struct {
-	Type        string
-	Description string
+	Type        string         `json:"type"`
+	Description string         `json:"description"`
+	Params      map[string]any `json:"params,omitempty"`
 }
 
 // IntrospectWorkflow returns information about a workflow.
-// NOTE: This is a stub - full implementation pending.
 func IntrospectWorkflow(wf *core.Workflow) *WorkflowInfo {
-	return &WorkflowInfo{
-		Name: wf.Name(),
+	info := &WorkflowInfo{
+		Name:             wf.Name(),
+		Mode:             wf.Mode().String(),
+		ReversibleCheck:  wf.ReversibleCheck(),
+		NoopBehavior:     wf.NoopBehavior().String(),
+		OriginFiles:      globInfo(wf.OriginFiles()),
+		DestinationFiles: globInfo(wf.DestinationFiles()),
+		Transformations:  make([]TransformInfo, 0, len(wf.Transformations())),
+	}
+
+	if origin := wf.Origin(); isSet(origin) {
+		info.OriginType = origin.Type()
+		info.Origin = attrsToMap(origin)
+	}
+
+	if destination := wf.Destination(); isSet(destination) {
+		info.DestinationType = destination.Type()
+		info.Destination = attrsToMap(destination)
+	}
+
+	if auth, ok := wf.Authoring().(authoring.Authoring); ok {
+		info.Authoring = authoringInfo(auth)
+	}
+
+	for _, t := range wf.Transformations() {
+		info.Transformations = append(info.Transformations, IntrospectTransformation(t))
+	}
+
+	return info
+}
+
+// IntrospectTransformation returns information about a transformation.
+func IntrospectTransformation(t core.Transformation) TransformInfo {
+	return TransformInfo{
+		Type:        t.Type(),
+		Description: t.Describe(),
+		Params:      transformParams(t),
+	}
+}
+
+// introspectAll returns information about each transformation in a list.
+func introspectAll(transformations []core.Transformation) []TransformInfo {
+	infos := make([]TransformInfo, len(transformations))
+	for i, t := range transformations {
+		infos[i] = IntrospectTransformation(t)
+	}
+	return infos
+}
+
+// transformParams returns the parameters of known transformations.
+func transformParams(t core.Transformation) map[string]any {
+	switch v := t.(type) {
+	case *core.Move:
+		return map[string]any{
+			"before":    v.Before(),
+			"after":     v.After(),
+			"paths":     globInfo(v.Paths()),
+			"overwrite": v.Overwrite(),
+		}
+	case *core.Copy:
+		return map[string]any{
+			"before": v.Before(),
+			"after":  v.After(),
+			"paths":  globInfo(v.Paths()),
+		}
+	case *core.Replace:
+		params := map[string]any{
+			"before": v.Before(),
+			"after":  v.After(),
+			"paths":  globInfo(v.Paths()),
+		}
+		if len(v.RegexGroups()) > 0 {
+			params["regex_groups"] = v.RegexGroups()
+		}
+		if v.Multiline() {
+			params["multiline"] = true
+		}
+		if v.FirstOnly() {
+			params["first_only"] = true
+		}
+		if v.RepeatedGroups() {
+			params["repeated_groups"] = true
+		}
+		if len(v.Ignore()) > 0 {
+			params["ignore"] = v.Ignore()
+		}
+		return params
+	case *core.TodoReplace:
+		params := map[string]any{
+			"tags":  v.Tags(),
+			"mode":  v.Mode().String(),
+			"paths": globInfo(v.Paths()),
+		}
+		if len(v.Mapping()) > 0 {
+			params["mapping"] = v.Mapping()
+		}
+		if v.Default() != "" {
+			params["default"] = v.Default()
+		}
+		if v.Ignore() != "" {
+			params["ignore"] = v.Ignore()
+		}
+		return params
+	case *core.FilterReplace:
+		params := map[string]any{
+			"regex":   v.Regex(),
+			"group":   v.Group(),
+			"reverse": v.ReverseRegex(),
+			"paths":   globInfo(v.Paths()),
+		}
+		if m := v.ReplaceMapper(); m != nil {
+			replaces := make([]core.Transformation, len(m.Replaces()))
+			for i, r := range m.Replaces() {
+				replaces[i] = r
+			}
+			params["mapping"] = map[string]any{
+				"mapping": introspectAll(replaces),
+				"all":     m.All(),
+			}
+		} else if len(v.Mapping()) > 0 {
+			params["mapping"] = v.Mapping()
+		}
+		return params
+	case *core.Remove:
+		return map[string]any{
+			"paths": globInfo(v.Paths()),
+		}
+	case *core.VerifyMatch:
+		params := map[string]any{
+			"regex":            v.RegexString(),
+			"paths":            globInfo(v.Paths()),
+			"verify_no_match":  v.VerifyNoMatch(),
+			"also_on_reversal": v.AlsoOnReversal(),
+		}
+		if v.FailureMessage() != "" {
+			params["failure_message"] = v.FailureMessage()
+		}
+		return params
+	case *core.Sequence:
+		params := map[string]any{
+			"ignore_noop":     v.IgnoreNoop(),
+			"noop_behavior":   v.NoopBehavior().String(),
+			"transformations": introspectAll(v.Transformations()),
+		}
+		if v.Name() != "" {
+			params["name"] = v.Name()
+		}
+		if v.Reversal() != nil {
+			params["reversal"] = introspectAll(v.Reversal())
+		}
+		return params
+	}
+
+	if attrs, ok := t.(starlark.HasAttrs); ok {
+		return attrsToMap(attrs)
+	}
+	return nil
+}
+
+// authoringInfo returns information about an authoring configuration.
+func authoringInfo(auth authoring.Authoring) *AuthoringInfo {
+	info := &AuthoringInfo{
+		Type: auth.Type(),
+		Mode: auth.Mode().String(),
 	}
+	if author := auth.DefaultAuthor(); author != nil {
+		info.DefaultAuthor = author.String()
+	}
+	if allowed, ok := auth.(*authoring.Allowed); ok {
+		info.Allowlist = allowed.Allowlist()
+	}
+	return info
 }
 
-// DryRun simulates a workflow without making changes.
-type DryRun struct {
-	Workflow *core.Workflow
-	Changes  []string
-	Errors   []error
+// globInfo converts a glob to its serializable form. A nil glob yields nil.
+func globInfo(g *core.Glob) *GlobInfo {
+	if g == nil {
+		return nil
+	}
+	return &GlobInfo{
+		Include: g.Include(),
+		Exclude: g.ExcludePatterns(),
+	}
 }
 
-// NewDryRun creates a new dry run for the given workflow.
-func NewDryRun(wf *core.Workflow) *DryRun {
-	return &DryRun{
-		Workflow: wf,
+// isSet returns true if v is a non-None value.
+func isSet(v starlark.Value) bool {
+	return v != nil && v != starlark.None
+}
+
+// attrsToMap converts the attributes of a starlark value to a map.
+// Values that do not expose attributes yield nil.
+func attrsToMap(v starlark.Value) map[string]any {
+	attrs, ok := v.(starlark.HasAttrs)
+	if !ok {
+		return nil
+	}
+
+	m := make(map[string]any)
+	for _, name := range attrs.AttrNames() {
+		val, err := attrs.Attr(name)
+		if err != nil || val == nil {
+			continue
+		}
+		if _, isFn := val.(starlark.Callable); isFn {
+			continue
+		}
+		m[name] = toGo(val)
 	}
+	return m
 }
 
-// Execute performs the dry run.
-// NOTE: This is a stub - full implementation pending.
-func (d *DryRun) Execute() error {
-	return fmt.Errorf("dry run not yet implemented")
+// toGo converts a starlark value to a JSON-serializable Go value.
+func toGo(v starlark.Value) any {
+	switch val := v.(type) {
+	case starlark.NoneType:
+		return nil
+	case starlark.Bool:
+		return bool(val)
+	case starlark.String:
+		return string(val)
+	case starlark.Int:
+		if i, ok := val.Int64(); ok {
+			return i
+		}
+		return val.String()
+	case starlark.Float:
+		return float64(val)
+	case *core.Glob:
+		return globInfo(val)
+	case starlark.Indexable:
+		items := make([]any, val.Len())
+		for i := range val.Len() {
+			items[i] = toGo(val.Index(i))
+		}
+		return items
+	case *starlark.Dict:
+		m := make(map[string]any, val.Len())
+		for _, item := range val.Items() {
+			key, ok := starlark.AsString(item[0])
+			if !ok {
+				key = item[0].String()
+			}
+			m[key] = toGo(item[1])
+		}
+		return m
+	case starlark.HasAttrs:
+		if m := attrsToMap(val); len(m) > 0 {
+			return m
+		}
+		return val.String()
+	default:
+		return val.String()
+	}
 }
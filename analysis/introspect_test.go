@@ -0,0 +1,244 @@
+package analysis_test
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/albertocavalcante/starlark-go-copybara/analysis"
+)
+
+func TestIntrospectWorkflow(t *testing.T) {
+	wf := evalWorkflow(t, `
+core.workflow(
+    name = "export",
+    origin = folder.origin(path = "/tmp/src"),
+    destination = folder.destination(path = "/tmp/dst"),
+    authoring = authoring.allowed(
+        default = "Bot <bot@example.com>",
+        allowlist = ["example.com"],
+    ),
+    origin_files = glob(["src/**"], exclude = ["src/internal/**"]),
+    destination_files = glob(["**"]),
+    mode = "CHANGE_REQUEST",
+    transformations = [
+        core.move("src", "lib", overwrite = True),
+        core.replace("foo", "bar", paths = ["**/*.go"]),
+        core.verify_match("Copyright", verify_no_match = True, failure_message = "no copyright"),
+    ],
+)
+`)
+
+	info := analysis.IntrospectWorkflow(wf)
+
+	if info.Name != "export" {
+		t.Errorf("Name = %q", info.Name)
+	}
+	if info.Mode != "CHANGE_REQUEST" || !info.ReversibleCheck {
+		t.Errorf("Mode = %q, ReversibleCheck = %v", info.Mode, info.ReversibleCheck)
+	}
+	if info.OriginType != "folder.origin" || info.Origin["path"] != "/tmp/src" {
+		t.Errorf("unexpected origin: %s %v", info.OriginType, info.Origin)
+	}
+	if info.DestinationType != "folder.destination" || info.Destination["path"] != "/tmp/dst" {
+		t.Errorf("unexpected destination: %s %v", info.DestinationType, info.Destination)
+	}
+
+	if info.Authoring == nil {
+		t.Fatal("expected authoring info")
+	}
+	if info.Authoring.Mode != "ALLOWED" || info.Authoring.DefaultAuthor != "Bot <bot@example.com>" {
+		t.Errorf("unexpected authoring: %+v", info.Authoring)
+	}
+	if !slices.Equal(info.Authoring.Allowlist, []string{"example.com"}) {
+		t.Errorf("Allowlist = %v", info.Authoring.Allowlist)
+	}
+
+	if !slices.Equal(info.OriginFiles.Include, []string{"src/**"}) ||
+		!slices.Equal(info.OriginFiles.Exclude, []string{"src/internal/**"}) {
+		t.Errorf("unexpected origin_files: %+v", info.OriginFiles)
+	}
+
+	if len(info.Transformations) != 3 {
+		t.Fatalf("expected 3 transformations, got %d", len(info.Transformations))
+	}
+
+	move := info.Transformations[0]
+	if move.Type != "move" || move.Description != "Moving src to lib" {
+		t.Errorf("unexpected move info: %+v", move)
+	}
+	if move.Params["before"] != "src" || move.Params["after"] != "lib" || move.Params["overwrite"] != true {
+		t.Errorf("unexpected move params: %v", move.Params)
+	}
+
+	replace := info.Transformations[1]
+	paths, ok := replace.Params["paths"].(*analysis.GlobInfo)
+	if !ok || !slices.Equal(paths.Include, []string{"**/*.go"}) {
+		t.Errorf("unexpected replace paths: %v", replace.Params["paths"])
+	}
+
+	verify := info.Transformations[2]
+	if verify.Params["verify_no_match"] != true || verify.Params["failure_message"] != "no copyright" {
+		t.Errorf("unexpected verify_match params: %v", verify.Params)
+	}
+}
+
+func TestIntrospectWorkflowJSON(t *testing.T) {
+	wf := evalWorkflow(t, `
+core.workflow(
+    name = "default",
+    origin = folder.origin(path = "/src"),
+    destination = folder.destination(path = "/dst"),
+    transformations = [core.remove(["tmp/**"])],
+)
+`)
+
+	data, err := json.Marshal(analysis.IntrospectWorkflow(wf))
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	if decoded["name"] != "default" || decoded["mode"] != "SQUASH" {
+		t.Errorf("unexpected JSON: %s", data)
+	}
+	if decoded["origin_type"] != "folder.origin" {
+		t.Errorf("unexpected origin_type in JSON: %s", data)
+	}
+
+	transforms, ok := decoded["transformations"].([]any)
+	if !ok || len(transforms) != 1 {
+		t.Fatalf("unexpected transformations in JSON: %s", data)
+	}
+	remove := transforms[0].(map[string]any)
+	if remove["type"] != "remove" {
+		t.Errorf("unexpected transformation type: %v", remove["type"])
+	}
+	paths := remove["params"].(map[string]any)["paths"].(map[string]any)
+	if include := paths["include"].([]any); len(include) != 1 || include[0] != "tmp/**" {
+		t.Errorf("unexpected remove paths: %v", paths)
+	}
+}
+
+func TestIntrospectWorkflowMinimal(t *testing.T) {
+	wf := evalWorkflow(t, `core.workflow(name = "empty")`)
+
+	info := analysis.IntrospectWorkflow(wf)
+	if info.OriginType != "" || info.DestinationType != "" || info.Authoring != nil {
+		t.Errorf("expected empty origin/destination/authoring, got %+v", info)
+	}
+	if info.Transformations == nil || len(info.Transformations) != 0 {
+		t.Errorf("expected empty transformations, got %v", info.Transformations)
+	}
+}
+
+func TestIntrospectSequence(t *testing.T) {
+	wf := evalWorkflow(t, `
+core.workflow(
+    name = "grouped",
+    transformations = [
+        core.transform(
+            [core.move("a", "b")],
+            reversal = [core.move("b", "a")],
+            name = "relocate",
+        ),
+    ],
+)
+`)
+
+	info := analysis.IntrospectWorkflow(wf)
+	seq := info.Transformations[0]
+	if seq.Type != "sequence" || seq.Description != "relocate" {
+		t.Fatalf("unexpected sequence info: %+v", seq)
+	}
+
+	steps, ok := seq.Params["transformations"].([]analysis.TransformInfo)
+	if !ok || len(steps) != 1 || steps[0].Params["before"] != "a" {
+		t.Errorf("unexpected transformations: %v", seq.Params["transformations"])
+	}
+	reversal, ok := seq.Params["reversal"].([]analysis.TransformInfo)
+	if !ok || len(reversal) != 1 || reversal[0].Params["before"] != "b" {
+		t.Errorf("unexpected reversal: %v", seq.Params["reversal"])
+	}
+}
+
+func TestIntrospectTodoReplace(t *testing.T) {
+	wf := evalWorkflow(t, `
+core.workflow(
+    name = "todos",
+    transformations = [
+        core.todo_replace(
+            tags = ["TODO", "NOTE"],
+            mapping = {"alice": "bob"},
+            mode = "MAP_OR_DEFAULT",
+            default = "team",
+            ignore = "skip.*",
+            paths = ["**/*.go"],
+        ),
+    ],
+)
+`)
+
+	todo := analysis.IntrospectWorkflow(wf).Transformations[0]
+	if todo.Type != "todo_replace" {
+		t.Fatalf("unexpected todo_replace info: %+v", todo)
+	}
+	if tags, _ := todo.Params["tags"].([]string); !slices.Equal(tags, []string{"TODO", "NOTE"}) {
+		t.Errorf("tags = %v", todo.Params["tags"])
+	}
+	if mapping, _ := todo.Params["mapping"].(map[string]string); mapping["alice"] != "bob" {
+		t.Errorf("mapping = %v", todo.Params["mapping"])
+	}
+	if todo.Params["mode"] != "MAP_OR_DEFAULT" || todo.Params["default"] != "team" || todo.Params["ignore"] != "skip.*" {
+		t.Errorf("unexpected todo_replace params: %v", todo.Params)
+	}
+	if paths, ok := todo.Params["paths"].(*analysis.GlobInfo); !ok || !slices.Equal(paths.Include, []string{"**/*.go"}) {
+		t.Errorf("paths = %v", todo.Params["paths"])
+	}
+}
+
+func TestIntrospectFilterReplace(t *testing.T) {
+	wf := evalWorkflow(t, `
+core.workflow(
+    name = "filters",
+    transformations = [
+        core.filter_replace(
+            regex = "import (\\w+)",
+            mapping = {"foo": "bar"},
+            group = 1,
+            reverse = "import (\\w+) *",
+            paths = ["**/*.go"],
+        ),
+        core.filter_replace(
+            regex = "v[0-9]+",
+            mapping = core.replace_mapper([core.replace("v1", "v2")], all = True),
+        ),
+    ],
+)
+`)
+
+	transformations := analysis.IntrospectWorkflow(wf).Transformations
+	filter := transformations[0]
+	if filter.Type != "filter_replace" {
+		t.Fatalf("unexpected filter_replace info: %+v", filter)
+	}
+	if filter.Params["regex"] != `import (\w+)` || filter.Params["reverse"] != `import (\w+) *` || filter.Params["group"] != 1 {
+		t.Errorf("unexpected filter_replace params: %v", filter.Params)
+	}
+	if mapping, _ := filter.Params["mapping"].(map[string]string); mapping["foo"] != "bar" {
+		t.Errorf("mapping = %v", filter.Params["mapping"])
+	}
+	if paths, ok := filter.Params["paths"].(*analysis.GlobInfo); !ok || !slices.Equal(paths.Include, []string{"**/*.go"}) {
+		t.Errorf("paths = %v", filter.Params["paths"])
+	}
+
+	mapper, _ := transformations[1].Params["mapping"].(map[string]any)
+	replaces, _ := mapper["mapping"].([]analysis.TransformInfo)
+	if mapper["all"] != true || len(replaces) != 1 || replaces[0].Params["before"] != "v1" {
+		t.Errorf("unexpected replace_mapper mapping: %v", transformations[1].Params["mapping"])
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/albertocavalcante/starlark-go-copybara/analysis"
+	"github.com/albertocavalcante/starlark-go-copybara/copybara"
+	"github.com/albertocavalcante/starlark-go-copybara/core"
+	"github.com/albertocavalcante/starlark-go-copybara/migrate"
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+)
+
+// Exit codes, mirroring upstream Copybara where possible.
+const (
+	ExitSuccess             = 0
+	ExitCommandLineError    = 1
+	ExitConfigurationError  = 2
+	ExitRepositoryError     = 3
+	ExitNoChanges           = 4
+	ExitTransformationError = 5
+	ExitInterrupted         = 8
+)
+
+// defaultWorkflow is the workflow run when none is given.
+const defaultWorkflow = "default"
+
+const usage = `usage: copybara <command> [flags] <config> [args]
+
+Commands:
+  migrate   <config> [workflow] [ref]  Run a workflow or mirror
+  validate  <config>                   Validate a configuration file
+  info      <config> [workflow]        Show workflow information
+  dry-run   <config> [workflow]        Show the effect of the transformations
+
+Run 'copybara <command> -h' for command flags.
+`
+
+// command is a CLI subcommand.
+type command struct {
+	// name is the subcommand name.
+	name string
+
+	// minArgs and maxArgs bound the number of positional arguments.
+	minArgs, maxArgs int
+
+	// flags registers the subcommand flags.
+	flags func(fs *flag.FlagSet)
+
+	// run executes the subcommand.
+	run func(c *cli, ctx context.Context, args []string) int
+}
+
+// cli holds the state of a single invocation.
+type cli struct {
+	stdout io.Writer
+	stderr io.Writer
+
+	dryRun      bool
+	workDir     string
+	json        bool
+	lastRev     string
+	initHistory bool
+	ignoreNoop  bool
+}
+
+// run executes the CLI with the given arguments and returns the exit code.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	c := &cli{stdout: stdout, stderr: stderr}
+
+	commands := []*command{
+		{
+			name: "migrate", minArgs: 1, maxArgs: 3,
+			flags: func(fs *flag.FlagSet) {
+				fs.BoolVar(&c.dryRun, "dry-run", false, "compute the migration without writing to the destination")
+				fs.StringVar(&c.workDir, "work-dir", "", "directory used to materialize the origin")
+				fs.StringVar(&c.lastRev, "last-rev", "", "last migrated origin revision, overriding the destination history")
+				fs.BoolVar(&c.initHistory, "init-history", false, "migrate the whole origin history, ignoring previous migrations")
+				fs.BoolVar(&c.ignoreNoop, "ignore-noop", false, "ignore transformations that do not change anything")
+			},
+			run: (*cli).migrate,
+		},
+		{name: "validate", minArgs: 1, maxArgs: 1, run: (*cli).validate},
+		{
+			name: "info", minArgs: 1, maxArgs: 2,
+			flags: func(fs *flag.FlagSet) {
+				fs.BoolVar(&c.json, "json", false, "print workflow information as JSON")
+			},
+			run: (*cli).info,
+		},
+		{name: "dry-run", minArgs: 1, maxArgs: 2, run: (*cli).dryRunCmd},
+	}
+
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(stderr, usage)
+		if len(args) == 0 {
+			return ExitCommandLineError
+		}
+		return ExitSuccess
+	}
+
+	var cmd *command
+	for _, candidate := range commands {
+		if candidate.name == args[0] {
+			cmd = candidate
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "copybara: unknown command %q\n\n%s", args[0], usage)
+		return ExitCommandLineError
+	}
+
+	fs := flag.NewFlagSet("copybara "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+
+	positional, err := parseInterleaved(fs, args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitSuccess
+	}
+	if err != nil {
+		return ExitCommandLineError
+	}
+	if len(positional) < cmd.minArgs || len(positional) > cmd.maxArgs {
+		fmt.Fprintf(stderr, "copybara %s: expected between %d and %d arguments, got %d\n\n%s",
+			cmd.name, cmd.minArgs, cmd.maxArgs, len(positional), usage)
+		return ExitCommandLineError
+	}
+
+	return cmd.run(c, ctx, positional)
+}
+
+// parseInterleaved parses flags that may appear before, between or after
+// positional arguments, returning the positional arguments.
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// load evaluates the configuration file.
+func (c *cli) load(config string) (*copybara.Result, int) {
+	interp := copybara.New(
+		copybara.WithDryRun(c.dryRun),
+		copybara.WithWorkdir(c.workDir),
+	)
+
+	result, err := interp.Eval(config, nil)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "copybara: configuration error: %v\n", err)
+		return nil, ExitConfigurationError
+	}
+	return result, ExitSuccess
+}
+
+// workflow returns the named workflow from the configuration.
+func (c *cli) workflow(result *copybara.Result, name string) (*core.Workflow, int) {
+	wf := result.Workflow(name)
+	if wf == nil {
+		fmt.Fprintf(c.stderr, "copybara: configuration error: workflow %q not found\n", name)
+		return nil, ExitConfigurationError
+	}
+	return wf, ExitSuccess
+}
+
+// migrate implements 'copybara migrate <config> [workflow] [ref]'.
+func (c *cli) migrate(ctx context.Context, args []string) int {
+	result, code := c.load(args[0])
+	if code != ExitSuccess {
+		return code
+	}
+
+	name := argOr(args, 1, defaultWorkflow)
+	if result.Workflow(name) == nil && result.Mirror(name) != nil {
+		return c.mirror(ctx, result, name)
+	}
+
+	opts := migrate.Options{
+		Ref:         argOr(args, 2, ""),
+		LastRev:     c.lastRev,
+		InitHistory: c.initHistory,
+		Console:     c.stderr,
+		IgnoreNoop:  c.ignoreNoop,
+	}
+
+	runResult, err := result.Run(ctx, name, opts)
+	var iterr *migrate.IterativeError
+	if errors.As(err, &iterr) {
+		c.printMigrated(iterr.Migrated)
+	}
+	if err != nil {
+		return c.fail(err)
+	}
+	for _, noop := range runResult.Noops {
+		fmt.Fprintf(c.stderr, "copybara: ignored no-op transformation: %s\n", noop)
+	}
+
+	if runResult.NoChanges {
+		fmt.Fprintf(c.stdout, "No changes to migrate for workflow %q\n", name)
+		return ExitNoChanges
+	}
+
+	verb := "Migrated"
+	if c.dryRun {
+		verb = "Would migrate"
+	}
+	if runResult.Mode == core.ModeIterative {
+		fmt.Fprintf(c.stdout, "%s workflow %q (%d change(s))\n", verb, name, len(runResult.Migrated))
+		c.printMigrated(runResult.Migrated)
+		return ExitSuccess
+	}
+
+	fmt.Fprintf(c.stdout, "%s workflow %q", verb, name)
+	if runResult.OriginRef != "" {
+		fmt.Fprintf(c.stdout, " (origin ref %s)", runResult.OriginRef)
+	}
+	fmt.Fprintln(c.stdout)
+	if runResult.ChangeRequest != "" {
+		fmt.Fprintf(c.stdout, "Change request: %s\n", runResult.ChangeRequest)
+	}
+	for _, f := range runResult.Files {
+		fmt.Fprintf(c.stdout, "  %-8s %s\n", f.Op, f.Path)
+	}
+	fmt.Fprintf(c.stdout, "\n%s\n", strings.TrimRight(runResult.Message, "\n"))
+	return ExitSuccess
+}
+
+// mirror runs the named git.mirror as part of 'copybara migrate'.
+func (c *cli) mirror(ctx context.Context, result *copybara.Result, name string) int {
+	refs, err := result.RunMirror(ctx, name)
+	if err != nil {
+		return c.fail(err)
+	}
+
+	verb := "Mirrored"
+	if c.dryRun {
+		verb = "Would mirror"
+	}
+	fmt.Fprintf(c.stdout, "%s %q (%d reference(s))\n", verb, name, len(refs))
+	for _, ref := range refs {
+		fmt.Fprintf(c.stdout, "  %s\n", ref)
+	}
+	return ExitSuccess
+}
+
+// printMigrated prints one line per change migrated in ITERATIVE mode.
+func (c *cli) printMigrated(migrated []*migrate.Result) {
+	for _, r := range migrated {
+		summary, _, _ := strings.Cut(r.Message, "\n")
+		if r.NoChanges {
+			summary = "(no changes)"
+		}
+		fmt.Fprintf(c.stdout, "  %s %s\n", r.OriginRef, summary)
+	}
+}
+
+// validate implements 'copybara validate <config>'.
+func (c *cli) validate(_ context.Context, args []string) int {
+	result, code := c.load(args[0])
+	if code != ExitSuccess {
+		return code
+	}
+
+	workflows, mirrors := result.Workflows(), result.Mirrors()
+	if len(workflows) == 0 && len(mirrors) == 0 {
+		fmt.Fprintf(c.stderr, "copybara: configuration error: %s does not define any workflow\n", args[0])
+		return ExitConfigurationError
+	}
+
+	fmt.Fprintf(c.stdout, "Configuration %s is valid (%d workflow(s)", args[0], len(workflows))
+	if len(mirrors) > 0 {
+		fmt.Fprintf(c.stdout, ", %d mirror(s)", len(mirrors))
+	}
+	fmt.Fprintln(c.stdout, ")")
+	return ExitSuccess
+}
+
+// info implements 'copybara info <config> [workflow]'.
+func (c *cli) info(_ context.Context, args []string) int {
+	result, code := c.load(args[0])
+	if code != ExitSuccess {
+		return code
+	}
+
+	workflows := result.Workflows()
+	if len(args) > 1 {
+		wf, code := c.workflow(result, args[1])
+		if code != ExitSuccess {
+			return code
+		}
+		workflows = []*core.Workflow{wf}
+	}
+
+	infos := make([]*analysis.WorkflowInfo, len(workflows))
+	for i, wf := range workflows {
+		infos[i] = analysis.IntrospectWorkflow(wf)
+	}
+
+	if c.json {
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(infos); err != nil {
+			fmt.Fprintf(c.stderr, "copybara: %v\n", err)
+			return ExitCommandLineError
+		}
+		return ExitSuccess
+	}
+
+	for i, info := range infos {
+		if i > 0 {
+			fmt.Fprintln(c.stdout)
+		}
+		fmt.Fprintf(c.stdout, "Workflow: %s\n", info.Name)
+		fmt.Fprintf(c.stdout, "  Mode:        %s\n", info.Mode)
+		fmt.Fprintf(c.stdout, "  Origin:      %s\n", info.OriginType)
+		fmt.Fprintf(c.stdout, "  Destination: %s\n", info.DestinationType)
+		if info.Authoring != nil {
+			fmt.Fprintf(c.stdout, "  Authoring:   %s (%s)\n", info.Authoring.Mode, info.Authoring.DefaultAuthor)
+		}
+		fmt.Fprintf(c.stdout, "  Transformations:\n")
+		for _, t := range info.Transformations {
+			fmt.Fprintf(c.stdout, "    - %s\n", t.Description)
+		}
+	}
+	return ExitSuccess
+}
+
+// dryRunCmd implements 'copybara dry-run <config> [workflow]'.
+func (c *cli) dryRunCmd(_ context.Context, args []string) int {
+	result, code := c.load(args[0])
+	if code != ExitSuccess {
+		return code
+	}
+
+	wf, code := c.workflow(result, argOr(args, 1, defaultWorkflow))
+	if code != ExitSuccess {
+		return code
+	}
+
+	dr := analysis.NewDryRun(wf)
+	if err := dr.Execute(); err != nil {
+		return c.fail(err)
+	}
+
+	if len(dr.Files) == 0 {
+		fmt.Fprintf(c.stdout, "Transformations do not change any file\n")
+		return ExitNoChanges
+	}
+
+	for _, f := range dr.Files {
+		fmt.Fprint(c.stdout, f.Diff)
+	}
+	return ExitSuccess
+}
+
+// fail reports a run error and returns the matching exit code.
+func (c *cli) fail(err error) int {
+	var terr *migrate.TransformationError
+	var nrerr *migrate.NonReversibleError
+	switch {
+	case errors.Is(err, context.Canceled):
+		fmt.Fprintf(c.stderr, "copybara: interrupted\n")
+		return ExitInterrupted
+	case errors.Is(err, migrate.ErrInvalidConfig):
+		fmt.Fprintf(c.stderr, "copybara: configuration error: %v\n", err)
+		return ExitConfigurationError
+	case errors.Is(err, migrate.ErrNoopFailure):
+		fmt.Fprintf(c.stderr, "copybara: %v (use --ignore-noop to ignore it)\n", err)
+		return ExitTransformationError
+	case errors.Is(err, transform.ErrNoop):
+		fmt.Fprintf(c.stderr, "copybara: %v (use --ignore-noop to ignore it)\n", err)
+		return ExitNoChanges
+	case errors.As(err, &nrerr), errors.As(err, &terr):
+		fmt.Fprintf(c.stderr, "copybara: %v\n", err)
+		return ExitTransformationError
+	default:
+		fmt.Fprintf(c.stderr, "copybara: %v\n", err)
+		return ExitRepositoryError
+	}
+}
+
+// argOr returns args[i], or def if not present.
+func argOr(args []string, i int, def string) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return def
+}
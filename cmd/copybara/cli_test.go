@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setup creates an origin with a file, an empty destination and a config
+// running the given transformations. It returns the config path and the
+// destination directory.
+func setup(t *testing.T, transformations string) (string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "hello.txt"), []byte("hello world\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := filepath.Join(dir, "copy.bara.sky")
+	content := `
+core.workflow(
+    name = "default",
+    origin = folder.origin(path = "` + src + `"),
+    destination = folder.destination(path = "` + dst + `"),
+    authoring = authoring.overwrite("Bot <bot@example.com>"),
+    transformations = [` + transformations + `],
+)
+`
+	if err := os.WriteFile(config, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return config, dst
+}
+
+func runCLI(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestMigrate(t *testing.T) {
+	config, dst := setup(t, `core.replace("world", "copybara")`)
+
+	code, stdout, stderr := runCLI("migrate", config, "default")
+	if code != ExitSuccess {
+		t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "ADDED") || !strings.Contains(stdout, "hello.txt") {
+		t.Errorf("unexpected output: %s", stdout)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dst, "hello.txt"))
+	if err != nil {
+		t.Fatalf("failed to read destination: %v", err)
+	}
+	if string(content) != "hello copybara\n" {
+		t.Errorf("destination content = %q", content)
+	}
+
+	// Running again produces no changes
+	if code, _, _ := runCLI("migrate", config); code != ExitNoChanges {
+		t.Errorf("second run exit code = %d, want %d", code, ExitNoChanges)
+	}
+}
+
+func TestMigrateDryRunFlag(t *testing.T) {
+	config, dst := setup(t, "")
+
+	code, stdout, stderr := runCLI("migrate", config, "--dry-run")
+	if code != ExitSuccess {
+		t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "Would migrate") {
+		t.Errorf("unexpected output: %s", stdout)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "hello.txt")); !os.IsNotExist(err) {
+		t.Error("dry run should not write to the destination")
+	}
+}
+
+// git runs a git command in dir.
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir,
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestMigrateMirror(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	for _, d := range []string{src, dst} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git(t, src, "init", "--quiet", "--initial-branch=main")
+	git(t, src, "commit", "--quiet", "--allow-empty", "-m", "First")
+	git(t, dst, "init", "--quiet", "--bare")
+
+	config := filepath.Join(dir, "copy.bara.sky")
+	content := `
+git.mirror(
+    name = "upstream",
+    origin = "file://` + src + `",
+    destination = "file://` + dst + `",
+)
+`
+	if err := os.WriteFile(config, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, stderr := runCLI("migrate", config, "upstream")
+	if code != ExitSuccess {
+		t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+	}
+	if !strings.Contains(stdout, `Mirrored "upstream" (1 reference(s))`) || !strings.Contains(stdout, "refs/heads/main") {
+		t.Errorf("unexpected output: %s", stdout)
+	}
+	if git(t, dst, "rev-parse", "main") != git(t, src, "rev-parse", "main") {
+		t.Error("main was not mirrored")
+	}
+
+	code, stdout, _ = runCLI("validate", config)
+	if code != ExitSuccess || !strings.Contains(stdout, "0 workflow(s), 1 mirror(s)") {
+		t.Errorf("validate exit code = %d, output = %s", code, stdout)
+	}
+}
+
+func TestMigrateExitCodes(t *testing.T) {
+	t.Run("transformation failure", func(t *testing.T) {
+		config, _ := setup(t, `core.move("missing", "other")`)
+		if code, _, _ := runCLI("migrate", config); code != ExitTransformationError {
+			t.Errorf("exit code = %d, want %d", code, ExitTransformationError)
+		}
+	})
+
+	t.Run("unknown workflow", func(t *testing.T) {
+		config, _ := setup(t, "")
+		if code, _, _ := runCLI("migrate", config, "missing"); code != ExitConfigurationError {
+			t.Errorf("exit code = %d, want %d", code, ExitConfigurationError)
+		}
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		config := filepath.Join(t.TempDir(), "copy.bara.sky")
+		if err := os.WriteFile(config, []byte("core.workflow(\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if code, _, _ := runCLI("migrate", config); code != ExitConfigurationError {
+			t.Errorf("exit code = %d, want %d", code, ExitConfigurationError)
+		}
+	})
+
+	t.Run("missing arguments", func(t *testing.T) {
+		if code, _, _ := runCLI("migrate"); code != ExitCommandLineError {
+			t.Errorf("exit code = %d, want %d", code, ExitCommandLineError)
+		}
+	})
+
+	t.Run("unknown command", func(t *testing.T) {
+		if code, _, _ := runCLI("frobnicate"); code != ExitCommandLineError {
+			t.Errorf("exit code = %d, want %d", code, ExitCommandLineError)
+		}
+	})
+}
+
+func TestMigrateNoop(t *testing.T) {
+	config, dst := setup(t, `core.replace("missing", "other")`)
+
+	code, _, stderr := runCLI("migrate", config)
+	if code != ExitTransformationError {
+		t.Errorf("exit code = %d, want %d", code, ExitTransformationError)
+	}
+	if !strings.Contains(stderr, "--ignore-noop") {
+		t.Errorf("stderr = %q, want a hint about --ignore-noop", stderr)
+	}
+	if !strings.Contains(stderr, "not allowed by noop_behavior FAIL_IF_ANY_NOOP") {
+		t.Errorf("stderr = %q, want the no-op reported as a failure", stderr)
+	}
+
+	code, _, stderr = runCLI("migrate", "--ignore-noop", config)
+	if code != ExitSuccess {
+		t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+	}
+	if !strings.Contains(stderr, "ignored no-op transformation") {
+		t.Errorf("stderr = %q, want the ignored no-op reported", stderr)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "hello.txt")); err != nil {
+		t.Errorf("hello.txt was not migrated: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	config, _ := setup(t, "")
+
+	code, stdout, _ := runCLI("validate", config)
+	if code != ExitSuccess {
+		t.Fatalf("exit code = %d", code)
+	}
+	if !strings.Contains(stdout, "1 workflow") {
+		t.Errorf("unexpected output: %s", stdout)
+	}
+
+	empty := filepath.Join(t.TempDir(), "copy.bara.sky")
+	if err := os.WriteFile(empty, []byte("x = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, _ := runCLI("validate", empty); code != ExitConfigurationError {
+		t.Errorf("exit code = %d, want %d", code, ExitConfigurationError)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	config, _ := setup(t, `core.replace("world", "copybara")`)
+
+	code, stdout, _ := runCLI("info", config)
+	if code != ExitSuccess {
+		t.Fatalf("exit code = %d", code)
+	}
+	if !strings.Contains(stdout, "Workflow: default") || !strings.Contains(stdout, "folder.origin") {
+		t.Errorf("unexpected output: %s", stdout)
+	}
+
+	code, stdout, _ = runCLI("info", "--json", config, "default")
+	if code != ExitSuccess {
+		t.Fatalf("exit code = %d", code)
+	}
+	var infos []map[string]any
+	if err := json.Unmarshal([]byte(stdout), &infos); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, stdout)
+	}
+	if len(infos) != 1 || infos[0]["name"] != "default" {
+		t.Errorf("unexpected JSON output: %s", stdout)
+	}
+}
+
+func TestDryRunCommand(t *testing.T) {
+	config, dst := setup(t, `core.replace("world", "copybara")`)
+
+	code, stdout, stderr := runCLI("dry-run", config)
+	if code != ExitSuccess {
+		t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "-hello world") || !strings.Contains(stdout, "+hello copybara") {
+		t.Errorf("unexpected diff output: %s", stdout)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "hello.txt")); !os.IsNotExist(err) {
+		t.Error("dry-run should not write to the destination")
+	}
+}
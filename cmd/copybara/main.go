@@ -0,0 +1,36 @@
+// Command copybara evaluates and runs Copybara configuration files.
+//
+// Usage:
+//
+//	copybara migrate [flags] <config> [workflow] [ref]
+//	copybara validate <config>
+//	copybara info [flags] <config> [workflow]
+//	copybara dry-run <config> [workflow]
+//
+// The workflow name defaults to "default".
+//
+// Exit codes:
+//
+//	0  success
+//	1  command line error
+//	2  configuration error
+//	3  repository error (origin or destination failure)
+//	4  no changes to migrate
+//	5  transformation failure
+//	8  interrupted
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/Main.java
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
@@ -7,13 +7,20 @@
 package copybara
 
 import (
+	"context"
+	"fmt"
+	"slices"
+
 	"go.starlark.net/starlark"
 
 	"github.com/albertocavalcante/starlark-go-copybara/authoring"
 	"github.com/albertocavalcante/starlark-go-copybara/core"
+	"github.com/albertocavalcante/starlark-go-copybara/eval"
 	"github.com/albertocavalcante/starlark-go-copybara/folder"
 	"github.com/albertocavalcante/starlark-go-copybara/git"
 	"github.com/albertocavalcante/starlark-go-copybara/metadata"
+	"github.com/albertocavalcante/starlark-go-copybara/migrate"
+	"github.com/albertocavalcante/starlark-go-copybara/patch"
 )
 
 // Interpreter evaluates Copybara configuration files.
@@ -21,11 +28,15 @@ type Interpreter struct {
 	predeclared starlark.StringDict
 	dryRun      bool
 	workDir     string
+	configRoot  string
 }
 
 // Result contains the evaluated configuration.
 type Result struct {
 	workflows []*core.Workflow
+	mirrors   []*git.Mirror
+	dryRun    bool
+	workDir   string
 }
 
 // New creates a new Copybara interpreter with default configuration.
@@ -52,6 +63,7 @@ func (i *Interpreter) registerDefaults() {
 	i.predeclared["metadata"] = metadata.Module
 	i.predeclared["authoring"] = authoring.Module
 	i.predeclared["folder"] = folder.Module
+	i.predeclared["patch"] = patch.Module
 
 	// Also register globals like glob()
 	for name, val := range core.Globals() {
@@ -60,9 +72,21 @@ func (i *Interpreter) registerDefaults() {
 }
 
 // Eval evaluates a Copybara configuration file.
+//
+// load() statements are resolved against the file system: "//" labels
+// relative to the config root and other labels relative to the loading
+// file. Workflows and mirrors defined in loaded files are included in the
+// result.
 func (i *Interpreter) Eval(filename string, src any) (*Result, error) {
+	root := i.configRoot
+	if root == "" {
+		root = eval.DefaultRoot(filename)
+	}
+	loader := eval.NewLoader(root, i.predeclared)
+
 	thread := &starlark.Thread{
 		Name: "copybara",
+		Load: loader.Load,
 	}
 
 	globals, err := starlark.ExecFile(thread, filename, src, i.predeclared)
@@ -70,15 +94,28 @@ func (i *Interpreter) Eval(filename string, src any) (*Result, error) {
 		return nil, err
 	}
 
-	// Extract workflows from globals
-	var workflows []*core.Workflow
+	// Workflows register themselves on the thread when created, so configs
+	// do not need to assign them to a global. Globals are still scanned for
+	// workflows created on other threads. The same applies to mirrors.
+	workflows := core.RegisteredWorkflows(thread)
 	for _, val := range globals {
-		if wf, ok := val.(*core.Workflow); ok {
+		if wf, ok := val.(*core.Workflow); ok && !slices.Contains(workflows, wf) {
 			workflows = append(workflows, wf)
 		}
 	}
+	mirrors := git.RegisteredMirrors(thread)
+	for _, val := range globals {
+		if m, ok := val.(*git.Mirror); ok && !slices.Contains(mirrors, m) {
+			mirrors = append(mirrors, m)
+		}
+	}
 
-	return &Result{workflows: workflows}, nil
+	return &Result{
+		workflows: workflows,
+		mirrors:   mirrors,
+		dryRun:    i.dryRun,
+		workDir:   i.workDir,
+	}, nil
 }
 
 // DryRun returns whether dry-run mode is enabled.
@@ -86,6 +123,12 @@ func (i *Interpreter) DryRun() bool {
 	return i.dryRun
 }
 
+// ConfigRoot returns the directory "//" load labels are resolved against,
+// or "" if it defaults to the directory of the evaluated file.
+func (i *Interpreter) ConfigRoot() string {
+	return i.configRoot
+}
+
 // WorkDir returns the working directory for file operations.
 func (i *Interpreter) WorkDir() string {
 	return i.workDir
@@ -95,3 +138,61 @@ func (i *Interpreter) WorkDir() string {
 func (r *Result) Workflows() []*core.Workflow {
 	return r.workflows
 }
+
+// Workflow returns the workflow with the given name, or nil if not found.
+func (r *Result) Workflow(name string) *core.Workflow {
+	for _, wf := range r.workflows {
+		if wf.Name() == name {
+			return wf
+		}
+	}
+	return nil
+}
+
+// Mirrors returns all mirrors defined in the configuration.
+func (r *Result) Mirrors() []*git.Mirror {
+	return r.mirrors
+}
+
+// Mirror returns the mirror with the given name, or nil if not found.
+func (r *Result) Mirror(name string) *git.Mirror {
+	for _, m := range r.mirrors {
+		if m.Name() == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// Run executes the named workflow.
+//
+// The interpreter's dry-run and workdir settings are used unless overridden
+// by opts.
+func (r *Result) Run(ctx context.Context, workflowName string, opts migrate.Options) (*migrate.Result, error) {
+	wf := r.Workflow(workflowName)
+	if wf == nil {
+		return nil, fmt.Errorf("%w: workflow %q not found", migrate.ErrInvalidConfig, workflowName)
+	}
+
+	if r.dryRun {
+		opts.DryRun = true
+	}
+	if opts.WorkDir == "" {
+		opts.WorkDir = r.workDir
+	}
+
+	return migrate.Run(ctx, wf, opts)
+}
+
+// RunMirror executes the named mirror and returns the origin references it
+// copied. In dry-run mode the references are fetched but not pushed.
+func (r *Result) RunMirror(ctx context.Context, mirrorName string) ([]string, error) {
+	m := r.Mirror(mirrorName)
+	if m == nil {
+		return nil, fmt.Errorf("%w: mirror %q not found", migrate.ErrInvalidConfig, mirrorName)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.Impl().WithDryRun(r.dryRun).Run()
+}
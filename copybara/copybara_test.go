@@ -1,9 +1,14 @@
 package copybara_test
 
 import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/albertocavalcante/starlark-go-copybara/copybara"
+	"github.com/albertocavalcante/starlark-go-copybara/migrate"
 )
 
 func TestNew(t *testing.T) {
@@ -59,6 +64,10 @@ func TestModulesRegistered(t *testing.T) {
 			name:   "folder module",
 			config: `_ = folder.origin()`,
 		},
+		{
+			name:   "patch module",
+			config: `_ = patch.apply`,
+		},
 		{
 			name:   "glob global function",
 			config: `_ = glob(["**/*.go"])`,
@@ -136,6 +145,36 @@ my_workflow = core.workflow(
 	}
 }
 
+func TestEval_ExtractsMirrors(t *testing.T) {
+	config := `
+git.mirror(
+    name = "upstream",
+    origin = "https://github.com/example/upstream",
+    destination = "https://github.com/example/fork",
+)
+`
+
+	result, err := copybara.New().Eval("copy.bara.sky", config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mirrors := result.Mirrors()
+	if len(mirrors) != 1 {
+		t.Fatalf("expected 1 mirror, got %d", len(mirrors))
+	}
+	if result.Mirror("upstream") != mirrors[0] || result.Mirror("missing") != nil {
+		t.Errorf("Mirror() lookup failed for %v", mirrors)
+	}
+	if len(result.Workflows()) != 0 {
+		t.Errorf("expected no workflows, got %d", len(result.Workflows()))
+	}
+
+	if _, err := result.RunMirror(context.Background(), "missing"); !errors.Is(err, migrate.ErrInvalidConfig) {
+		t.Errorf("expected ErrInvalidConfig for unknown mirror, got %v", err)
+	}
+}
+
 func TestEval_MultipleWorkflows(t *testing.T) {
 	interp := copybara.New()
 
@@ -178,3 +217,143 @@ wf2 = core.workflow(
 		t.Error("expected to find workflow2")
 	}
 }
+
+func TestResult_Run(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "hello.txt"), []byte("hello world\n"), 0644); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+
+	config := `
+core.workflow(
+    name = "default",
+    origin = folder.origin(path = "` + src + `"),
+    destination = folder.destination(path = "` + dst + `"),
+    authoring = authoring.overwrite(default = "Test <test@example.com>"),
+    transformations = [core.replace("world", "copybara")],
+)
+`
+
+	result, err := copybara.New().Eval("copy.bara.sky", config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	runResult, err := result.Run(context.Background(), "default", migrate.Options{})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if len(runResult.Files) != 1 {
+		t.Errorf("expected 1 file changed, got %v", runResult.Files)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dst, "hello.txt"))
+	if err != nil {
+		t.Fatalf("failed to read destination file: %v", err)
+	}
+	if string(content) != "hello copybara\n" {
+		t.Errorf("expected %q, got %q", "hello copybara\n", string(content))
+	}
+
+	if _, err := result.Run(context.Background(), "missing", migrate.Options{}); !errors.Is(err, migrate.ErrInvalidConfig) {
+		t.Errorf("expected ErrInvalidConfig for unknown workflow, got %v", err)
+	}
+}
+
+func TestResult_RunDryRunOption(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+
+	config := `
+core.workflow(
+    name = "default",
+    origin = folder.origin(path = "` + src + `"),
+    destination = folder.destination(path = "` + dst + `"),
+)
+`
+
+	result, err := copybara.New(copybara.WithDryRun(true)).Eval("copy.bara.sky", config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := result.Run(context.Background(), "default", migrate.Options{}); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "a.txt")); !os.IsNotExist(err) {
+		t.Error("dry run should not write to the destination")
+	}
+}
+
+func TestEval_Load(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"common/transforms.bara.sky": `
+shared = [core.move("src", "lib")]
+
+def make_workflow(name):
+    core.workflow(
+        name = name,
+        origin = folder.origin(),
+        destination = folder.destination(),
+        authoring = authoring.overwrite("Test <test@example.com>"),
+        transformations = shared,
+    )
+
+make_workflow("from_library")
+`,
+		"project/copy.bara.sky": `
+load("//common/transforms.bara.sky", "make_workflow")
+
+make_workflow("default")
+`,
+	}
+	for path, content := range files {
+		fullPath := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	interp := copybara.New(copybara.WithConfigRoot(root))
+	result, err := interp.Eval(filepath.Join(root, "project/copy.bara.sky"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, name := range []string{"default", "from_library"} {
+		wf := result.Workflow(name)
+		if wf == nil {
+			t.Fatalf("workflow %q not found", name)
+		}
+		if len(wf.Transformations()) != 1 {
+			t.Errorf("workflow %q has %d transformations, want 1", name, len(wf.Transformations()))
+		}
+	}
+}
+
+func TestEval_LoadDefaultRoot(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "lib.bara.sky"), []byte(`name = "default"`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := `
+load("//lib.bara.sky", "name")
+core.workflow(name = name)
+`
+	result, err := copybara.New().Eval(filepath.Join(root, "copy.bara.sky"), config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Workflow("default") == nil {
+		t.Error("expected workflow named from the loaded file")
+	}
+}
@@ -16,3 +16,11 @@ func WithWorkdir(dir string) Option {
 		i.workDir = dir
 	}
 }
+
+// WithConfigRoot sets the directory that load() resolves "//" labels
+// against. By default, the directory of the evaluated file is used.
+func WithConfigRoot(dir string) Option {
+	return func(i *Interpreter) {
+		i.configRoot = dir
+	}
+}
@@ -77,9 +77,11 @@ func (c *Copy) Apply(ctx *transform.Context) error {
 	return c.copyFile(beforePath, afterPath)
 }
 
-// copyDir recursively copies a directory.
+// copyDir recursively copies a directory. It returns a
+// *transform.NoopError when no file is copied.
 func (c *Copy) copyDir(src, dst string) error {
-	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+	copied := 0
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -103,8 +105,17 @@ func (c *Copy) copyDir(src, dst string) error {
 			return os.MkdirAll(dstPath, 0o750)
 		}
 
+		copied++
 		return c.copyFile(path, dstPath)
 	})
+	if err != nil {
+		return err
+	}
+
+	if copied == 0 {
+		return &transform.NoopError{Reason: fmt.Sprintf("no file matched %s under %q", c.paths, c.before)}
+	}
+	return nil
 }
 
 // copyFile copies a single file.
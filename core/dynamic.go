@@ -0,0 +1,196 @@
+package core
+
+import (
+	"fmt"
+	"io"
+
+	"go.starlark.net/starlark"
+
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+)
+
+// DynamicTransform is a transformation implemented by a Starlark function.
+//
+// The function is called with a ctx object (see TransformWork) and returns
+// None, ctx.success() or ctx.noop(message).
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/transform/SkylarkTransformation.java
+type DynamicTransform struct {
+	impl   starlark.Callable
+	params *starlark.Dict
+}
+
+var _ Transformation = (*DynamicTransform)(nil)
+
+// NewDynamicTransform creates a transformation that calls impl with the
+// given params. A nil params means no parameters.
+func NewDynamicTransform(impl starlark.Callable, params *starlark.Dict) *DynamicTransform {
+	if params == nil {
+		params = new(starlark.Dict)
+	}
+	return &DynamicTransform{impl: impl, params: params}
+}
+
+// String implements starlark.Value.
+func (d *DynamicTransform) String() string {
+	return fmt.Sprintf("core.dynamic_transform(%s)", d.impl.Name())
+}
+
+// Type implements starlark.Value.
+func (d *DynamicTransform) Type() string {
+	return "dynamic_transform"
+}
+
+// Freeze implements starlark.Value.
+func (d *DynamicTransform) Freeze() {
+	d.impl.Freeze()
+	d.params.Freeze()
+}
+
+// Truth implements starlark.Value.
+func (d *DynamicTransform) Truth() starlark.Bool {
+	return starlark.True
+}
+
+// Hash implements starlark.Value.
+func (d *DynamicTransform) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: dynamic_transform")
+}
+
+// Impl returns the Starlark function implementing the transformation.
+func (d *DynamicTransform) Impl() starlark.Callable {
+	return d.impl
+}
+
+// Params returns the parameters available to the function as ctx.params.
+func (d *DynamicTransform) Params() *starlark.Dict {
+	return d.params
+}
+
+// Apply implements Transformation.
+//
+// A function returning ctx.noop() makes Apply return a *transform.NoopError.
+func (d *DynamicTransform) Apply(ctx *transform.Context) error {
+	if ctx.WorkDir == "" {
+		return fmt.Errorf("workdir is required for dynamic transformation")
+	}
+
+	console := ctx.Console
+	if console == nil {
+		console = io.Discard
+	}
+	thread := &starlark.Thread{
+		Name: d.Describe(),
+		Print: func(_ *starlark.Thread, msg string) {
+			fmt.Fprintln(console, msg)
+		},
+	}
+
+	work := newTransformWork(ctx, d.params)
+	result, err := starlark.Call(thread, d.impl, starlark.Tuple{work}, nil)
+	if err != nil {
+		return err
+	}
+
+	switch v := result.(type) {
+	case starlark.NoneType:
+		return nil
+	case *TransformationStatus:
+		if v.noop {
+			return &transform.NoopError{Reason: v.message}
+		}
+		return nil
+	default:
+		return fmt.Errorf("%s must return None, ctx.success() or ctx.noop(), got %s", d.impl.Name(), result.Type())
+	}
+}
+
+// Reverse implements Transformation.
+//
+// Dynamic transformations are not reversible.
+func (d *DynamicTransform) Reverse() transform.Transformation {
+	return transform.NewErrorTransformation(fmt.Errorf("%s is not reversible", d.Describe()), d)
+}
+
+// Describe implements Transformation.
+func (d *DynamicTransform) Describe() string {
+	return d.impl.Name()
+}
+
+// TransformationStatus is the result of a dynamic transformation, as
+// returned by ctx.success() and ctx.noop().
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/TransformationStatus.java
+type TransformationStatus struct {
+	noop    bool
+	message string
+}
+
+// String implements starlark.Value.
+func (s *TransformationStatus) String() string {
+	if s.noop {
+		return fmt.Sprintf("noop(%q)", s.message)
+	}
+	return "success"
+}
+
+// Type implements starlark.Value.
+func (s *TransformationStatus) Type() string {
+	return "transformation_status"
+}
+
+// Freeze implements starlark.Value.
+func (s *TransformationStatus) Freeze() {}
+
+// Truth implements starlark.Value.
+func (s *TransformationStatus) Truth() starlark.Bool {
+	return starlark.True
+}
+
+// Hash implements starlark.Value.
+func (s *TransformationStatus) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: transformation_status")
+}
+
+// Attr implements starlark.HasAttrs.
+func (s *TransformationStatus) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "is_noop":
+		return starlark.Bool(s.noop), nil
+	case "is_success":
+		return starlark.Bool(!s.noop), nil
+	case "message":
+		return starlark.String(s.message), nil
+	default:
+		return nil, nil
+	}
+}
+
+// AttrNames implements starlark.HasAttrs.
+func (s *TransformationStatus) AttrNames() []string {
+	return []string{"is_noop", "is_success", "message"}
+}
+
+// dynamicTransformFn implements core.dynamic_transform().
+//
+// Parameters:
+//   - impl (required): The Starlark function implementing the
+//     transformation. It is called with a single ctx argument
+//   - params (optional): A dict available to the function as ctx.params
+//
+// Reference: CoreModule.java dynamic_transform()
+func dynamicTransformFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		impl   starlark.Callable
+		params *starlark.Dict
+	)
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+		"impl", &impl,
+		"params?", &params,
+	); err != nil {
+		return nil, err
+	}
+
+	return NewDynamicTransform(impl, params), nil
+}
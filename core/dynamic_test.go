@@ -0,0 +1,201 @@
+package core_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+
+	"github.com/albertocavalcante/starlark-go-copybara/core"
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+)
+
+// execTransformations executes src and returns the transformations in its
+// "transformations" global, as core.workflow() would receive them.
+func execTransformations(t *testing.T, src string) []core.Transformation {
+	t.Helper()
+
+	thread := &starlark.Thread{Name: "test"}
+	globals, err := starlark.ExecFile(thread, "test.sky", src, starlark.StringDict{"core": core.Module})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	seq, err := core.Module.Members["transform"].(*starlark.Builtin).CallInternal(thread, starlark.Tuple{globals["transformations"]}, nil)
+	if err != nil {
+		t.Fatalf("core.transform() error: %v", err)
+	}
+	return seq.(*core.Sequence).Transformations()
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func readFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestDynamicTransformFiles(t *testing.T) {
+	transformations := execTransformations(t, `
+def _upper(ctx):
+    for f in ctx.list(core.glob([ctx.params["glob"]])):
+        ctx.write_path(f, ctx.read_path(f).upper())
+    out = ctx.new_path("gen/out.txt")
+    ctx.write_path(out, ", ".join([p.path for p in ctx.run(core.glob(["**"]))]))
+    ctx.write_path(out.resolve_sibling("name.txt"), out.name + " in " + out.parent.path)
+
+transformations = [core.dynamic_transform(_upper, {"glob": "src/**"})]
+`)
+	dir := writeFiles(t, map[string]string{"src/a.txt": "hello\n", "src/b/c.txt": "world\n", "README": "keep\n"})
+
+	if got := transformations[0].Describe(); got != "_upper" {
+		t.Errorf("Describe() = %q, want _upper", got)
+	}
+	if err := transformations[0].Apply(&transform.Context{WorkDir: dir}); err != nil {
+		t.Fatalf("Apply() error: %v", err)
+	}
+
+	for name, want := range map[string]string{
+		"src/a.txt":    "HELLO\n",
+		"src/b/c.txt":  "WORLD\n",
+		"README":       "keep\n",
+		"gen/out.txt":  "README, src/a.txt, src/b/c.txt",
+		"gen/name.txt": "out.txt in gen",
+	} {
+		if got := readFile(t, dir, name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestDynamicTransformMessage(t *testing.T) {
+	transformations := execTransformations(t, `
+def _message(ctx):
+    ctx.set_message(ctx.message.replace("internal change", "public change") + "\n\nBug: 1\n")
+    ctx.add_label("Origin", ctx.find_label("Bug"))
+    ctx.add_label("Reviewed-by", ctx.author, separator = ": ")
+    ctx.console.info("message updated")
+    print("printed")
+    return ctx.success()
+
+transformations = [_message]
+`)
+	var console strings.Builder
+	tctx := &transform.Context{WorkDir: t.TempDir(), Message: "Make internal change", Author: "A <a@example.com>", Console: &console}
+	if err := transformations[0].Apply(tctx); err != nil {
+		t.Fatalf("Apply() error: %v", err)
+	}
+
+	want := "Make public change\n\nBug: 1\nOrigin=1\nReviewed-by: A <a@example.com>\n"
+	if tctx.Message != want {
+		t.Errorf("Message = %q, want %q", tctx.Message, want)
+	}
+	if got := tctx.GetLabel("Origin"); got != "1" {
+		t.Errorf("Origin label = %q, want 1", got)
+	}
+	if got := console.String(); got != "INFO: message updated\nprinted\n" {
+		t.Errorf("console = %q", got)
+	}
+}
+
+func TestDynamicTransformNoop(t *testing.T) {
+	transformations := execTransformations(t, `
+def _inner(ctx):
+    return ctx.noop("nothing to do")
+
+def _outer(ctx):
+    status = ctx.run(core.dynamic_transform(_inner))
+    if not status.is_noop:
+        fail("expected a noop status")
+    return ctx.noop("inner: " + status.message)
+
+transformations = [_outer]
+`)
+	err := transformations[0].Apply(&transform.Context{WorkDir: t.TempDir()})
+	var noop *transform.NoopError
+	if !errors.As(err, &noop) || !errors.Is(err, transform.ErrNoop) {
+		t.Fatalf("expected a NoopError, got %v", err)
+	}
+	if noop.Reason != "inner: nothing to do" {
+		t.Errorf("Reason = %q", noop.Reason)
+	}
+}
+
+func TestDynamicTransformErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"escape", `ctx.write_path("../out.txt", "x")`, "must be relative"},
+		{"absolute", `ctx.read_path("/etc/passwd")`, "must be relative"},
+		{"missing", `ctx.read_path("missing.txt")`, "failed to read file"},
+		{"return", `return 1`, "must return None"},
+		{"fail", `fail("boom")`, "boom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transformations := execTransformations(t, "def _impl(ctx):\n    "+tt.body+"\n\ntransformations = [_impl]\n")
+			err := transformations[0].Apply(&transform.Context{WorkDir: t.TempDir()})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDynamicTransformSymlinkEscape(t *testing.T) {
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	workDir := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(workDir, "link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	for _, body := range []string{
+		`ctx.read_path("link/secret.txt")`,
+		`ctx.write_path("link/secret.txt", "x")`,
+		`ctx.write_path("link/new/file.txt", "x")`,
+	} {
+		transformations := execTransformations(t, "def _impl(ctx):\n    "+body+"\n\ntransformations = [_impl]\n")
+		if err := transformations[0].Apply(&transform.Context{WorkDir: workDir}); err == nil {
+			t.Errorf("%s: expected an error for a path escaping the work directory", body)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(outside, "secret.txt")); string(data) != "secret\n" {
+		t.Errorf("file outside the work directory was modified: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new")); err == nil {
+		t.Error("directory created outside the work directory")
+	}
+}
+
+func TestDynamicTransformReverse(t *testing.T) {
+	transformations := execTransformations(t, "def _impl(ctx):\n    pass\n\ntransformations = [_impl]\n")
+	err := transformations[0].Reverse().Apply(&transform.Context{WorkDir: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "not reversible") {
+		t.Errorf("expected a not reversible error, got %v", err)
+	}
+}
@@ -0,0 +1,443 @@
+package core
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"go.starlark.net/starlark"
+
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+)
+
+// mapper maps the text matched by core.filter_replace.
+type mapper interface {
+	fmt.Stringer
+
+	// mapString returns the replacement for s.
+	mapString(s string) string
+
+	// reverse returns the mapper that undoes this one.
+	reverse() (mapper, error)
+}
+
+// dictMapper maps the strings found in a dict and leaves the others
+// unchanged.
+type dictMapper map[string]string
+
+var _ mapper = dictMapper(nil)
+
+// String returns the mapping in Starlark dict syntax.
+func (m dictMapper) String() string {
+	items := make([]string, 0, len(m))
+	for _, from := range slices.Sorted(maps.Keys(m)) {
+		items = append(items, fmt.Sprintf("%q: %q", from, m[from]))
+	}
+	return "{" + strings.Join(items, ", ") + "}"
+}
+
+// mapString returns the value s is mapped to, or s when it is not mapped.
+func (m dictMapper) mapString(s string) string {
+	if to, ok := m[s]; ok {
+		return to
+	}
+	return s
+}
+
+// reverse returns the inverse mapping. Two keys mapped to the same value
+// make the mapping not reversible.
+func (m dictMapper) reverse() (mapper, error) {
+	inverse := make(dictMapper, len(m))
+	for _, from := range slices.Sorted(maps.Keys(m)) {
+		to := m[from]
+		if prev, ok := inverse[to]; ok {
+			return nil, fmt.Errorf("%q and %q are both mapped to %q", prev, from, to)
+		}
+		inverse[to] = from
+	}
+	return inverse, nil
+}
+
+// ReplaceMapper maps a string by applying a list of core.replace
+// transformations to it.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/transform/ReplaceMapper.java
+type ReplaceMapper struct {
+	replaces []*Replace
+	all      bool
+}
+
+var _ mapper = (*ReplaceMapper)(nil)
+
+// String implements starlark.Value.
+func (m *ReplaceMapper) String() string {
+	parts := make([]string, len(m.replaces))
+	for i, r := range m.replaces {
+		parts[i] = r.String()
+	}
+	s := fmt.Sprintf("core.replace_mapper([%s]", strings.Join(parts, ", "))
+	if m.all {
+		s += ", all = True"
+	}
+	return s + ")"
+}
+
+// Type implements starlark.Value.
+func (m *ReplaceMapper) Type() string {
+	return "replace_mapper"
+}
+
+// Freeze implements starlark.Value.
+func (m *ReplaceMapper) Freeze() {}
+
+// Truth implements starlark.Value.
+func (m *ReplaceMapper) Truth() starlark.Bool {
+	return starlark.True
+}
+
+// Hash implements starlark.Value.
+func (m *ReplaceMapper) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: replace_mapper")
+}
+
+// Replaces returns the replacements applied in order.
+func (m *ReplaceMapper) Replaces() []*Replace {
+	return m.replaces
+}
+
+// All returns whether every replacement is applied, rather than stopping
+// at the first one that changes the string.
+func (m *ReplaceMapper) All() bool {
+	return m.all
+}
+
+// mapString applies the replacements in order.
+func (m *ReplaceMapper) mapString(s string) string {
+	for _, r := range m.replaces {
+		replaced := r.replace(s)
+		if replaced != s && !m.all {
+			return replaced
+		}
+		s = replaced
+	}
+	return s
+}
+
+// reverse returns the reverse of each replacement, in reverse order.
+func (m *ReplaceMapper) reverse() (mapper, error) {
+	reversed := make([]*Replace, len(m.replaces))
+	for i, r := range m.replaces {
+		reverse, ok := r.Reverse().(*Replace)
+		if !ok {
+			return nil, fmt.Errorf("%s is not reversible", r)
+		}
+		reversed[len(m.replaces)-1-i] = reverse
+	}
+	return &ReplaceMapper{replaces: reversed, all: m.all}, nil
+}
+
+// FilterReplace replaces the text matched by a group of a regex using a
+// mapping, leaving the rest of the file unchanged.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/transform/FilterReplace.java
+type FilterReplace struct {
+	regex        string
+	reverseRegex string
+	group        int
+	mapping      mapper
+	paths        *Glob
+
+	pattern *regexp.Regexp
+}
+
+var _ Transformation = (*FilterReplace)(nil)
+
+// compile validates the regexes and compiles the one used by Apply.
+func (f *FilterReplace) compile() error {
+	var err error
+	f.pattern, err = regexp.Compile(f.regex)
+	if err != nil {
+		return fmt.Errorf("invalid regex %q: %w", f.regex, err)
+	}
+	if f.group < 0 || f.group > f.pattern.NumSubexp() {
+		return fmt.Errorf("group %d does not exist in regex %q", f.group, f.regex)
+	}
+
+	reverse, err := regexp.Compile(f.reverseRegex)
+	if err != nil {
+		return fmt.Errorf("invalid reverse regex %q: %w", f.reverseRegex, err)
+	}
+	if f.group > reverse.NumSubexp() {
+		return fmt.Errorf("group %d does not exist in reverse regex %q", f.group, f.reverseRegex)
+	}
+	return nil
+}
+
+// String implements starlark.Value.
+func (f *FilterReplace) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "core.filter_replace(%q, %s", f.regex, f.mapping)
+	if f.group != 0 {
+		fmt.Fprintf(&sb, ", group = %d", f.group)
+	}
+	if f.paths != nil && !f.paths.IsAllFiles() {
+		fmt.Fprintf(&sb, ", paths = %s", f.paths)
+	}
+	if f.reverseRegex != f.regex {
+		fmt.Fprintf(&sb, ", reverse = %q", f.reverseRegex)
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// Type implements starlark.Value.
+func (f *FilterReplace) Type() string {
+	return "filter_replace"
+}
+
+// Freeze implements starlark.Value.
+func (f *FilterReplace) Freeze() {}
+
+// Truth implements starlark.Value.
+func (f *FilterReplace) Truth() starlark.Bool {
+	return starlark.True
+}
+
+// Hash implements starlark.Value.
+func (f *FilterReplace) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: filter_replace")
+}
+
+// Apply implements Transformation.
+func (f *FilterReplace) Apply(ctx *transform.Context) error {
+	if ctx.WorkDir == "" {
+		return fmt.Errorf("workdir is required for filter_replace transformation")
+	}
+
+	return replaceFiles(ctx.WorkDir, f.paths, func(_, content string) (string, error) {
+		return f.replace(content), nil
+	})
+}
+
+// replace maps the text captured by the group in every match of the regex.
+func (f *FilterReplace) replace(content string) string {
+	var sb strings.Builder
+	last := 0
+	replaced := false
+
+	for _, m := range f.pattern.FindAllStringSubmatchIndex(content, -1) {
+		start, end := m[2*f.group], m[2*f.group+1]
+		if start < 0 {
+			continue
+		}
+		sb.WriteString(content[last:start])
+		sb.WriteString(f.mapping.mapString(content[start:end]))
+		last = end
+		replaced = true
+	}
+
+	if !replaced {
+		return content
+	}
+	sb.WriteString(content[last:])
+	return sb.String()
+}
+
+// Reverse implements Transformation.
+//
+// The reverse matches the reverse regex and applies the reverse mapping.
+// It is only valid when the mapping can be reversed.
+func (f *FilterReplace) Reverse() transform.Transformation {
+	mapping, err := f.mapping.reverse()
+	if err != nil {
+		return transform.NewErrorTransformation(fmt.Errorf("core.filter_replace is not reversible: %w", err), f)
+	}
+	reverse := &FilterReplace{
+		regex:        f.reverseRegex,
+		reverseRegex: f.regex,
+		group:        f.group,
+		mapping:      mapping,
+		paths:        f.paths,
+	}
+	if err := reverse.compile(); err != nil {
+		return transform.NewErrorTransformation(fmt.Errorf("core.filter_replace is not reversible: %w", err), f)
+	}
+	return reverse
+}
+
+// Describe implements Transformation.
+func (f *FilterReplace) Describe() string {
+	return fmt.Sprintf("Filtering matches of %q", f.regex)
+}
+
+// Regex returns the regex whose matches are replaced.
+func (f *FilterReplace) Regex() string {
+	return f.regex
+}
+
+// ReverseRegex returns the regex used by the reverse.
+func (f *FilterReplace) ReverseRegex() string {
+	return f.reverseRegex
+}
+
+// Group returns the regex group whose text is mapped.
+func (f *FilterReplace) Group() int {
+	return f.group
+}
+
+// Paths returns the glob filter.
+func (f *FilterReplace) Paths() *Glob {
+	return f.paths
+}
+
+// Mapping returns the dict mapping the matched text, or nil when a
+// core.replace_mapper is used.
+func (f *FilterReplace) Mapping() map[string]string {
+	if m, ok := f.mapping.(dictMapper); ok {
+		return m
+	}
+	return nil
+}
+
+// ReplaceMapper returns the core.replace_mapper mapping the matched text,
+// or nil when a dict is used.
+func (f *FilterReplace) ReplaceMapper() *ReplaceMapper {
+	m, _ := f.mapping.(*ReplaceMapper)
+	return m
+}
+
+// filterReplaceFn implements core.filter_replace().
+//
+// Parameters:
+//   - regex (required): The regex whose matches are replaced
+//   - mapping (optional): A dict or core.replace_mapper() applied to the
+//     text captured by group
+//   - group (optional): The regex group to map (default: 0, the whole match)
+//   - paths (optional): Glob or list of paths to apply the replacement to
+//   - reverse (optional): The regex used by the reverse (default: regex)
+//
+// Reference: CoreModule.java filterReplace()
+func filterReplaceFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		regex        string
+		mapping      starlark.Value = starlark.None
+		group        int
+		paths        starlark.Value = starlark.None
+		reverseRegex starlark.Value = starlark.None
+	)
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+		"regex", &regex,
+		"mapping?", &mapping,
+		"group?", &group,
+		"paths?", &paths,
+		"reverse?", &reverseRegex,
+	); err != nil {
+		return nil, err
+	}
+
+	filter := &FilterReplace{
+		regex:        regex,
+		reverseRegex: regex,
+		group:        group,
+	}
+
+	switch v := mapping.(type) {
+	case starlark.NoneType:
+		filter.mapping = dictMapper{}
+	case *starlark.Dict:
+		m := make(dictMapper, v.Len())
+		for _, item := range v.Items() {
+			from, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, fmt.Errorf("mapping keys must be strings, got %s", item[0].Type())
+			}
+			to, ok := starlark.AsString(item[1])
+			if !ok {
+				return nil, fmt.Errorf("mapping values must be strings, got %s", item[1].Type())
+			}
+			m[from] = to
+		}
+		filter.mapping = m
+	case *ReplaceMapper:
+		filter.mapping = v
+	default:
+		return nil, fmt.Errorf("mapping must be a dict or core.replace_mapper, got %s", mapping.Type())
+	}
+
+	switch v := reverseRegex.(type) {
+	case starlark.NoneType:
+	case starlark.String:
+		filter.reverseRegex = string(v)
+	default:
+		return nil, fmt.Errorf("reverse must be a string, got %s", reverseRegex.Type())
+	}
+
+	// Handle paths parameter
+	switch v := paths.(type) {
+	case starlark.NoneType:
+		filter.paths = AllFiles()
+	case *Glob:
+		filter.paths = v
+	case *starlark.List:
+		patterns := make([]string, v.Len())
+		for i := range v.Len() {
+			s, ok := starlark.AsString(v.Index(i))
+			if !ok {
+				return nil, fmt.Errorf("paths must be strings, got %s", v.Index(i).Type())
+			}
+			patterns[i] = s
+		}
+		var err error
+		filter.paths, err = NewGlob(patterns, nil)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("paths must be a glob or list of strings, got %s", paths.Type())
+	}
+
+	if err := filter.compile(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	return filter, nil
+}
+
+// replaceMapperFn implements core.replace_mapper().
+//
+// Parameters:
+//   - mapping (required): The core.replace() transformations to apply
+//   - all (optional): Apply every replacement instead of stopping at the
+//     first one that changes the string (default: false)
+//
+// Reference: CoreModule.java replaceMapper()
+func replaceMapperFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		mapping *starlark.List
+		all     bool
+	)
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+		"mapping", &mapping,
+		"all?", &all,
+	); err != nil {
+		return nil, err
+	}
+
+	if mapping.Len() == 0 {
+		return nil, fmt.Errorf("%s: mapping must not be empty", fn.Name())
+	}
+
+	m := &ReplaceMapper{all: all, replaces: make([]*Replace, mapping.Len())}
+	for i := range mapping.Len() {
+		r, ok := mapping.Index(i).(*Replace)
+		if !ok {
+			return nil, fmt.Errorf("%s: mapping[%d] must be a core.replace, got %s", fn.Name(), i, mapping.Index(i).Type())
+		}
+		m.replaces[i] = r
+	}
+	return m, nil
+}
@@ -0,0 +1,167 @@
+package core_test
+
+import (
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+
+	"github.com/albertocavalcante/starlark-go-copybara/core"
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+)
+
+func evalFilterReplace(t *testing.T, expr string) *core.FilterReplace {
+	t.Helper()
+
+	thread := &starlark.Thread{Name: "test"}
+	predeclared := starlark.StringDict{
+		"core": core.Module,
+	}
+
+	val, err := starlark.Eval(thread, "test.sky", expr, predeclared)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return val.(*core.FilterReplace)
+}
+
+func TestFilterReplace(t *testing.T) {
+	const content = "import \"internal/foo\"\nimport \"internal/bar\"\n// see internal/foo\n"
+
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{
+			name: "dict",
+			expr: `core.filter_replace(
+    regex = 'import "(.*)"',
+    mapping = {"internal/foo": "public/foo"},
+    group = 1,
+)`,
+			want: "import \"public/foo\"\nimport \"internal/bar\"\n// see internal/foo\n",
+		},
+		{
+			name: "replace mapper",
+			expr: `core.filter_replace(
+    regex = 'import "(.*)"',
+    mapping = core.replace_mapper([
+        core.replace("internal/foo", "public/foo"),
+        core.replace("internal/${x}", "third_party/${x}", regex_groups = {"x": ".*"}),
+    ]),
+    group = 1,
+)`,
+			want: "import \"public/foo\"\nimport \"third_party/bar\"\n// see internal/foo\n",
+		},
+		{
+			name: "replace mapper all",
+			expr: `core.filter_replace(
+    regex = 'import "internal/.*"',
+    mapping = core.replace_mapper([
+        core.replace("internal", "public"),
+        core.replace("import", "include"),
+    ], all = True),
+)`,
+			want: "include \"public/foo\"\ninclude \"public/bar\"\n// see internal/foo\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := applyReplace(t, evalFilterReplace(t, tt.expr), content); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterReplacePaths(t *testing.T) {
+	filter := evalFilterReplace(t, `core.filter_replace("foo", {"foo": "bar"}, paths = core.glob(["src/**"]))`)
+
+	dir := writeFiles(t, map[string]string{"src/a.txt": "foo\n", "b.txt": "foo\n"})
+	if err := filter.Apply(&transform.Context{WorkDir: dir}); err != nil {
+		t.Fatalf("Apply() error: %v", err)
+	}
+	if got := readFile(t, dir, "src/a.txt"); got != "bar\n" {
+		t.Errorf("src/a.txt = %q, want bar", got)
+	}
+	if got := readFile(t, dir, "b.txt"); got != "foo\n" {
+		t.Errorf("b.txt = %q, want foo", got)
+	}
+}
+
+func TestFilterReplaceReverse(t *testing.T) {
+	filter := evalFilterReplace(t, `core.filter_replace(
+    regex = 'import "(internal/.*)"',
+    reverse = 'import "(public/.*)"',
+    mapping = core.replace_mapper([core.replace("internal/${x}", "public/${x}", regex_groups = {"x": ".*"})]),
+    group = 1,
+)`)
+
+	reverse, ok := filter.Reverse().(*core.FilterReplace)
+	if !ok {
+		t.Fatalf("expected *core.FilterReplace, got %T", filter.Reverse())
+	}
+	if reverse.Regex() != `import "(public/.*)"` || reverse.ReverseRegex() != `import "(internal/.*)"` {
+		t.Errorf("unexpected reverse: %s", reverse)
+	}
+
+	content := "import \"internal/foo\"\n"
+	forward := applyReplace(t, filter, content)
+	if forward != "import \"public/foo\"\n" {
+		t.Fatalf("forward = %q", forward)
+	}
+	if got := applyReplace(t, reverse, forward); got != content {
+		t.Errorf("round trip = %q, want %q", got, content)
+	}
+}
+
+func TestFilterReplaceNotReversible(t *testing.T) {
+	tests := []string{
+		`core.filter_replace("a|b", {"a": "c", "b": "c"})`,
+		`core.filter_replace("v[0-9]+", core.replace_mapper([core.replace("v${n}", "v", regex_groups = {"n": "[0-9]+"})]))`,
+	}
+	for _, expr := range tests {
+		err := evalFilterReplace(t, expr).Reverse().Apply(&transform.Context{WorkDir: t.TempDir()})
+		if err == nil || !strings.Contains(err.Error(), "not reversible") {
+			t.Errorf("%s: expected not reversible error, got %v", expr, err)
+		}
+	}
+}
+
+func TestFilterReplaceErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{`core.filter_replace("(")`, "invalid regex"},
+		{`core.filter_replace("a", group = 1)`, "group 1 does not exist"},
+		{`core.filter_replace("a", reverse = "(")`, "invalid reverse regex"},
+		{`core.filter_replace("(a)", group = 1, reverse = "b")`, "group 1 does not exist in reverse regex"},
+		{`core.filter_replace("a", mapping = ["b"])`, "mapping must be a dict or core.replace_mapper"},
+		{`core.replace_mapper([])`, "mapping must not be empty"},
+		{`core.replace_mapper([core.move("a", "b")])`, "mapping[0] must be a core.replace"},
+	}
+
+	thread := &starlark.Thread{Name: "test"}
+	predeclared := starlark.StringDict{
+		"core": core.Module,
+	}
+
+	for _, tt := range tests {
+		_, err := starlark.Eval(thread, "test.sky", tt.expr, predeclared)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.expr, tt.wantErr, err)
+		}
+	}
+}
+
+func TestFilterReplaceString(t *testing.T) {
+	filter := evalFilterReplace(t, `core.filter_replace("(a+)", {"b": "y", "a": "x"}, group = 1, reverse = "(x)")`)
+
+	want := `core.filter_replace("(a+)", {"a": "x", "b": "y"}, group = 1, reverse = "(x)")`
+	if filter.String() != want {
+		t.Errorf("String() = %s, want %s", filter.String(), want)
+	}
+}
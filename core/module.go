@@ -9,6 +9,10 @@
 //   - core.verify_match() - Verify regex matches in files
 //   - core.transform() - Apply transformations
 //   - core.reverse() - Reverse a transformation
+//   - core.dynamic_transform() - Define a transformation in Starlark
+//   - core.todo_replace() - Map or scrub the users in TODO annotations
+//   - core.filter_replace() - Map the text matched by a regex
+//   - core.replace_mapper() - Map strings with a list of replacements
 //
 // Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/CoreModule.java
 package core
@@ -24,13 +28,19 @@ import (
 var Module = &starlarkstruct.Module{
 	Name: "core",
 	Members: starlark.StringDict{
-		"workflow":     starlark.NewBuiltin("core.workflow", workflowFn),
-		"move":         starlark.NewBuiltin("core.move", moveFn),
-		"copy":         starlark.NewBuiltin("core.copy", copyFn),
-		"replace":      starlark.NewBuiltin("core.replace", replaceFn),
-		"remove":       starlark.NewBuiltin("core.remove", removeFn),
-		"verify_match": starlark.NewBuiltin("core.verify_match", verifyMatchFn),
-		"glob":         starlark.NewBuiltin("core.glob", globFn),
+		"workflow":          starlark.NewBuiltin("core.workflow", workflowFn),
+		"move":              starlark.NewBuiltin("core.move", moveFn),
+		"copy":              starlark.NewBuiltin("core.copy", copyFn),
+		"replace":           starlark.NewBuiltin("core.replace", replaceFn),
+		"remove":            starlark.NewBuiltin("core.remove", removeFn),
+		"verify_match":      starlark.NewBuiltin("core.verify_match", verifyMatchFn),
+		"glob":              starlark.NewBuiltin("core.glob", globFn),
+		"transform":         starlark.NewBuiltin("core.transform", transformFn),
+		"reverse":           starlark.NewBuiltin("core.reverse", reverseFn),
+		"dynamic_transform": starlark.NewBuiltin("core.dynamic_transform", dynamicTransformFn),
+		"todo_replace":      starlark.NewBuiltin("core.todo_replace", todoReplaceFn),
+		"filter_replace":    starlark.NewBuiltin("core.filter_replace", filterReplaceFn),
+		"replace_mapper":    starlark.NewBuiltin("core.replace_mapper", replaceMapperFn),
 	},
 }
 
@@ -101,25 +111,77 @@ func moveFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple,
 
 // replaceFn implements core.replace().
 //
+// Parameters:
+//   - before (required): The template to search for
+//   - after (required): The template to replace it with
+//   - regex_groups (optional): A dict from group name to the regex matched
+//     by ${name} in before
+//   - paths (optional): Glob or list of paths to apply the replacement to
+//   - first_only (optional): Replace only the first match in each file
+//   - multiline (optional): Match across lines. Otherwise each line is
+//     matched on its own and before may not contain a newline
+//   - repeated_groups (optional): Allow a group to be used more than once in
+//     before; every occurrence must match the same text
+//   - ignore (optional): Regexes of lines that are never modified
+//
 // Reference: Replace.java
 func replaceFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var (
-		before string
-		after  string
-		paths  starlark.Value = starlark.None
+		before         string
+		after          string
+		regexGroups    *starlark.Dict
+		paths          starlark.Value = starlark.None
+		firstOnly      bool
+		multiline      bool
+		repeatedGroups bool
+		ignore         *starlark.List
 	)
 
 	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
 		"before", &before,
 		"after", &after,
+		"regex_groups?", &regexGroups,
 		"paths?", &paths,
+		"first_only?", &firstOnly,
+		"multiline?", &multiline,
+		"repeated_groups?", &repeatedGroups,
+		"ignore?", &ignore,
 	); err != nil {
 		return nil, err
 	}
 
 	replace := &Replace{
-		before: before,
-		after:  after,
+		before:         before,
+		after:          after,
+		firstOnly:      firstOnly,
+		multiline:      multiline,
+		repeatedGroups: repeatedGroups,
+	}
+
+	if regexGroups != nil {
+		replace.regexGroups = make(map[string]string, regexGroups.Len())
+		for _, item := range regexGroups.Items() {
+			name, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, fmt.Errorf("regex_groups keys must be strings, got %s", item[0].Type())
+			}
+			regex, ok := starlark.AsString(item[1])
+			if !ok {
+				return nil, fmt.Errorf("regex_groups values must be strings, got %s", item[1].Type())
+			}
+			replace.regexGroups[name] = regex
+		}
+	}
+
+	if ignore != nil {
+		replace.ignore = make([]string, ignore.Len())
+		for i := range ignore.Len() {
+			s, ok := starlark.AsString(ignore.Index(i))
+			if !ok {
+				return nil, fmt.Errorf("ignore must be strings, got %s", ignore.Index(i).Type())
+			}
+			replace.ignore[i] = s
+		}
 	}
 
 	// Handle paths parameter
@@ -146,5 +208,9 @@ func replaceFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tupl
 		return nil, fmt.Errorf("paths must be a glob or list of strings, got %s", paths.Type())
 	}
 
+	if err := replace.compile(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
 	return replace, nil
 }
@@ -29,6 +29,12 @@ func TestModule(t *testing.T) {
 		"remove",
 		"verify_match",
 		"glob",
+		"transform",
+		"reverse",
+		"dynamic_transform",
+		"todo_replace",
+		"filter_replace",
+		"replace_mapper",
 	}
 
 	for _, name := range expectedMembers {
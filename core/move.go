@@ -77,8 +77,11 @@ func (m *Move) Apply(ctx *transform.Context) error {
 	return m.moveFile(beforePath, afterPath)
 }
 
-// moveDir recursively moves a directory.
+// moveDir recursively moves a directory. It returns a *transform.NoopError
+// when no file is moved.
 func (m *Move) moveDir(src, dst string) error {
+	moved := 0
+
 	// First, copy all files that match the glob
 	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
@@ -108,6 +111,7 @@ func (m *Move) moveDir(src, dst string) error {
 		if err := m.moveFile(path, dstPath); err != nil {
 			return err
 		}
+		moved++
 
 		return nil
 	})
@@ -116,6 +120,10 @@ func (m *Move) moveDir(src, dst string) error {
 		return err
 	}
 
+	if moved == 0 {
+		return &transform.NoopError{Reason: fmt.Sprintf("no file matched %s under %q", m.paths, m.before)}
+	}
+
 	// Remove empty directories
 	return m.removeEmptyDirs(src)
 }
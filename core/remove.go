@@ -81,6 +81,10 @@ func (r *Remove) Apply(ctx *transform.Context) error {
 		return fmt.Errorf("failed to walk directory: %w", err)
 	}
 
+	if len(filesToRemove) == 0 {
+		return &transform.NoopError{Reason: fmt.Sprintf("no file matched %s", r.paths)}
+	}
+
 	// Remove files in reverse order (deepest first) to handle directories
 	for i := len(filesToRemove) - 1; i >= 0; i-- {
 		path := filesToRemove[i]
@@ -3,8 +3,11 @@ package core
 import (
 	"fmt"
 	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 
 	"go.starlark.net/starlark"
@@ -14,21 +17,119 @@ import (
 
 // Replace represents a search-and-replace transformation.
 //
+// before and after are templates: ${name} references a group whose regex
+// is defined in regexGroups, and the text captured by the group in before
+// is substituted in after.
+//
 // Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/transform/Replace.java
 type Replace struct {
-	before string
-	after  string
-	paths  *Glob
+	before         string
+	after          string
+	paths          *Glob
+	regexGroups    map[string]string
+	multiline      bool
+	firstOnly      bool
+	repeatedGroups bool
+	ignore         []string
+
+	beforeTemplate *template
+	afterTemplate  *template
+	pattern        *regexp.Regexp
+	occurrences    []groupOccurrence
+	ignorePatterns []*regexp.Regexp
 }
 
 var _ Transformation = (*Replace)(nil)
 
+// compile parses and validates the templates and compiles the regexps used
+// by Apply.
+func (r *Replace) compile() error {
+	if r.before == "" {
+		return fmt.Errorf("before must not be empty")
+	}
+	// Without multiline, each line is matched on its own, so a newline in
+	// before could never match.
+	if !r.multiline && strings.Contains(r.before, "\n") {
+		return fmt.Errorf("before %q contains a newline; set multiline = True to match across lines", r.before)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(r.regexGroups)) {
+		if !groupNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid regex group name %q", name)
+		}
+		if _, err := regexp.Compile(r.regexGroups[name]); err != nil {
+			return fmt.Errorf("invalid regex for group %q: %w", name, err)
+		}
+	}
+
+	var err error
+	r.beforeTemplate, err = parseTemplate(r.before, r.regexGroups)
+	if err != nil {
+		return fmt.Errorf("before: %w", err)
+	}
+	r.afterTemplate, err = parseTemplate(r.after, r.regexGroups)
+	if err != nil {
+		return fmt.Errorf("after: %w", err)
+	}
+
+	beforeGroups := make(map[string]bool)
+	for _, name := range r.beforeTemplate.groupNames() {
+		if beforeGroups[name] && !r.repeatedGroups {
+			return fmt.Errorf("group %q is used more than once in before; set repeated_groups = True to allow it", name)
+		}
+		beforeGroups[name] = true
+	}
+	for name := range r.regexGroups {
+		if !beforeGroups[name] {
+			return fmt.Errorf("group %q is defined in regex_groups but not used in before", name)
+		}
+	}
+	for _, name := range r.afterTemplate.groupNames() {
+		if !beforeGroups[name] {
+			return fmt.Errorf("group %q is used in after but not in before", name)
+		}
+	}
+
+	r.pattern, r.occurrences, err = r.beforeTemplate.compile(r.regexGroups, r.multiline)
+	if err != nil {
+		return err
+	}
+
+	r.ignorePatterns = make([]*regexp.Regexp, len(r.ignore))
+	for i, expr := range r.ignore {
+		r.ignorePatterns[i], err = regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid ignore regex %q: %w", expr, err)
+		}
+	}
+	return nil
+}
+
 // String implements starlark.Value.
 func (r *Replace) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "core.replace(%q, %q", r.before, r.after)
+	if len(r.regexGroups) > 0 {
+		groups := make([]string, 0, len(r.regexGroups))
+		for _, name := range slices.Sorted(maps.Keys(r.regexGroups)) {
+			groups = append(groups, fmt.Sprintf("%q: %q", name, r.regexGroups[name]))
+		}
+		fmt.Fprintf(&sb, ", regex_groups = {%s}", strings.Join(groups, ", "))
+	}
 	if r.paths != nil && !r.paths.IsAllFiles() {
-		return fmt.Sprintf("core.replace(%q, %q, paths = %s)", r.before, r.after, r.paths)
+		fmt.Fprintf(&sb, ", paths = %s", r.paths)
+	}
+	if r.multiline {
+		sb.WriteString(", multiline = True")
+	}
+	if r.firstOnly {
+		sb.WriteString(", first_only = True")
 	}
-	return fmt.Sprintf("core.replace(%q, %q)", r.before, r.after)
+	if r.repeatedGroups {
+		sb.WriteString(", repeated_groups = True")
+	}
+	sb.WriteString(")")
+	return sb.String()
 }
 
 // Type implements starlark.Value.
@@ -55,7 +156,18 @@ func (r *Replace) Apply(ctx *transform.Context) error {
 		return fmt.Errorf("workdir is required for replace transformation")
 	}
 
-	return filepath.WalkDir(ctx.WorkDir, func(path string, d fs.DirEntry, err error) error {
+	return replaceFiles(ctx.WorkDir, r.paths, func(_, content string) (string, error) {
+		return r.replace(content), nil
+	})
+}
+
+// replaceFiles rewrites the content of the regular files in workDir that
+// match paths (all files when nil) with fn. Files whose content does not
+// change are not written, and a *transform.NoopError is returned when no
+// file changes.
+func replaceFiles(workDir string, paths *Glob, fn func(relPath, content string) (string, error)) error {
+	changed := 0
+	err := filepath.WalkDir(workDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -74,13 +186,13 @@ func (r *Replace) Apply(ctx *transform.Context) error {
 			return nil
 		}
 
-		relPath, err := filepath.Rel(ctx.WorkDir, path)
+		relPath, err := filepath.Rel(workDir, path)
 		if err != nil {
 			return err
 		}
 
 		// Check if file matches glob
-		if r.paths != nil && !r.paths.Matches(relPath) {
+		if paths != nil && !paths.Matches(relPath) {
 			return nil
 		}
 
@@ -90,27 +202,146 @@ func (r *Replace) Apply(ctx *transform.Context) error {
 			return fmt.Errorf("failed to read file %q: %w", relPath, err)
 		}
 
-		// Perform replacement
-		newContent := strings.ReplaceAll(string(content), r.before, r.after)
+		newContent, err := fn(relPath, string(content))
+		if err != nil {
+			return fmt.Errorf("%s: %w", relPath, err)
+		}
 
 		// Only write if content changed
 		if newContent != string(content) {
 			if err := os.WriteFile(path, []byte(newContent), info.Mode()); err != nil {
 				return fmt.Errorf("failed to write file %q: %w", relPath, err)
 			}
+			changed++
 		}
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	if changed == 0 {
+		return &transform.NoopError{Reason: "no matching file was changed"}
+	}
+	return nil
+}
+
+// replace applies the replacement to content.
+//
+// Unless multiline is set, the pattern is matched against each line on its
+// own, without its trailing newline, and first_only applies per line.
+func (r *Replace) replace(content string) string {
+	if r.multiline {
+		return r.replaceText(content)
+	}
+
+	var sb strings.Builder
+	for line := range strings.SplitAfterSeq(content, "\n") {
+		if line == "" {
+			// Nothing follows the final newline
+			continue
+		}
+		text, newline := strings.CutSuffix(line, "\n")
+		sb.WriteString(r.replaceText(text))
+		if newline {
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
+
+// replaceText applies the replacement to text.
+//
+// Matches whose repeated groups capture different text, or that touch a
+// line matched by an ignore regex, are left unchanged.
+func (r *Replace) replaceText(content string) string {
+	var sb strings.Builder
+	last := 0
+	replaced := false
+
+	for _, m := range r.pattern.FindAllStringSubmatchIndex(content, -1) {
+		if r.firstOnly && replaced {
+			break
+		}
+
+		values, ok := r.groupValues(content, m)
+		if !ok || r.ignored(content, m[0], m[1]) {
+			continue
+		}
+
+		sb.WriteString(content[last:m[0]])
+		sb.WriteString(r.afterTemplate.expand(values))
+		last = m[1]
+		replaced = true
+	}
+
+	if !replaced {
+		return content
+	}
+	sb.WriteString(content[last:])
+	return sb.String()
+}
+
+// groupValues returns the text captured by each group in a match. It
+// returns false when a repeated group captured different text.
+func (r *Replace) groupValues(content string, match []int) (map[string]string, bool) {
+	values := make(map[string]string, len(r.occurrences))
+	for _, occ := range r.occurrences {
+		var value string
+		if start := match[2*occ.sub]; start >= 0 {
+			value = content[start:match[2*occ.sub+1]]
+		}
+		if prev, seen := values[occ.name]; seen && prev != value {
+			return nil, false
+		}
+		values[occ.name] = value
+	}
+	return values, true
+}
+
+// ignored returns true if any line overlapping content[start:end] matches
+// an ignore regex.
+func (r *Replace) ignored(content string, start, end int) bool {
+	if len(r.ignorePatterns) == 0 {
+		return false
+	}
+
+	lineStart := strings.LastIndexByte(content[:start], '\n') + 1
+	lineEnd := len(content)
+	if i := strings.IndexByte(content[end:], '\n'); i != -1 {
+		lineEnd = end + i
+	}
+
+	for line := range strings.SplitSeq(content[lineStart:lineEnd], "\n") {
+		for _, re := range r.ignorePatterns {
+			if re.MatchString(line) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // Reverse implements Transformation.
+//
+// The reverse swaps before and after. It is only valid when both templates
+// reference the same groups.
 func (r *Replace) Reverse() transform.Transformation {
-	return &Replace{
-		before: r.after,
-		after:  r.before,
-		paths:  r.paths,
+	reverse := &Replace{
+		before:         r.after,
+		after:          r.before,
+		paths:          r.paths,
+		regexGroups:    r.regexGroups,
+		multiline:      r.multiline,
+		firstOnly:      r.firstOnly,
+		repeatedGroups: r.repeatedGroups,
+		ignore:         r.ignore,
+	}
+	if err := reverse.compile(); err != nil {
+		return transform.NewErrorTransformation(fmt.Errorf("core.replace is not reversible: %w", err), r)
 	}
+	return reverse
 }
 
 // Describe implements Transformation.
@@ -132,3 +363,28 @@ func (r *Replace) After() string {
 func (r *Replace) Paths() *Glob {
 	return r.paths
 }
+
+// RegexGroups returns the regexes of the groups referenced by the templates.
+func (r *Replace) RegexGroups() map[string]string {
+	return r.regexGroups
+}
+
+// Multiline returns whether the regexes are matched in multiline mode.
+func (r *Replace) Multiline() bool {
+	return r.multiline
+}
+
+// FirstOnly returns whether only the first match in each file is replaced.
+func (r *Replace) FirstOnly() bool {
+	return r.firstOnly
+}
+
+// RepeatedGroups returns whether groups may be used more than once in before.
+func (r *Replace) RepeatedGroups() bool {
+	return r.repeatedGroups
+}
+
+// Ignore returns the regexes of lines that are never modified.
+func (r *Replace) Ignore() []string {
+	return r.ignore
+}
@@ -0,0 +1,273 @@
+package core_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+
+	"github.com/albertocavalcante/starlark-go-copybara/core"
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+)
+
+func evalReplace(t *testing.T, expr string) *core.Replace {
+	t.Helper()
+
+	thread := &starlark.Thread{Name: "test"}
+	predeclared := starlark.StringDict{
+		"core": core.Module,
+	}
+
+	val, err := starlark.Eval(thread, "test.sky", expr, predeclared)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return val.(*core.Replace)
+}
+
+// applyReplace applies t to a single file with the given content and
+// returns the resulting content.
+func applyReplace(t *testing.T, tr transform.Transformation, content string) string {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "file.txt")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	if err := tr.Apply(&transform.Context{WorkDir: tmpDir}); err != nil {
+		t.Fatalf("Apply() failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	return string(data)
+}
+
+func TestReplaceTemplates(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		content string
+		want    string
+	}{
+		{
+			name:    "literal",
+			expr:    `core.replace("a.b", "c")`,
+			content: "a.b axb",
+			want:    "c axb",
+		},
+		{
+			name: "regex groups",
+			expr: `core.replace(
+    before = "import ${pkg}.internal",
+    after = "import ${pkg}.public",
+    regex_groups = {"pkg": "[a-z.]+"},
+)`,
+			content: "import com.foo.internal\nimport org.bar.internal\n",
+			want:    "import com.foo.public\nimport org.bar.public\n",
+		},
+		{
+			name: "reordered groups",
+			expr: `core.replace(
+    before = "${a}-${b}",
+    after = "${b}-${a}",
+    regex_groups = {"a": "[0-9]+", "b": "[a-z]+"},
+)`,
+			content: "12-ab 3-c",
+			want:    "ab-12 c-3",
+		},
+		{
+			name:    "escaped dollar",
+			expr:    `core.replace("$${HOME}", "$$HOME")`,
+			content: "cd ${HOME}",
+			want:    "cd $HOME",
+		},
+		{
+			name:    "first only",
+			expr:    `core.replace("foo", "bar", first_only = True)`,
+			content: "foo foo foo",
+			want:    "bar foo foo",
+		},
+		{
+			name: "multiline",
+			expr: `core.replace(
+    before = "${line}",
+    after = "// ${line}",
+    regex_groups = {"line": "^TODO.*$"},
+    multiline = True,
+)`,
+			content: "TODO one\nkeep\nTODO two\n",
+			want:    "// TODO one\nkeep\n// TODO two\n",
+		},
+		{
+			name: "single line mode",
+			expr: `core.replace(
+    before = "${start}foo",
+    after = "${start}bar",
+    regex_groups = {"start": "^"},
+)`,
+			content: "foo\nfoo\nxfoo\n",
+			want:    "bar\nbar\nxfoo\n",
+		},
+		{
+			name: "single line groups",
+			expr: `core.replace(
+    before = "a${rest}",
+    after = "b${rest}",
+    regex_groups = {"rest": "[^z]*"},
+)`,
+			content: "a1\na2",
+			want:    "b1\nb2",
+		},
+		{
+			name:    "first only per line",
+			expr:    `core.replace("foo", "bar", first_only = True)`,
+			content: "foo foo\nfoo foo\n",
+			want:    "bar foo\nbar foo\n",
+		},
+		{
+			name: "repeated groups",
+			expr: `core.replace(
+    before = "${x} = ${x}",
+    after = "${x}",
+    regex_groups = {"x": "[a-z]+"},
+    repeated_groups = True,
+)`,
+			content: "a = a\nb = c\n",
+			want:    "a\nb = c\n",
+		},
+		{
+			name: "ignore",
+			expr: `core.replace(
+    before = "internal",
+    after = "public",
+    ignore = [".*DO_NOT_REPLACE.*"],
+)`,
+			content: "internal\ninternal // DO_NOT_REPLACE\n",
+			want:    "public\ninternal // DO_NOT_REPLACE\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replace := evalReplace(t, tt.expr)
+			if got := applyReplace(t, replace, tt.content); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceTemplateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr string
+	}{
+		{
+			name:    "undefined group",
+			expr:    `core.replace("${x}", "y")`,
+			wantErr: `group "x" is used in "${x}" but not defined`,
+		},
+		{
+			name:    "unused group",
+			expr:    `core.replace("x", "y", regex_groups = {"x": "a"})`,
+			wantErr: `group "x" is defined in regex_groups but not used in before`,
+		},
+		{
+			name:    "after group not in before",
+			expr:    `core.replace("${x}", "${y}", regex_groups = {"x": "a", "y": "b"})`,
+			wantErr: `not used in before`,
+		},
+		{
+			name:    "repeated group",
+			expr:    `core.replace("${x}${x}", "${x}", regex_groups = {"x": "a"})`,
+			wantErr: "repeated_groups",
+		},
+		{
+			name:    "invalid regex",
+			expr:    `core.replace("${x}", "y", regex_groups = {"x": "("})`,
+			wantErr: `invalid regex for group "x"`,
+		},
+		{
+			name:    "unterminated reference",
+			expr:    `core.replace("${x", "y")`,
+			wantErr: "unterminated group reference",
+		},
+		{
+			name:    "empty before",
+			expr:    `core.replace("", "y")`,
+			wantErr: "before must not be empty",
+		},
+		{
+			name:    "newline without multiline",
+			expr:    `core.replace("a\nb", "c")`,
+			wantErr: "set multiline = True",
+		},
+	}
+
+	thread := &starlark.Thread{Name: "test"}
+	predeclared := starlark.StringDict{
+		"core": core.Module,
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := starlark.Eval(thread, "test.sky", tt.expr, predeclared)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestReplaceTemplateReverse(t *testing.T) {
+	replace := evalReplace(t, `core.replace(
+    before = "import ${pkg}.internal",
+    after = "import ${pkg}.public",
+    regex_groups = {"pkg": "[a-z.]+"},
+)`)
+
+	reverse, ok := replace.Reverse().(*core.Replace)
+	if !ok {
+		t.Fatalf("expected *core.Replace, got %T", replace.Reverse())
+	}
+	if reverse.Before() != "import ${pkg}.public" || reverse.After() != "import ${pkg}.internal" {
+		t.Errorf("unexpected reverse: %s", reverse)
+	}
+
+	content := "import com.foo.internal\n"
+	forward := applyReplace(t, replace, content)
+	if got := applyReplace(t, reverse, forward); got != content {
+		t.Errorf("round trip = %q, want %q", got, content)
+	}
+}
+
+func TestReplaceTemplateNotReversible(t *testing.T) {
+	// after drops the group, so the reverse cannot know what to capture.
+	replace := evalReplace(t, `core.replace(
+    before = "version ${v}",
+    after = "version",
+    regex_groups = {"v": "[0-9]+"},
+)`)
+
+	err := replace.Reverse().Apply(&transform.Context{WorkDir: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "not reversible") {
+		t.Errorf("expected not reversible error, got %v", err)
+	}
+}
+
+func TestReplaceTemplateString(t *testing.T) {
+	replace := evalReplace(t, `core.replace("${a}", "b${a}", regex_groups = {"a": "x+"}, first_only = True)`)
+
+	want := `core.replace("${a}", "b${a}", regex_groups = {"a": "x+"}, first_only = True)`
+	if replace.String() != want {
+		t.Errorf("String() = %s, want %s", replace.String(), want)
+	}
+}
@@ -0,0 +1,379 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.starlark.net/starlark"
+
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+)
+
+// NoopBehavior defines how a group of transformations handles the
+// transformations that do not change anything.
+type NoopBehavior int
+
+const (
+	// NoopIfAnyNoop stops at the first no-op transformation and makes the
+	// group a no-op.
+	NoopIfAnyNoop NoopBehavior = iota
+	// NoopIgnore ignores no-op transformations; the group is never a no-op.
+	NoopIgnore
+	// NoopIfAllNoop applies every transformation and makes the group a
+	// no-op only when all of them are.
+	NoopIfAllNoop
+	// NoopFail turns a no-op transformation into an error.
+	NoopFail
+)
+
+// String returns the string representation of the behavior.
+func (b NoopBehavior) String() string {
+	switch b {
+	case NoopIfAnyNoop:
+		return "NOOP_IF_ANY_NOOP"
+	case NoopIgnore:
+		return "IGNORE_NOOP"
+	case NoopIfAllNoop:
+		return "NOOP_IF_ALL_NOOP"
+	case NoopFail:
+		return "FAIL_IF_ANY_NOOP"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// ParseNoopBehavior parses a string to NoopBehavior.
+func ParseNoopBehavior(s string) (NoopBehavior, error) {
+	switch strings.ToUpper(s) {
+	case "NOOP_IF_ANY_NOOP":
+		return NoopIfAnyNoop, nil
+	case "IGNORE_NOOP":
+		return NoopIgnore, nil
+	case "NOOP_IF_ALL_NOOP":
+		return NoopIfAllNoop, nil
+	case "FAIL_IF_ANY_NOOP":
+		return NoopFail, nil
+	default:
+		return NoopIfAnyNoop, fmt.Errorf("unknown noop_behavior: %q", s)
+	}
+}
+
+// noopBehaviorArg returns the behavior selected by the ignore_noop and
+// noop_behavior parameters, or def when neither is set.
+func noopBehaviorArg(ignoreNoop bool, noopBehavior string, def NoopBehavior) (NoopBehavior, error) {
+	switch {
+	case ignoreNoop && noopBehavior != "":
+		return def, fmt.Errorf("ignore_noop and noop_behavior cannot be used together")
+	case ignoreNoop:
+		return NoopIgnore, nil
+	case noopBehavior != "":
+		return ParseNoopBehavior(noopBehavior)
+	default:
+		return def, nil
+	}
+}
+
+// DescribeNoop describes a no-op transformation for transform.Context.Noops.
+func DescribeNoop(t transform.Transformation, noop *transform.NoopError) string {
+	return fmt.Sprintf("%s: %s", t.Describe(), noop.Reason)
+}
+
+// Sequence is a group of transformations applied in order.
+//
+// No-op transformations are handled according to the sequence
+// NoopBehavior, NOOP_IF_ANY_NOOP by default.
+//
+// Its reverse is the explicit reversal list when one is given, or else the
+// reverse of each transformation applied in reverse order.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/transform/Sequence.java
+type Sequence struct {
+	name            string
+	transformations []Transformation
+	reversal        []Transformation
+	noopBehavior    NoopBehavior
+}
+
+var _ Transformation = (*Sequence)(nil)
+
+// NewSequence creates a new Sequence. A nil reversal means the reverse is
+// computed from the transformations.
+func NewSequence(transformations, reversal []Transformation) *Sequence {
+	return &Sequence{
+		transformations: transformations,
+		reversal:        reversal,
+	}
+}
+
+// String implements starlark.Value.
+func (s *Sequence) String() string {
+	parts := make([]string, len(s.transformations))
+	for i, t := range s.transformations {
+		parts[i] = t.String()
+	}
+	return fmt.Sprintf("core.transform([%s])", strings.Join(parts, ", "))
+}
+
+// Type implements starlark.Value.
+func (s *Sequence) Type() string {
+	return "sequence"
+}
+
+// Freeze implements starlark.Value.
+func (s *Sequence) Freeze() {
+	for _, t := range s.transformations {
+		t.Freeze()
+	}
+	for _, t := range s.reversal {
+		t.Freeze()
+	}
+}
+
+// Truth implements starlark.Value.
+func (s *Sequence) Truth() starlark.Bool {
+	return starlark.True
+}
+
+// Hash implements starlark.Value.
+func (s *Sequence) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: sequence")
+}
+
+// Apply implements Transformation.
+func (s *Sequence) Apply(ctx *transform.Context) error {
+	behavior := s.noopBehavior
+	if ctx.IgnoreNoop {
+		behavior = NoopIgnore
+	}
+
+	var noops []string
+	for _, t := range s.transformations {
+		err := t.Apply(ctx)
+		var noop *transform.NoopError
+		if !errors.As(err, &noop) {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch behavior {
+		case NoopIfAnyNoop:
+			return err
+		case NoopFail:
+			return fmt.Errorf("%s was a no-op: %s", t.Describe(), noop.Reason)
+		default:
+			noops = append(noops, DescribeNoop(t, noop))
+		}
+	}
+
+	if behavior == NoopIfAllNoop && len(noops) > 0 && len(noops) == len(s.transformations) {
+		return &transform.NoopError{Reason: fmt.Sprintf("all the transformations of %s were no-ops", s.Describe())}
+	}
+	ctx.Noops = append(ctx.Noops, noops...)
+	return nil
+}
+
+// Reverse implements Transformation.
+func (s *Sequence) Reverse() transform.Transformation {
+	reversal := s.reversal
+	if reversal == nil {
+		reversal = reverseAll(s.transformations)
+	}
+	return &Sequence{
+		name:            s.name,
+		transformations: reversal,
+		reversal:        s.transformations,
+		noopBehavior:    s.noopBehavior,
+	}
+}
+
+// Describe implements Transformation.
+func (s *Sequence) Describe() string {
+	if s.name != "" {
+		return s.name
+	}
+	return "core.transform"
+}
+
+// Name returns the sequence name (may be empty).
+func (s *Sequence) Name() string {
+	return s.name
+}
+
+// Transformations returns the transformations applied in order.
+func (s *Sequence) Transformations() []Transformation {
+	return s.transformations
+}
+
+// Reversal returns the explicit reversal, or nil if the reverse is computed.
+func (s *Sequence) Reversal() []Transformation {
+	return s.reversal
+}
+
+// IgnoreNoop returns whether no-op transformations in the sequence are ignored.
+func (s *Sequence) IgnoreNoop() bool {
+	return s.noopBehavior == NoopIgnore
+}
+
+// NoopBehavior returns how no-op transformations in the sequence are handled.
+func (s *Sequence) NoopBehavior() NoopBehavior {
+	return s.noopBehavior
+}
+
+// reverseAll returns the reverse of each transformation, in reverse order.
+func reverseAll(transformations []Transformation) []Transformation {
+	reversed := make([]Transformation, len(transformations))
+	for i, t := range transformations {
+		reversed[len(transformations)-1-i] = asTransformation(t.Reverse())
+	}
+	return reversed
+}
+
+// asTransformation returns t as a Starlark transformation, wrapping it if
+// it is not a Starlark value (e.g. the noop reverse of a transformation).
+func asTransformation(t transform.Transformation) Transformation {
+	if st, ok := t.(Transformation); ok {
+		return st
+	}
+	return &wrappedTransformation{t: t}
+}
+
+// wrappedTransformation exposes a transform.Transformation to Starlark.
+type wrappedTransformation struct {
+	t transform.Transformation
+}
+
+func (w *wrappedTransformation) String() string { return w.t.Describe() }
+func (w *wrappedTransformation) Type() string   { return "transformation" }
+func (w *wrappedTransformation) Freeze()        {}
+func (w *wrappedTransformation) Truth() starlark.Bool {
+	return starlark.True
+}
+func (w *wrappedTransformation) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: transformation")
+}
+
+// Apply implements Transformation.
+func (w *wrappedTransformation) Apply(ctx *transform.Context) error {
+	return w.t.Apply(ctx)
+}
+
+// Reverse implements Transformation.
+func (w *wrappedTransformation) Reverse() transform.Transformation {
+	return w.t.Reverse()
+}
+
+// Describe implements Transformation.
+func (w *wrappedTransformation) Describe() string {
+	return w.t.Describe()
+}
+
+// Unwrap returns the wrapped transformation.
+func (w *wrappedTransformation) Unwrap() transform.Transformation {
+	return w.t
+}
+
+// toTransformations converts a Starlark list to a list of transformations.
+// Starlark functions are wrapped as dynamic transformations without params.
+func toTransformations(list *starlark.List) ([]Transformation, error) {
+	transformations := make([]Transformation, list.Len())
+	for i := range list.Len() {
+		switch item := list.Index(i).(type) {
+		case Transformation:
+			transformations[i] = item
+		case starlark.Callable:
+			transformations[i] = NewDynamicTransform(item, nil)
+		default:
+			return nil, fmt.Errorf("transformations[%d] must be a transformation, got %s", i, item.Type())
+		}
+	}
+	return transformations, nil
+}
+
+// transformFn implements core.transform().
+//
+// Parameters:
+//   - transformations (required): The transformations to apply, in order
+//   - reversal (optional): The transformations to apply when reversing.
+//     Defaults to the reverse of each transformation in reverse order
+//   - name (optional): A name used to describe the group
+//   - ignore_noop (optional): Ignore transformations in the group that do
+//     not change anything (default: false)
+//   - noop_behavior (optional): How no-op transformations are handled:
+//     NOOP_IF_ANY_NOOP (default), IGNORE_NOOP, NOOP_IF_ALL_NOOP or
+//     FAIL_IF_ANY_NOOP. Cannot be used with ignore_noop
+//
+// Reference: CoreModule.java transform()
+func transformFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		transformations *starlark.List
+		reversal        *starlark.List
+		name            string
+		ignoreNoop      bool
+		noopBehavior    string
+	)
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+		"transformations", &transformations,
+		"reversal?", &reversal,
+		"name?", &name,
+		"ignore_noop?", &ignoreNoop,
+		"noop_behavior?", &noopBehavior,
+	); err != nil {
+		return nil, err
+	}
+
+	behavior, err := noopBehaviorArg(ignoreNoop, noopBehavior, NoopIfAnyNoop)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	seq := &Sequence{
+		name:         name,
+		noopBehavior: behavior,
+	}
+
+	seq.transformations, err = toTransformations(transformations)
+	if err != nil {
+		return nil, err
+	}
+
+	if reversal != nil {
+		seq.reversal, err = toTransformations(reversal)
+		if err != nil {
+			return nil, fmt.Errorf("reversal: %w", err)
+		}
+	}
+
+	return seq, nil
+}
+
+// reverseFn implements core.reverse().
+//
+// It returns a new list with the reverse of each transformation, in
+// reverse order.
+//
+// Reference: CoreModule.java reverse()
+func reverseFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var transformations *starlark.List
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+		"transformations", &transformations,
+	); err != nil {
+		return nil, err
+	}
+
+	list, err := toTransformations(transformations)
+	if err != nil {
+		return nil, err
+	}
+
+	reversed := reverseAll(list)
+	elems := make([]starlark.Value, len(reversed))
+	for i, t := range reversed {
+		elems[i] = t
+	}
+	return starlark.NewList(elems), nil
+}
@@ -0,0 +1,338 @@
+package core_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+
+	"github.com/albertocavalcante/starlark-go-copybara/core"
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+)
+
+func evalSequence(t *testing.T, expr string) *core.Sequence {
+	t.Helper()
+
+	thread := &starlark.Thread{Name: "test"}
+	predeclared := starlark.StringDict{
+		"core": core.Module,
+	}
+
+	val, err := starlark.Eval(thread, "test.sky", expr, predeclared)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	seq, ok := val.(*core.Sequence)
+	if !ok {
+		t.Fatalf("expected *core.Sequence, got %T", val)
+	}
+	return seq
+}
+
+func TestTransform(t *testing.T) {
+	seq := evalSequence(t, `core.transform(
+    [core.move("a", "b"), core.replace("foo", "bar")],
+    name = "group",
+    ignore_noop = True,
+)`)
+
+	if len(seq.Transformations()) != 2 {
+		t.Errorf("len(Transformations()) = %d, want 2", len(seq.Transformations()))
+	}
+	if seq.Reversal() != nil {
+		t.Errorf("Reversal() = %v, want nil", seq.Reversal())
+	}
+	if seq.Name() != "group" || seq.Describe() != "group" {
+		t.Errorf("Name() = %q, Describe() = %q, want %q", seq.Name(), seq.Describe(), "group")
+	}
+	if !seq.IgnoreNoop() {
+		t.Error("IgnoreNoop() should be true")
+	}
+	if seq.Type() != "sequence" {
+		t.Errorf("Type() = %q, want %q", seq.Type(), "sequence")
+	}
+}
+
+func TestTransformInvalidElement(t *testing.T) {
+	thread := &starlark.Thread{Name: "test"}
+	predeclared := starlark.StringDict{
+		"core": core.Module,
+	}
+
+	_, err := starlark.Eval(thread, "test.sky", `core.transform([core.move("a", "b"), "oops"])`, predeclared)
+	if err == nil || !strings.Contains(err.Error(), "transformations[1]") {
+		t.Errorf("expected error for non-transformation element, got %v", err)
+	}
+}
+
+func TestTransformApply(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("foo"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	// The replace only sees the file after it has been moved.
+	seq := evalSequence(t, `core.transform([
+    core.move("a.txt", "b.txt"),
+    core.replace("foo", "bar", paths = ["b.txt"]),
+])`)
+
+	if err := seq.Apply(&transform.Context{WorkDir: tmpDir}); err != nil {
+		t.Fatalf("Apply() failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, "b.txt"))
+	if err != nil {
+		t.Fatalf("failed to read b.txt: %v", err)
+	}
+	if string(data) != "bar" {
+		t.Errorf("b.txt = %q, want %q", data, "bar")
+	}
+}
+
+func TestTransformReverse(t *testing.T) {
+	seq := evalSequence(t, `core.transform([
+    core.move("a", "b"),
+    core.replace("foo", "bar"),
+])`)
+
+	reverse, ok := seq.Reverse().(*core.Sequence)
+	if !ok {
+		t.Fatalf("expected *core.Sequence, got %T", seq.Reverse())
+	}
+
+	steps := reverse.Transformations()
+	if len(steps) != 2 {
+		t.Fatalf("len(Transformations()) = %d, want 2", len(steps))
+	}
+	replace, ok := steps[0].(*core.Replace)
+	if !ok || replace.Before() != "bar" || replace.After() != "foo" {
+		t.Errorf("steps[0] = %v, want reversed replace", steps[0])
+	}
+	move, ok := steps[1].(*core.Move)
+	if !ok || move.Before() != "b" || move.After() != "a" {
+		t.Errorf("steps[1] = %v, want reversed move", steps[1])
+	}
+
+	// Reversing twice yields the original transformations.
+	back := reverse.Reverse().(*core.Sequence)
+	if back.Transformations()[0] != seq.Transformations()[0] {
+		t.Errorf("double reverse = %v, want %v", back, seq)
+	}
+}
+
+func TestTransformExplicitReversal(t *testing.T) {
+	seq := evalSequence(t, `core.transform(
+    [core.replace("foo", "bar")],
+    reversal = [core.replace("bar", "baz")],
+)`)
+
+	reverse := seq.Reverse().(*core.Sequence)
+	replace, ok := reverse.Transformations()[0].(*core.Replace)
+	if !ok || replace.Before() != "bar" || replace.After() != "baz" {
+		t.Errorf("reverse = %v, want explicit reversal", reverse)
+	}
+	if reverse.Reverse().(*core.Sequence).Transformations()[0] != seq.Transformations()[0] {
+		t.Error("reversing the reversal should yield the original transformations")
+	}
+}
+
+func TestReverseBuiltin(t *testing.T) {
+	thread := &starlark.Thread{Name: "test"}
+	predeclared := starlark.StringDict{
+		"core": core.Module,
+	}
+
+	val, err := starlark.Eval(thread, "test.sky",
+		`core.reverse([core.move("a", "b"), core.copy("c", "d")])`, predeclared)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	list, ok := val.(*starlark.List)
+	if !ok {
+		t.Fatalf("expected *starlark.List, got %T", val)
+	}
+	if list.Len() != 2 {
+		t.Fatalf("len = %d, want 2", list.Len())
+	}
+
+	if _, ok := list.Index(0).(*core.Remove); !ok {
+		t.Errorf("element 0 = %T, want *core.Remove", list.Index(0))
+	}
+
+	move, ok := list.Index(1).(*core.Move)
+	if !ok || move.Before() != "b" || move.After() != "a" {
+		t.Errorf("element 1 = %v, want reversed move", list.Index(1))
+	}
+}
+
+func TestReverseInWorkflow(t *testing.T) {
+	thread := &starlark.Thread{Name: "test"}
+	predeclared := starlark.StringDict{
+		"core": core.Module,
+	}
+
+	src := `
+steps = [core.move("a", "b")]
+wf = core.workflow(
+    name = "reverse",
+    transformations = core.reverse(steps) + [core.transform(steps)],
+)
+`
+	globals, err := starlark.ExecFile(thread, "test.sky", src, predeclared)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wf := globals["wf"].(*core.Workflow)
+	if len(wf.Transformations()) != 2 {
+		t.Errorf("len(Transformations()) = %d, want 2", len(wf.Transformations()))
+	}
+}
+
+func TestTransformNoopBehavior(t *testing.T) {
+	tests := []struct {
+		name       string
+		expr       string
+		ignoreNoop bool
+		wantErr    string
+		wantNoop   bool
+		wantA      string
+		wantNoops  int
+	}{
+		{
+			name:     "noop if any noop",
+			expr:     `core.transform([core.replace("missing", "x"), core.replace("foo", "bar")])`,
+			wantNoop: true,
+			wantA:    "foo",
+		},
+		{
+			name:      "ignore noop",
+			expr:      `core.transform([core.replace("missing", "x"), core.replace("foo", "bar")], ignore_noop = True)`,
+			wantA:     "bar",
+			wantNoops: 1,
+		},
+		{
+			name:       "context ignore noop",
+			expr:       `core.transform([core.replace("missing", "x"), core.replace("foo", "bar")])`,
+			ignoreNoop: true,
+			wantA:      "bar",
+			wantNoops:  1,
+		},
+		{
+			name:      "noop if all noop with a change",
+			expr:      `core.transform([core.replace("missing", "x"), core.replace("foo", "bar")], noop_behavior = "NOOP_IF_ALL_NOOP")`,
+			wantA:     "bar",
+			wantNoops: 1,
+		},
+		{
+			name:     "noop if all noop",
+			expr:     `core.transform([core.replace("missing", "x"), core.replace("other", "y")], noop_behavior = "NOOP_IF_ALL_NOOP")`,
+			wantNoop: true,
+			wantA:    "foo",
+		},
+		{
+			name:    "fail if any noop",
+			expr:    `core.transform([core.replace("foo", "bar"), core.replace("missing", "x")], noop_behavior = "FAIL_IF_ANY_NOOP")`,
+			wantErr: `Replacing "missing" with "x" was a no-op`,
+			wantA:   "bar",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("foo"), 0o644); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+
+			ctx := &transform.Context{WorkDir: tmpDir, IgnoreNoop: tt.ignoreNoop}
+			err := evalSequence(t, tt.expr).Apply(ctx)
+			switch {
+			case tt.wantNoop:
+				if !errors.Is(err, transform.ErrNoop) {
+					t.Errorf("expected a no-op error, got %v", err)
+				}
+			case tt.wantErr != "":
+				if err == nil || errors.Is(err, transform.ErrNoop) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected an error containing %q, got %v", tt.wantErr, err)
+				}
+			case err != nil:
+				t.Errorf("Apply() error: %v", err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(tmpDir, "a.txt"))
+			if err != nil {
+				t.Fatalf("failed to read a.txt: %v", err)
+			}
+			if string(data) != tt.wantA {
+				t.Errorf("a.txt = %q, want %q", data, tt.wantA)
+			}
+			if len(ctx.Noops) != tt.wantNoops {
+				t.Errorf("Noops = %q, want %d entries", ctx.Noops, tt.wantNoops)
+			}
+		})
+	}
+}
+
+func TestTransformNoopBehaviorErrors(t *testing.T) {
+	thread := &starlark.Thread{Name: "test"}
+	predeclared := starlark.StringDict{
+		"core": core.Module,
+	}
+
+	tests := map[string]string{
+		`core.transform([], ignore_noop = True, noop_behavior = "IGNORE_NOOP")`: "cannot be used together",
+		`core.transform([], noop_behavior = "SOMETIMES")`:                       "unknown noop_behavior",
+	}
+	for expr, wantErr := range tests {
+		_, err := starlark.Eval(thread, "test.sky", expr, predeclared)
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%s: expected error containing %q, got %v", expr, wantErr, err)
+		}
+	}
+}
+
+func TestTransformationsReportNoop(t *testing.T) {
+	files := map[string]string{"a.txt": "foo\n", "dir/b.txt": "bar\n"}
+
+	tests := []string{
+		`core.replace("missing", "x")`,
+		`core.todo_replace(mapping = {"alice": "bob"})`,
+		`core.filter_replace("missing", {"missing": "x"})`,
+		`core.remove(glob(["*.md"]))`,
+		`core.move("dir", "other", paths = glob(["*.md"]))`,
+		`core.copy("dir", "other", paths = glob(["*.md"]))`,
+		`core.verify_match("foo", paths = glob(["*.md"]))`,
+	}
+
+	thread := &starlark.Thread{Name: "test"}
+	predeclared := starlark.StringDict{
+		"core": core.Module,
+		"glob": core.Globals()["glob"],
+	}
+
+	for _, expr := range tests {
+		val, err := starlark.Eval(thread, "test.sky", expr, predeclared)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", expr, err)
+		}
+
+		dir := writeFiles(t, files)
+		err = val.(core.Transformation).Apply(&transform.Context{WorkDir: dir})
+		var noop *transform.NoopError
+		if !errors.As(err, &noop) || noop.Reason == "" {
+			t.Errorf("%s: expected a no-op error with a reason, got %v", expr, err)
+		}
+		for name, want := range files {
+			if got := readFile(t, dir, name); got != want {
+				t.Errorf("%s: %s = %q, want %q", expr, name, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// groupNamePattern matches valid regex group names in templates.
+var groupNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// templateToken is a literal string or a ${name} group reference.
+type templateToken struct {
+	literal string
+	group   string
+}
+
+// template is a parsed core.replace before/after template.
+//
+// Templates are plain text where ${name} references a group defined in
+// regex_groups and $$ is a literal $. A $ not followed by { or $ is kept
+// as is.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/templatetoken/RegexTemplateTokens.java
+type template struct {
+	raw    string
+	tokens []templateToken
+}
+
+// parseTemplate parses a template, checking that every referenced group
+// is defined in groups.
+func parseTemplate(raw string, groups map[string]string) (*template, error) {
+	t := &template{raw: raw}
+
+	var literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			t.tokens = append(t.tokens, templateToken{literal: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c != '$' || i+1 == len(raw) {
+			literal.WriteByte(c)
+			continue
+		}
+
+		switch raw[i+1] {
+		case '$':
+			literal.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(raw[i+2:], '}')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated group reference in %q", raw)
+			}
+			name := raw[i+2 : i+2+end]
+			if !groupNamePattern.MatchString(name) {
+				return nil, fmt.Errorf("invalid group name %q in %q", name, raw)
+			}
+			if _, ok := groups[name]; !ok {
+				return nil, fmt.Errorf("group %q is used in %q but not defined in regex_groups", name, raw)
+			}
+			flush()
+			t.tokens = append(t.tokens, templateToken{group: name})
+			i += 2 + end
+		default:
+			literal.WriteByte(c)
+		}
+	}
+	flush()
+
+	return t, nil
+}
+
+// groupNames returns the group names referenced by the template, in order
+// of appearance and including repetitions.
+func (t *template) groupNames() []string {
+	var names []string
+	for _, tok := range t.tokens {
+		if tok.group != "" {
+			names = append(names, tok.group)
+		}
+	}
+	return names
+}
+
+// groupOccurrence maps a group reference in a compiled template to the
+// regexp subexpression that captures it.
+type groupOccurrence struct {
+	name string
+	sub  int
+}
+
+// compile builds the regexp matching the template. Each group reference
+// becomes a capturing subexpression using the group's regex. Without
+// multiline, callers match the regexp against one line at a time.
+func (t *template) compile(groups map[string]string, multiline bool) (*regexp.Regexp, []groupOccurrence, error) {
+	var sb strings.Builder
+	if multiline {
+		sb.WriteString("(?m)")
+	}
+
+	var internal []string
+	for _, tok := range t.tokens {
+		if tok.group == "" {
+			sb.WriteString(regexp.QuoteMeta(tok.literal))
+			continue
+		}
+		name := fmt.Sprintf("g%d", len(internal))
+		internal = append(internal, tok.group)
+		fmt.Fprintf(&sb, "(?P<%s>(?:%s))", name, groups[tok.group])
+	}
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid template %q: %w", t.raw, err)
+	}
+
+	occurrences := make([]groupOccurrence, len(internal))
+	for i, group := range internal {
+		occurrences[i] = groupOccurrence{name: group, sub: re.SubexpIndex(fmt.Sprintf("g%d", i))}
+	}
+	return re, occurrences, nil
+}
+
+// expand renders the template with the given group values.
+func (t *template) expand(values map[string]string) string {
+	var sb strings.Builder
+	for _, tok := range t.tokens {
+		if tok.group != "" {
+			sb.WriteString(values[tok.group])
+		} else {
+			sb.WriteString(tok.literal)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,429 @@
+package core
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"go.starlark.net/starlark"
+
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+)
+
+// TodoMode defines how core.todo_replace handles the users of a TODO.
+type TodoMode int
+
+const (
+	// TodoMapOrIgnore maps the users found in the mapping and leaves the
+	// others unchanged.
+	TodoMapOrIgnore TodoMode = iota
+	// TodoMapOrFail maps the users found in the mapping and fails for the
+	// others.
+	TodoMapOrFail
+	// TodoMapOrDefault maps the users found in the mapping and replaces the
+	// others with the default.
+	TodoMapOrDefault
+	// TodoScrubNames removes the users, turning TODO(user) into TODO.
+	TodoScrubNames
+	// TodoUseDefault replaces every user with the default.
+	TodoUseDefault
+)
+
+// String returns the string representation of the mode.
+func (m TodoMode) String() string {
+	switch m {
+	case TodoMapOrIgnore:
+		return "MAP_OR_IGNORE"
+	case TodoMapOrFail:
+		return "MAP_OR_FAIL"
+	case TodoMapOrDefault:
+		return "MAP_OR_DEFAULT"
+	case TodoScrubNames:
+		return "SCRUB_NAMES"
+	case TodoUseDefault:
+		return "USE_DEFAULT"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// ParseTodoMode parses a string to TodoMode.
+func ParseTodoMode(s string) (TodoMode, error) {
+	switch strings.ToUpper(s) {
+	case "MAP_OR_IGNORE":
+		return TodoMapOrIgnore, nil
+	case "MAP_OR_FAIL":
+		return TodoMapOrFail, nil
+	case "MAP_OR_DEFAULT":
+		return TodoMapOrDefault, nil
+	case "SCRUB_NAMES":
+		return TodoScrubNames, nil
+	case "USE_DEFAULT":
+		return TodoUseDefault, nil
+	default:
+		return TodoMapOrIgnore, fmt.Errorf("unknown todo_replace mode: %q", s)
+	}
+}
+
+// DefaultTodoTags are the tags rewritten by core.todo_replace by default.
+var DefaultTodoTags = []string{"TODO", "NOTE"}
+
+// TodoReplace rewrites the users in TODO(user1, user2) style annotations.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/transform/TodoReplace.java
+type TodoReplace struct {
+	tags          []string
+	mapping       map[string]string
+	mode          TodoMode
+	paths         *Glob
+	defaultString string
+	ignore        string
+
+	pattern       *regexp.Regexp
+	ignorePattern *regexp.Regexp
+}
+
+var _ Transformation = (*TodoReplace)(nil)
+
+// compile validates the configuration and compiles the regexps used by
+// Apply.
+func (r *TodoReplace) compile() error {
+	if len(r.tags) == 0 {
+		return fmt.Errorf("tags must not be empty")
+	}
+	switch r.mode {
+	case TodoMapOrDefault, TodoUseDefault:
+		if r.defaultString == "" {
+			return fmt.Errorf("default is required for mode %s", r.mode)
+		}
+	default:
+		if r.defaultString != "" {
+			return fmt.Errorf("default is only used with MAP_OR_DEFAULT and USE_DEFAULT modes")
+		}
+	}
+	if (r.mode == TodoScrubNames || r.mode == TodoUseDefault) && len(r.mapping) > 0 {
+		return fmt.Errorf("mapping cannot be used with mode %s", r.mode)
+	}
+
+	quoted := make([]string, len(r.tags))
+	for i, tag := range r.tags {
+		if tag == "" {
+			return fmt.Errorf("tags must not be empty strings")
+		}
+		quoted[i] = regexp.QuoteMeta(tag)
+	}
+	r.pattern = regexp.MustCompile(`\b(` + strings.Join(quoted, "|") + `)\(([^()\n]*)\)`)
+
+	if r.ignore != "" {
+		var err error
+		r.ignorePattern, err = regexp.Compile("^(?:" + r.ignore + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid ignore regex %q: %w", r.ignore, err)
+		}
+	}
+	return nil
+}
+
+// String implements starlark.Value.
+func (r *TodoReplace) String() string {
+	var sb strings.Builder
+	tags := make([]string, len(r.tags))
+	for i, tag := range r.tags {
+		tags[i] = fmt.Sprintf("%q", tag)
+	}
+	fmt.Fprintf(&sb, "core.todo_replace(tags = [%s]", strings.Join(tags, ", "))
+	if len(r.mapping) > 0 {
+		mapping := make([]string, 0, len(r.mapping))
+		for _, user := range slices.Sorted(maps.Keys(r.mapping)) {
+			mapping = append(mapping, fmt.Sprintf("%q: %q", user, r.mapping[user]))
+		}
+		fmt.Fprintf(&sb, ", mapping = {%s}", strings.Join(mapping, ", "))
+	}
+	fmt.Fprintf(&sb, ", mode = %q", r.mode)
+	if r.paths != nil && !r.paths.IsAllFiles() {
+		fmt.Fprintf(&sb, ", paths = %s", r.paths)
+	}
+	if r.defaultString != "" {
+		fmt.Fprintf(&sb, ", default = %q", r.defaultString)
+	}
+	if r.ignore != "" {
+		fmt.Fprintf(&sb, ", ignore = %q", r.ignore)
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// Type implements starlark.Value.
+func (r *TodoReplace) Type() string {
+	return "todo_replace"
+}
+
+// Freeze implements starlark.Value.
+func (r *TodoReplace) Freeze() {}
+
+// Truth implements starlark.Value.
+func (r *TodoReplace) Truth() starlark.Bool {
+	return starlark.True
+}
+
+// Hash implements starlark.Value.
+func (r *TodoReplace) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: todo_replace")
+}
+
+// Apply implements Transformation.
+func (r *TodoReplace) Apply(ctx *transform.Context) error {
+	if ctx.WorkDir == "" {
+		return fmt.Errorf("workdir is required for todo_replace transformation")
+	}
+
+	return replaceFiles(ctx.WorkDir, r.paths, func(_, content string) (string, error) {
+		return r.replace(content)
+	})
+}
+
+// replace rewrites the users of every TODO in content.
+func (r *TodoReplace) replace(content string) (string, error) {
+	var sb strings.Builder
+	last := 0
+
+	for _, m := range r.pattern.FindAllStringSubmatchIndex(content, -1) {
+		tag, users := content[m[2]:m[3]], content[m[4]:m[5]]
+		if strings.TrimSpace(users) == "" {
+			continue
+		}
+
+		mapped, err := r.mapUsers(users)
+		if err != nil {
+			return "", err
+		}
+
+		sb.WriteString(content[last:m[0]])
+		sb.WriteString(tag)
+		if len(mapped) > 0 {
+			sb.WriteString("(" + strings.Join(mapped, ", ") + ")")
+		}
+		last = m[1]
+	}
+
+	if last == 0 {
+		return content, nil
+	}
+	sb.WriteString(content[last:])
+	return sb.String(), nil
+}
+
+// mapUsers returns the result of mapping a comma-separated list of users,
+// without duplicates.
+func (r *TodoReplace) mapUsers(users string) ([]string, error) {
+	var mapped []string
+	add := func(user string) {
+		if !slices.Contains(mapped, user) {
+			mapped = append(mapped, user)
+		}
+	}
+
+	for user := range strings.SplitSeq(users, ",") {
+		user = strings.TrimSpace(user)
+		if user == "" {
+			continue
+		}
+		if r.ignorePattern != nil && r.ignorePattern.MatchString(user) {
+			add(user)
+			continue
+		}
+
+		switch r.mode {
+		case TodoScrubNames:
+			continue
+		case TodoUseDefault:
+			add(r.defaultString)
+			continue
+		}
+
+		if to, ok := r.mapping[user]; ok {
+			add(to)
+			continue
+		}
+		switch r.mode {
+		case TodoMapOrFail:
+			return nil, fmt.Errorf("cannot find a mapping for user %q", user)
+		case TodoMapOrDefault:
+			add(r.defaultString)
+		default:
+			add(user)
+		}
+	}
+	return mapped, nil
+}
+
+// Reverse implements Transformation.
+//
+// The reverse maps the users back. It is only valid for the MAP_OR_FAIL and
+// MAP_OR_IGNORE modes with a mapping where no two users map to the same
+// user.
+func (r *TodoReplace) Reverse() transform.Transformation {
+	if r.mode != TodoMapOrFail && r.mode != TodoMapOrIgnore {
+		return transform.NewErrorTransformation(fmt.Errorf("core.todo_replace with mode %s is not reversible", r.mode), r)
+	}
+
+	inverse := make(map[string]string, len(r.mapping))
+	for _, user := range slices.Sorted(maps.Keys(r.mapping)) {
+		to := r.mapping[user]
+		if prev, ok := inverse[to]; ok {
+			return transform.NewErrorTransformation(fmt.Errorf(
+				"core.todo_replace is not reversible: %q and %q are both mapped to %q", prev, user, to), r)
+		}
+		inverse[to] = user
+	}
+
+	reverse := &TodoReplace{
+		tags:    r.tags,
+		mapping: inverse,
+		mode:    r.mode,
+		paths:   r.paths,
+		ignore:  r.ignore,
+	}
+	if err := reverse.compile(); err != nil {
+		return transform.NewErrorTransformation(fmt.Errorf("core.todo_replace is not reversible: %w", err), r)
+	}
+	return reverse
+}
+
+// Describe implements Transformation.
+func (r *TodoReplace) Describe() string {
+	return fmt.Sprintf("Replacing users in %s", strings.Join(r.tags, ", "))
+}
+
+// Tags returns the annotation tags that are rewritten.
+func (r *TodoReplace) Tags() []string {
+	return r.tags
+}
+
+// Mapping returns the user mapping.
+func (r *TodoReplace) Mapping() map[string]string {
+	return r.mapping
+}
+
+// Mode returns how unmapped users are handled.
+func (r *TodoReplace) Mode() TodoMode {
+	return r.mode
+}
+
+// Paths returns the glob filter.
+func (r *TodoReplace) Paths() *Glob {
+	return r.paths
+}
+
+// Default returns the user used by MAP_OR_DEFAULT and USE_DEFAULT.
+func (r *TodoReplace) Default() string {
+	return r.defaultString
+}
+
+// Ignore returns the regex of users that are never modified.
+func (r *TodoReplace) Ignore() string {
+	return r.ignore
+}
+
+// todoReplaceFn implements core.todo_replace().
+//
+// Parameters:
+//   - tags (optional): The annotation tags to rewrite (default: TODO, NOTE)
+//   - mapping (optional): A dict from user to the user it is replaced with
+//   - mode (optional): How unmapped users are handled: MAP_OR_IGNORE
+//     (default), MAP_OR_FAIL, MAP_OR_DEFAULT, SCRUB_NAMES or USE_DEFAULT
+//   - paths (optional): Glob or list of paths to apply the replacement to
+//   - default (optional): The user for MAP_OR_DEFAULT and USE_DEFAULT
+//   - ignore (optional): A regex of users that are never modified
+//
+// Reference: CoreModule.java todoReplace()
+func todoReplaceFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		tags          *starlark.List
+		mapping       *starlark.Dict
+		mode                         = "MAP_OR_IGNORE"
+		paths         starlark.Value = starlark.None
+		defaultString string
+		ignore        string
+	)
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+		"tags?", &tags,
+		"mapping?", &mapping,
+		"mode?", &mode,
+		"paths?", &paths,
+		"default?", &defaultString,
+		"ignore?", &ignore,
+	); err != nil {
+		return nil, err
+	}
+
+	todoMode, err := ParseTodoMode(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	todo := &TodoReplace{
+		tags:          DefaultTodoTags,
+		mode:          todoMode,
+		defaultString: defaultString,
+		ignore:        ignore,
+	}
+
+	if tags != nil {
+		todo.tags = make([]string, tags.Len())
+		for i := range tags.Len() {
+			s, ok := starlark.AsString(tags.Index(i))
+			if !ok {
+				return nil, fmt.Errorf("tags must be strings, got %s", tags.Index(i).Type())
+			}
+			todo.tags[i] = s
+		}
+	}
+
+	if mapping != nil {
+		todo.mapping = make(map[string]string, mapping.Len())
+		for _, item := range mapping.Items() {
+			from, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, fmt.Errorf("mapping keys must be strings, got %s", item[0].Type())
+			}
+			to, ok := starlark.AsString(item[1])
+			if !ok {
+				return nil, fmt.Errorf("mapping values must be strings, got %s", item[1].Type())
+			}
+			todo.mapping[from] = to
+		}
+	}
+
+	// Handle paths parameter
+	switch v := paths.(type) {
+	case starlark.NoneType:
+		todo.paths = AllFiles()
+	case *Glob:
+		todo.paths = v
+	case *starlark.List:
+		patterns := make([]string, v.Len())
+		for i := range v.Len() {
+			s, ok := starlark.AsString(v.Index(i))
+			if !ok {
+				return nil, fmt.Errorf("paths must be strings, got %s", v.Index(i).Type())
+			}
+			patterns[i] = s
+		}
+		todo.paths, err = NewGlob(patterns, nil)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("paths must be a glob or list of strings, got %s", paths.Type())
+	}
+
+	if err := todo.compile(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	return todo, nil
+}
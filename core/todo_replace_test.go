@@ -0,0 +1,150 @@
+package core_test
+
+import (
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+
+	"github.com/albertocavalcante/starlark-go-copybara/core"
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+)
+
+func evalTodoReplace(t *testing.T, expr string) *core.TodoReplace {
+	t.Helper()
+
+	thread := &starlark.Thread{Name: "test"}
+	predeclared := starlark.StringDict{
+		"core": core.Module,
+	}
+
+	val, err := starlark.Eval(thread, "test.sky", expr, predeclared)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return val.(*core.TodoReplace)
+}
+
+func TestTodoReplaceModes(t *testing.T) {
+	const content = "// TODO(alice): fix\n// NOTE(bob, carol): see\n// TODO(bot-1, alice): x\n// FIXME(alice): y\n// TODO: none\n"
+
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{
+			name: "map or ignore",
+			expr: `core.todo_replace(mapping = {"alice": "ext-alice", "carol": "ext-carol"})`,
+			want: "// TODO(ext-alice): fix\n// NOTE(bob, ext-carol): see\n// TODO(bot-1, ext-alice): x\n// FIXME(alice): y\n// TODO: none\n",
+		},
+		{
+			name: "map or default",
+			expr: `core.todo_replace(mapping = {"alice": "ext-alice"}, mode = "MAP_OR_DEFAULT", default = "team")`,
+			want: "// TODO(ext-alice): fix\n// NOTE(team): see\n// TODO(team, ext-alice): x\n// FIXME(alice): y\n// TODO: none\n",
+		},
+		{
+			name: "scrub names",
+			expr: `core.todo_replace(mode = "SCRUB_NAMES", ignore = "bot-.*")`,
+			want: "// TODO: fix\n// NOTE: see\n// TODO(bot-1): x\n// FIXME(alice): y\n// TODO: none\n",
+		},
+		{
+			name: "use default",
+			expr: `core.todo_replace(mode = "USE_DEFAULT", default = "team")`,
+			want: "// TODO(team): fix\n// NOTE(team): see\n// TODO(team): x\n// FIXME(alice): y\n// TODO: none\n",
+		},
+		{
+			name: "tags",
+			expr: `core.todo_replace(tags = ["FIXME"], mapping = {"alice": "ext-alice"})`,
+			want: "// TODO(alice): fix\n// NOTE(bob, carol): see\n// TODO(bot-1, alice): x\n// FIXME(ext-alice): y\n// TODO: none\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := applyReplace(t, evalTodoReplace(t, tt.expr), content); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTodoReplaceMapOrFail(t *testing.T) {
+	todo := evalTodoReplace(t, `core.todo_replace(mapping = {"alice": "ext-alice"}, mode = "MAP_OR_FAIL", paths = ["src/**"])`)
+
+	dir := writeFiles(t, map[string]string{"src/a.go": "// TODO(alice, bob): fix\n", "b.go": "// TODO(dave)\n"})
+	err := todo.Apply(&transform.Context{WorkDir: dir})
+	if err == nil || !strings.Contains(err.Error(), `cannot find a mapping for user "bob"`) || !strings.Contains(err.Error(), "a.go") {
+		t.Errorf("expected a missing mapping error for src/a.go, got %v", err)
+	}
+	if got := readFile(t, dir, "src/a.go"); got != "// TODO(alice, bob): fix\n" {
+		t.Errorf("src/a.go should be unchanged, got %q", got)
+	}
+}
+
+func TestTodoReplaceReverse(t *testing.T) {
+	todo := evalTodoReplace(t, `core.todo_replace(mapping = {"alice": "ext-alice", "bob": "ext-bob"}, mode = "MAP_OR_FAIL")`)
+
+	reverse, ok := todo.Reverse().(*core.TodoReplace)
+	if !ok {
+		t.Fatalf("expected *core.TodoReplace, got %T", todo.Reverse())
+	}
+	if reverse.Mapping()["ext-alice"] != "alice" || reverse.Mode() != core.TodoMapOrFail {
+		t.Errorf("unexpected reverse: %s", reverse)
+	}
+
+	content := "// TODO(alice, bob): fix\n"
+	forward := applyReplace(t, todo, content)
+	if got := applyReplace(t, reverse, forward); got != content {
+		t.Errorf("round trip = %q, want %q", got, content)
+	}
+}
+
+func TestTodoReplaceNotReversible(t *testing.T) {
+	tests := []string{
+		`core.todo_replace(mapping = {"alice": "team", "bob": "team"})`,
+		`core.todo_replace(mode = "SCRUB_NAMES")`,
+		`core.todo_replace(mode = "MAP_OR_DEFAULT", default = "team")`,
+	}
+	for _, expr := range tests {
+		err := evalTodoReplace(t, expr).Reverse().Apply(&transform.Context{WorkDir: t.TempDir()})
+		if err == nil || !strings.Contains(err.Error(), "not reversible") {
+			t.Errorf("%s: expected not reversible error, got %v", expr, err)
+		}
+	}
+}
+
+func TestTodoReplaceErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{`core.todo_replace(mode = "MAP_OR_DEFAULT")`, "default is required"},
+		{`core.todo_replace(default = "team")`, "default is only used"},
+		{`core.todo_replace(mode = "SCRUB_NAMES", mapping = {"a": "b"})`, "mapping cannot be used"},
+		{`core.todo_replace(mode = "OTHER")`, "unknown todo_replace mode"},
+		{`core.todo_replace(tags = [])`, "tags must not be empty"},
+		{`core.todo_replace(ignore = "(")`, "invalid ignore regex"},
+	}
+
+	thread := &starlark.Thread{Name: "test"}
+	predeclared := starlark.StringDict{
+		"core": core.Module,
+	}
+
+	for _, tt := range tests {
+		_, err := starlark.Eval(thread, "test.sky", tt.expr, predeclared)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.expr, tt.wantErr, err)
+		}
+	}
+}
+
+func TestTodoReplaceString(t *testing.T) {
+	todo := evalTodoReplace(t, `core.todo_replace(tags = ["TODO"], mapping = {"b": "y", "a": "x"}, mode = "MAP_OR_FAIL")`)
+
+	want := `core.todo_replace(tags = ["TODO"], mapping = {"a": "x", "b": "y"}, mode = "MAP_OR_FAIL")`
+	if todo.String() != want {
+		t.Errorf("String() = %s, want %s", todo.String(), want)
+	}
+}
@@ -0,0 +1,528 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"go.starlark.net/starlark"
+
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+)
+
+// TransformWork is the ctx object passed to dynamic transformations. It
+// exposes the files in the work directory and the change metadata of a
+// transform.Context to Starlark.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/TransformWork.java
+type TransformWork struct {
+	ctx     *transform.Context
+	params  *starlark.Dict
+	console *Console
+}
+
+// newTransformWork creates the ctx object for a dynamic transformation.
+func newTransformWork(ctx *transform.Context, params *starlark.Dict) *TransformWork {
+	w := ctx.Console
+	if w == nil {
+		w = io.Discard
+	}
+	return &TransformWork{ctx: ctx, params: params, console: &Console{w: w}}
+}
+
+// String implements starlark.Value.
+func (t *TransformWork) String() string {
+	return "TransformWork"
+}
+
+// Type implements starlark.Value.
+func (t *TransformWork) Type() string {
+	return "TransformWork"
+}
+
+// Freeze implements starlark.Value.
+func (t *TransformWork) Freeze() {}
+
+// Truth implements starlark.Value.
+func (t *TransformWork) Truth() starlark.Bool {
+	return starlark.True
+}
+
+// Hash implements starlark.Value.
+func (t *TransformWork) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: TransformWork")
+}
+
+// Attr implements starlark.HasAttrs.
+func (t *TransformWork) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "params":
+		return t.params, nil
+	case "message":
+		return starlark.String(t.ctx.Message), nil
+	case "author":
+		return starlark.String(t.ctx.Author), nil
+	case "console":
+		return t.console, nil
+	case "run":
+		return t.method(name, t.run), nil
+	case "list":
+		return t.method(name, t.list), nil
+	case "new_path":
+		return t.method(name, t.newPath), nil
+	case "read_path":
+		return t.method(name, t.readPath), nil
+	case "write_path":
+		return t.method(name, t.writePath), nil
+	case "set_message":
+		return t.method(name, t.setMessage), nil
+	case "add_label":
+		return t.method(name, t.addLabel), nil
+	case "find_label":
+		return t.method(name, t.findLabel), nil
+	case "remove_label":
+		return t.method(name, t.removeLabel), nil
+	case "noop":
+		return t.method(name, t.noop), nil
+	case "success":
+		return t.method(name, t.success), nil
+	default:
+		return nil, nil
+	}
+}
+
+// AttrNames implements starlark.HasAttrs.
+func (t *TransformWork) AttrNames() []string {
+	return []string{
+		"add_label",
+		"author",
+		"console",
+		"find_label",
+		"list",
+		"message",
+		"new_path",
+		"noop",
+		"params",
+		"read_path",
+		"remove_label",
+		"run",
+		"set_message",
+		"success",
+		"write_path",
+	}
+}
+
+// method returns a builtin bound to the ctx object.
+func (t *TransformWork) method(name string, fn func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error)) *starlark.Builtin {
+	return starlark.NewBuiltin("ctx."+name, fn).BindReceiver(t)
+}
+
+// run implements ctx.run(). Given a glob it returns the matching paths;
+// given a transformation it applies it and returns its status.
+func (t *TransformWork) run(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var runnable starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &runnable); err != nil {
+		return nil, err
+	}
+
+	switch v := runnable.(type) {
+	case *Glob:
+		return t.paths(v)
+	case Transformation:
+		err := v.Apply(t.ctx)
+		var noop *transform.NoopError
+		if errors.As(err, &noop) {
+			return &TransformationStatus{noop: true, message: noop.Reason}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+		}
+		return &TransformationStatus{}, nil
+	default:
+		return nil, fmt.Errorf("%s: expected a glob or a transformation, got %s", fn.Name(), runnable.Type())
+	}
+}
+
+// list implements ctx.list().
+func (t *TransformWork) list(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var paths *Glob
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &paths); err != nil {
+		return nil, err
+	}
+	return t.paths(paths)
+}
+
+// paths returns the regular files of the work directory matching glob, in
+// lexical order.
+func (t *TransformWork) paths(glob *Glob) (*starlark.List, error) {
+	var paths []starlark.Value
+	err := filepath.WalkDir(t.ctx.WorkDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(t.ctx.WorkDir, p)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if glob.Matches(relPath) {
+			paths = append(paths, &CheckoutPath{path: relPath})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return starlark.NewList(paths), nil
+}
+
+// newPath implements ctx.new_path().
+func (t *TransformWork) newPath(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var p string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &p); err != nil {
+		return nil, err
+	}
+	return newCheckoutPath(p)
+}
+
+// readPath implements ctx.read_path().
+func (t *TransformWork) readPath(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var p starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &p); err != nil {
+		return nil, err
+	}
+	name, err := t.file(p)
+	if err != nil {
+		return nil, err
+	}
+	root, err := os.OpenRoot(t.ctx.WorkDir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = root.Close() }()
+
+	f, err := root.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %q: %w", p, err)
+	}
+	defer func() { _ = f.Close() }()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %q: %w", p, err)
+	}
+	return starlark.String(content), nil
+}
+
+// writePath implements ctx.write_path(). Missing parent directories are
+// created and the mode of an existing file is kept.
+func (t *TransformWork) writePath(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		p       starlark.Value
+		content string
+	)
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &p, &content); err != nil {
+		return nil, err
+	}
+	name, err := t.file(p)
+	if err != nil {
+		return nil, err
+	}
+	root, err := os.OpenRoot(t.ctx.WorkDir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = root.Close() }()
+
+	mode := os.FileMode(0o644)
+	if info, err := root.Lstat(name); err == nil {
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("cannot write %q: not a regular file", p)
+		}
+		mode = info.Mode().Perm()
+	}
+	if err := mkdirAll(root, filepath.Dir(name)); err != nil {
+		return nil, fmt.Errorf("failed to write file %q: %w", p, err)
+	}
+	f, err := root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write file %q: %w", p, err)
+	}
+	if _, err := io.WriteString(f, content); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to write file %q: %w", p, err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write file %q: %w", p, err)
+	}
+	return starlark.None, nil
+}
+
+// mkdirAll creates dir and its missing parents inside root.
+func mkdirAll(root *os.Root, dir string) error {
+	if dir == "." {
+		return nil
+	}
+	if err := mkdirAll(root, filepath.Dir(dir)); err != nil {
+		return err
+	}
+	if err := root.Mkdir(dir, 0o755); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+// file returns the name relative to the work directory of a path given as
+// a string or a CheckoutPath. Files must be accessed through an os.Root of
+// the work directory, so that symbolic links cannot escape it.
+func (t *TransformWork) file(v starlark.Value) (string, error) {
+	var p *CheckoutPath
+	switch v := v.(type) {
+	case *CheckoutPath:
+		p = v
+	case starlark.String:
+		var err error
+		if p, err = newCheckoutPath(string(v)); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("expected a path or a string, got %s", v.Type())
+	}
+	return filepath.FromSlash(p.path), nil
+}
+
+// setMessage implements ctx.set_message().
+func (t *TransformWork) setMessage(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var message string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &message); err != nil {
+		return nil, err
+	}
+	t.ctx.Message = message
+	t.ctx.Labels = transform.ParseLabels(message)
+	return starlark.None, nil
+}
+
+// addLabel implements ctx.add_label().
+func (t *TransformWork) addLabel(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		label     string
+		value     string
+		separator = "="
+	)
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+		"label", &label,
+		"value", &value,
+		"separator?", &separator,
+	); err != nil {
+		return nil, err
+	}
+	if t.ctx.Labels == nil {
+		t.ctx.Labels = make(map[string][]string)
+	}
+	t.ctx.AddLabel(label, value, separator)
+	return starlark.None, nil
+}
+
+// findLabel implements ctx.find_label(). It returns None when the label
+// is not found.
+func (t *TransformWork) findLabel(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var label string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &label); err != nil {
+		return nil, err
+	}
+	if value := t.ctx.GetLabel(label); value != "" {
+		return starlark.String(value), nil
+	}
+	return starlark.None, nil
+}
+
+// removeLabel implements ctx.remove_label().
+func (t *TransformWork) removeLabel(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var label string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &label); err != nil {
+		return nil, err
+	}
+	t.ctx.RemoveLabel(label)
+	return starlark.None, nil
+}
+
+// noop implements ctx.noop().
+func (t *TransformWork) noop(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var message string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &message); err != nil {
+		return nil, err
+	}
+	return &TransformationStatus{noop: true, message: message}, nil
+}
+
+// success implements ctx.success().
+func (t *TransformWork) success(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	return &TransformationStatus{}, nil
+}
+
+// CheckoutPath is a path relative to the work directory, as returned by
+// ctx.new_path() and ctx.list().
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/CheckoutPath.java
+type CheckoutPath struct {
+	path string
+}
+
+// newCheckoutPath validates p and returns it as a CheckoutPath. The path
+// must be relative and must not escape the work directory.
+func newCheckoutPath(p string) (*CheckoutPath, error) {
+	if p == "" {
+		return &CheckoutPath{}, nil
+	}
+	if !filepath.IsLocal(filepath.FromSlash(p)) {
+		return nil, fmt.Errorf("path %q must be relative to the work directory", p)
+	}
+	return &CheckoutPath{path: path.Clean(p)}, nil
+}
+
+// Path returns the slash-separated path relative to the work directory.
+func (p *CheckoutPath) Path() string {
+	return p.path
+}
+
+// String implements starlark.Value.
+func (p *CheckoutPath) String() string {
+	return p.path
+}
+
+// Type implements starlark.Value.
+func (p *CheckoutPath) Type() string {
+	return "Path"
+}
+
+// Freeze implements starlark.Value.
+func (p *CheckoutPath) Freeze() {}
+
+// Truth implements starlark.Value.
+func (p *CheckoutPath) Truth() starlark.Bool {
+	return starlark.True
+}
+
+// Hash implements starlark.Value.
+func (p *CheckoutPath) Hash() (uint32, error) {
+	return starlark.String(p.path).Hash()
+}
+
+// Attr implements starlark.HasAttrs.
+func (p *CheckoutPath) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "path":
+		return starlark.String(p.path), nil
+	case "name":
+		return starlark.String(path.Base(p.path)), nil
+	case "parent":
+		if p.path == "" {
+			return starlark.None, nil
+		}
+		parent := path.Dir(p.path)
+		if parent == "." {
+			parent = ""
+		}
+		return &CheckoutPath{path: parent}, nil
+	case "resolve":
+		return starlark.NewBuiltin("Path.resolve", p.resolve).BindReceiver(p), nil
+	case "resolve_sibling":
+		return starlark.NewBuiltin("Path.resolve_sibling", p.resolveSibling).BindReceiver(p), nil
+	default:
+		return nil, nil
+	}
+}
+
+// AttrNames implements starlark.HasAttrs.
+func (p *CheckoutPath) AttrNames() []string {
+	return []string{"name", "parent", "path", "resolve", "resolve_sibling"}
+}
+
+// resolve implements Path.resolve(). It returns the child path p/other.
+func (p *CheckoutPath) resolve(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var other string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &other); err != nil {
+		return nil, err
+	}
+	return newCheckoutPath(path.Join(p.path, other))
+}
+
+// resolveSibling implements Path.resolve_sibling(). It returns the path
+// other in the directory of p.
+func (p *CheckoutPath) resolveSibling(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var other string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &other); err != nil {
+		return nil, err
+	}
+	return newCheckoutPath(path.Join(path.Dir(p.path), other))
+}
+
+// Console is the ctx.console object used by dynamic transformations to
+// report messages.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/util/console/Console.java
+type Console struct {
+	w io.Writer
+}
+
+// String implements starlark.Value.
+func (c *Console) String() string {
+	return "console"
+}
+
+// Type implements starlark.Value.
+func (c *Console) Type() string {
+	return "console"
+}
+
+// Freeze implements starlark.Value.
+func (c *Console) Freeze() {}
+
+// Truth implements starlark.Value.
+func (c *Console) Truth() starlark.Bool {
+	return starlark.True
+}
+
+// Hash implements starlark.Value.
+func (c *Console) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: console")
+}
+
+// consoleLevels maps the console methods to the prefix of their messages.
+var consoleLevels = map[string]string{
+	"error":    "ERROR",
+	"info":     "INFO",
+	"progress": "TASK",
+	"verbose":  "VERBOSE",
+	"warn":     "WARN",
+}
+
+// Attr implements starlark.HasAttrs.
+func (c *Console) Attr(name string) (starlark.Value, error) {
+	level, ok := consoleLevels[name]
+	if !ok {
+		return nil, nil
+	}
+	return starlark.NewBuiltin("console."+name, func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var message string
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &message); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(c.w, "%s: %s\n", level, message)
+		return starlark.None, nil
+	}), nil
+}
+
+// AttrNames implements starlark.HasAttrs.
+func (c *Console) AttrNames() []string {
+	return []string{"error", "info", "progress", "verbose", "warn"}
+}
@@ -79,6 +79,7 @@ func (v *VerifyMatch) Apply(ctx *transform.Context) error {
 	}
 
 	var errors []string
+	checked := 0
 
 	// Walk the workdir and check files matching the glob
 	err := filepath.WalkDir(ctx.WorkDir, func(path string, d fs.DirEntry, err error) error {
@@ -115,6 +116,7 @@ func (v *VerifyMatch) Apply(ctx *transform.Context) error {
 		if err != nil {
 			return fmt.Errorf("failed to read file %q: %w", relPath, err)
 		}
+		checked++
 
 		// Check regex match
 		matches := v.regex.FindIndex(content)
@@ -153,6 +155,10 @@ func (v *VerifyMatch) Apply(ctx *transform.Context) error {
 		}
 	}
 
+	if checked == 0 {
+		return &transform.NoopError{Reason: fmt.Sprintf("no file matched %s", v.paths)}
+	}
+
 	return nil
 }
 
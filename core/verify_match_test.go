@@ -1,6 +1,7 @@
 package core_test
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -236,14 +237,14 @@ func TestVerifyMatchWithPaths(t *testing.T) {
 		t.Error("expected error because TODO exists in .txt file")
 	}
 
-	// Only check .md files (don't exist) - should pass
+	// Only check .md files (don't exist) - should be a no-op
 	val, _ = starlark.Eval(thread, "test.sky",
 		`core.verify_match(regex = "TODO", verify_no_match = True, paths = ["*.md"])`,
 		predeclared)
 
 	vm = val.(*core.VerifyMatch)
-	if err := vm.Apply(ctx); err != nil {
-		t.Errorf("unexpected error: %v", err)
+	if err := vm.Apply(ctx); !errors.Is(err, transform.ErrNoop) {
+		t.Errorf("expected a no-op error, got %v", err)
 	}
 }
 
@@ -2,6 +2,7 @@ package core
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 
 	"go.starlark.net/starlark"
@@ -23,6 +24,8 @@ type Workflow struct {
 	destinationFiles *Glob
 	mode             WorkflowMode
 	reversibleCheck  bool
+	customRevID      string
+	noopBehavior     NoopBehavior
 }
 
 // WorkflowMode defines how the workflow processes changes.
@@ -147,6 +150,21 @@ func (w *Workflow) ReversibleCheck() bool {
 	return w.reversibleCheck
 }
 
+// CustomRevID returns the label name used to record the origin revision in
+// the destination, or "" to use the origin's default label.
+func (w *Workflow) CustomRevID() string {
+	return w.customRevID
+}
+
+// NoopBehavior returns how no-op transformations are handled. A no-op
+// workflow migrates nothing.
+func (w *Workflow) NoopBehavior() NoopBehavior {
+	return w.noopBehavior
+}
+
+// revIDPattern matches valid custom_rev_id label names.
+var revIDPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
 // workflowFn implements core.workflow().
 //
 // Reference: Workflow.java
@@ -161,6 +179,9 @@ func workflowFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tup
 		destinationFiles starlark.Value = starlark.None
 		mode                            = "SQUASH"
 		reversibleCheck  starlark.Value = starlark.None
+		customRevID      string
+		ignoreNoop       bool
+		noopBehavior     string
 	)
 
 	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
@@ -173,6 +194,9 @@ func workflowFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tup
 		"destination_files?", &destinationFiles,
 		"mode?", &mode,
 		"reversible_check?", &reversibleCheck,
+		"custom_rev_id?", &customRevID,
+		"ignore_noop?", &ignoreNoop,
+		"noop_behavior?", &noopBehavior,
 	); err != nil {
 		return nil, err
 	}
@@ -214,22 +238,53 @@ func workflowFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tup
 		return nil, fmt.Errorf("reversible_check must be a bool, got %s", reversibleCheck.Type())
 	}
 
+	// Handle custom_rev_id
+	if customRevID != "" && !revIDPattern.MatchString(customRevID) {
+		return nil, fmt.Errorf("custom_rev_id: invalid label name %q", customRevID)
+	}
+	wf.customRevID = customRevID
+
+	// Handle ignore_noop and noop_behavior
+	wf.noopBehavior, err = noopBehaviorArg(ignoreNoop, noopBehavior, NoopFail)
+	if err != nil {
+		return nil, err
+	}
+
 	// Handle transformations
 	if transformations != nil {
-		wf.transformations = make([]Transformation, transformations.Len())
-		for i := range transformations.Len() {
-			item := transformations.Index(i)
-			t, ok := item.(Transformation)
-			if !ok {
-				return nil, fmt.Errorf("transformations[%d] must be a transformation, got %s", i, item.Type())
-			}
-			wf.transformations[i] = t
+		var err error
+		wf.transformations, err = toTransformations(transformations)
+		if err != nil {
+			return nil, err
 		}
 	}
 
+	registerWorkflow(thread, wf)
+
 	return wf, nil
 }
 
+// workflowsKey is the thread-local key under which core.workflow records
+// the workflows it creates.
+const workflowsKey = "copybara.workflows"
+
+// registerWorkflow records a workflow on the thread so that it can be
+// found even when the config does not assign it to a global.
+func registerWorkflow(thread *starlark.Thread, wf *Workflow) {
+	if thread == nil {
+		return
+	}
+	workflows, _ := thread.Local(workflowsKey).([]*Workflow)
+	thread.SetLocal(workflowsKey, append(workflows, wf))
+}
+
+// RegisteredWorkflows returns the workflows created by core.workflow on the
+// given thread, in definition order.
+func RegisteredWorkflows(thread *starlark.Thread) []*Workflow {
+	workflows, _ := thread.Local(workflowsKey).([]*Workflow)
+	return workflows
+}
+
 // wrapGlob converts a starlark value to a Glob.
 func wrapGlob(v starlark.Value) (*Glob, error) {
 	switch val := v.(type) {
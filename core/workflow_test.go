@@ -54,6 +54,16 @@ func TestWorkflowCreation(t *testing.T) {
 			code:    `core.workflow(name = "default", reversible_check = True)`,
 			wantErr: false,
 		},
+		{
+			name:    "workflow with custom_rev_id",
+			code:    `core.workflow(name = "default", custom_rev_id = "Internal-RevId")`,
+			wantErr: false,
+		},
+		{
+			name:    "workflow with invalid custom_rev_id",
+			code:    `core.workflow(name = "default", custom_rev_id = "not a label")`,
+			wantErr: true,
+		},
 		{
 			name:    "workflow with transformations",
 			code:    `core.workflow(name = "default", transformations = [core.move("src", "lib")])`,
@@ -175,6 +185,47 @@ func TestWorkflowReversibleCheckDefault(t *testing.T) {
 	}
 }
 
+func TestWorkflowNoopBehavior(t *testing.T) {
+	thread := &starlark.Thread{Name: "test"}
+	predeclared := starlark.StringDict{
+		"core": core.Module,
+	}
+
+	tests := []struct {
+		name     string
+		args     string
+		expected core.NoopBehavior
+		wantErr  bool
+	}{
+		{"default", ``, core.NoopFail, false},
+		{"ignore_noop", `, ignore_noop = True`, core.NoopIgnore, false},
+		{"noop_behavior", `, noop_behavior = "NOOP_IF_ALL_NOOP"`, core.NoopIfAllNoop, false},
+		{"both", `, ignore_noop = True, noop_behavior = "IGNORE_NOOP"`, 0, true},
+		{"invalid", `, noop_behavior = "INVALID"`, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := `core.workflow(name = "test"` + tt.args + `)`
+			val, err := starlark.Eval(thread, "test.sky", code, predeclared)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			wf := val.(*core.Workflow)
+			if wf.NoopBehavior() != tt.expected {
+				t.Errorf("NoopBehavior() = %v, want %v", wf.NoopBehavior(), tt.expected)
+			}
+		})
+	}
+}
+
 func TestWorkflowOriginFiles(t *testing.T) {
 	thread := &starlark.Thread{Name: "test"}
 	predeclared := starlark.StringDict{
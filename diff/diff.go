@@ -0,0 +1,288 @@
+// Package diff computes line-based unified diffs.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around each change.
+const contextLines = 3
+
+// maxCost bounds the number of search steps when looking for the middle
+// snake of an edit graph. Past it, the graph is split at the furthest point
+// reached instead, which keeps the diff of large, heavily rewritten files
+// fast at the cost of a possibly longer edit script.
+const maxCost = 1 << 10
+
+// editKind is the kind of a single line edit.
+type editKind int
+
+const (
+	editEqual editKind = iota
+	editDelete
+	editInsert
+)
+
+// edit is a single line in an edit script.
+type edit struct {
+	kind editKind
+	line string
+}
+
+// Unified returns a unified diff between a and b, labelling the sides with
+// oldName and newName. It returns an empty string when a and b are equal.
+func Unified(oldName, newName, a, b string) string {
+	if a == b {
+		return ""
+	}
+
+	edits := editScript(SplitLines(a), SplitLines(b))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	// Line positions (0-based) in a and b before each edit
+	aPos := make([]int, len(edits)+1)
+	bPos := make([]int, len(edits)+1)
+	for i, e := range edits {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if e.kind != editInsert {
+			aPos[i+1]++
+		}
+		if e.kind != editDelete {
+			bPos[i+1]++
+		}
+	}
+
+	for i := 0; i < len(edits); {
+		// Find the next change
+		for i < len(edits) && edits[i].kind == editEqual {
+			i++
+		}
+		if i == len(edits) {
+			break
+		}
+
+		start := max(0, i-contextLines)
+		end := i
+		for end < len(edits) {
+			if edits[end].kind != editEqual {
+				end++
+				continue
+			}
+			// Extend through equal lines only if another change follows closely
+			next := end
+			for next < len(edits) && edits[next].kind == editEqual {
+				next++
+			}
+			if next < len(edits) && next-end <= 2*contextLines {
+				end = next
+				continue
+			}
+			end = min(next, end+contextLines)
+			break
+		}
+
+		writeHunk(&sb, edits[start:end], aPos[start], bPos[start], aPos[end]-aPos[start], bPos[end]-bPos[start])
+		i = end
+	}
+
+	return sb.String()
+}
+
+// writeHunk writes a single hunk with its header.
+func writeHunk(sb *strings.Builder, edits []edit, aStart, bStart, aCount, bCount int) {
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+	for _, e := range edits {
+		switch e.kind {
+		case editEqual:
+			sb.WriteByte(' ')
+		case editDelete:
+			sb.WriteByte('-')
+		case editInsert:
+			sb.WriteByte('+')
+		}
+		sb.WriteString(e.line)
+		if !strings.HasSuffix(e.line, "\n") {
+			sb.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats a hunk range. start is the 0-based line position.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// SplitLines splits s into lines, keeping the trailing newline of each line.
+func SplitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// editScript computes the shortest edit script from a to b using the
+// linear-space variant of the Myers diff algorithm: the middle snake of
+// the edit graph splits the problem in two halves, which are solved
+// recursively. Memory use is O(len(a)+len(b)).
+func editScript(a, b []string) []edit {
+	edits := make([]edit, 0, len(a)+len(b))
+	return appendEdits(edits, a, b)
+}
+
+// appendEdits appends the edit script from a to b to edits.
+func appendEdits(edits []edit, a, b []string) []edit {
+	// Common prefix and suffix
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for _, line := range a[:prefix] {
+		edits = append(edits, edit{kind: editEqual, line: line})
+	}
+	a, b = a[prefix:], b[prefix:]
+
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	x, y := -1, -1
+	if len(a) > 0 && len(b) > 0 {
+		x, y = middleSnake(a, b)
+	}
+	if x < 0 {
+		// One side is empty, or there is no point to split at
+		for _, line := range a {
+			edits = append(edits, edit{kind: editDelete, line: line})
+		}
+		for _, line := range b {
+			edits = append(edits, edit{kind: editInsert, line: line})
+		}
+	} else {
+		edits = appendEdits(edits, a[:x], b[:y])
+		edits = appendEdits(edits, a[x:], b[y:])
+	}
+
+	for _, line := range common {
+		edits = append(edits, edit{kind: editEqual, line: line})
+	}
+	return edits
+}
+
+// middleSnake runs the Myers search forward from the start and backward
+// from the end of the edit graph until the paths overlap, and returns the
+// point (x, y) where they meet. Both a and b must be non-empty and differ
+// in their first and last lines. If the paths do not meet within maxCost
+// steps, it returns the furthest point reached by either of them. It
+// returns -1, -1 if no split point is found.
+func middleSnake(a, b []string) (int, int) {
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	forward := make([]int, 2*offset+1)
+	backward := make([]int, 2*offset+1)
+	for i := range forward {
+		forward[i] = -1
+		backward[i] = -1
+	}
+	forward[offset+1] = 0
+	backward[offset+1] = 0
+
+	delta := n - m
+	// With an odd delta the paths meet during a forward step
+	odd := delta%2 != 0
+
+	// Diagonals known to run off the graph are skipped
+	var fStart, fEnd, bStart, bEnd int
+
+	// Furthest point reached by either path, used when the search is cut
+	// short. progress is the number of lines the path has consumed.
+	bestX, bestY, best := -1, -1, 0
+	record := func(x, y, progress int) {
+		if progress > best && x+y > 0 && x+y < n+m {
+			bestX, bestY, best = x, y, progress
+		}
+	}
+
+	for d := range min(maxD, maxCost) {
+		for k := -d + fStart; k <= d-fEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			if x <= n && y <= m {
+				record(x, y, x+y)
+			}
+
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case odd:
+				bk := offset + delta - k
+				if bk >= 0 && bk < len(backward) && backward[bk] != -1 && x >= n-backward[bk] {
+					return x, y
+				}
+			}
+		}
+
+		for k := -d + bStart; k <= d-bEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			if x <= n && y <= m {
+				record(n-x, m-y, x+y)
+			}
+
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !odd:
+				fk := offset + delta - k
+				if fk >= 0 && fk < len(forward) && forward[fk] != -1 {
+					fx := forward[fk]
+					fy := fx - (fk - offset)
+					if fx >= n-x {
+						return fx, fy
+					}
+				}
+			}
+		}
+	}
+	return bestX, bestY
+}
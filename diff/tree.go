@@ -0,0 +1,102 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/albertocavalcante/starlark-go-copybara/vcs"
+)
+
+// FileDiff describes how a file differs between two directory snapshots.
+type FileDiff struct {
+	// Path is the slash-separated path relative to the snapshot root.
+	Path string
+
+	// Op is the kind of change.
+	Op vcs.FileOp
+
+	// Diff is the unified diff of the change.
+	Diff string
+}
+
+// Snapshot reads every file under root, keyed by slash-separated relative path.
+func Snapshot(root string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		content, err := os.ReadFile(path) //nolint:gosec // path is from WalkDir under root
+		if err != nil {
+			return fmt.Errorf("failed to read file %q: %w", relPath, err)
+		}
+		files[filepath.ToSlash(relPath)] = content
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", root, err)
+	}
+	return files, nil
+}
+
+// Compare returns the differences between two snapshots, sorted by path.
+// Old files are labelled a/<path> and new files b/<path>.
+func Compare(before, after map[string][]byte) []FileDiff {
+	var diffs []FileDiff
+
+	for path, newContent := range after {
+		oldContent, ok := before[path]
+		switch {
+		case !ok:
+			diffs = append(diffs, FileDiff{
+				Path: path,
+				Op:   vcs.FileAdded,
+				Diff: fileDiff(nil, newContent, "/dev/null", "b/"+path),
+			})
+		case !bytes.Equal(oldContent, newContent):
+			diffs = append(diffs, FileDiff{
+				Path: path,
+				Op:   vcs.FileModified,
+				Diff: fileDiff(oldContent, newContent, "a/"+path, "b/"+path),
+			})
+		}
+	}
+
+	for path, oldContent := range before {
+		if _, ok := after[path]; !ok {
+			diffs = append(diffs, FileDiff{
+				Path: path,
+				Op:   vcs.FileDeleted,
+				Diff: fileDiff(oldContent, nil, "a/"+path, "/dev/null"),
+			})
+		}
+	}
+
+	slices.SortFunc(diffs, func(a, b FileDiff) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return diffs
+}
+
+// fileDiff returns the diff between two file contents, or a short note
+// for binary files.
+func fileDiff(a, b []byte, oldName, newName string) string {
+	if bytes.IndexByte(a, 0) != -1 || bytes.IndexByte(b, 0) != -1 {
+		return fmt.Sprintf("Binary files %s and %s differ\n", oldName, newName)
+	}
+	return Unified(oldName, newName, string(a), string(b))
+}
@@ -0,0 +1,60 @@
+package diff_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/albertocavalcante/starlark-go-copybara/diff"
+	"github.com/albertocavalcante/starlark-go-copybara/vcs"
+)
+
+func TestSnapshot(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "dir", "a.txt"), []byte("a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := diff.Snapshot(root)
+	if err != nil {
+		t.Fatalf("Snapshot() error: %v", err)
+	}
+	if len(files) != 1 || string(files["dir/a.txt"]) != "a\n" {
+		t.Errorf("Snapshot() = %v", files)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	before := map[string][]byte{
+		"same.txt":    []byte("same\n"),
+		"changed.txt": []byte("old\n"),
+		"deleted.txt": []byte("gone\n"),
+		"binary.bin":  {0, 1},
+	}
+	after := map[string][]byte{
+		"same.txt":    []byte("same\n"),
+		"changed.txt": []byte("new\n"),
+		"added.txt":   []byte("added\n"),
+		"binary.bin":  {0, 2},
+	}
+
+	got := diff.Compare(before, after)
+	want := []diff.FileDiff{
+		{Path: "added.txt", Op: vcs.FileAdded, Diff: "--- /dev/null\n+++ b/added.txt\n@@ -0,0 +1 @@\n+added\n"},
+		{Path: "binary.bin", Op: vcs.FileModified, Diff: "Binary files a/binary.bin and b/binary.bin differ\n"},
+		{Path: "changed.txt", Op: vcs.FileModified, Diff: "--- a/changed.txt\n+++ b/changed.txt\n@@ -1 +1 @@\n-old\n+new\n"},
+		{Path: "deleted.txt", Op: vcs.FileDeleted, Diff: "--- a/deleted.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-gone\n"},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Compare() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Compare()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -2,8 +2,6 @@
 package eval
 
 import (
-	"fmt"
-
 	"go.starlark.net/starlark"
 )
 
@@ -11,6 +9,7 @@ import (
 type Evaluator struct {
 	predeclared starlark.StringDict
 	modules     map[string]starlark.StringDict
+	root        string
 }
 
 // New creates a new evaluator.
@@ -26,21 +25,41 @@ func (e *Evaluator) AddPredeclared(name string, value starlark.Value) {
 	e.predeclared[name] = value
 }
 
+// AddModule registers an in-memory module that load() resolves by name
+// before looking at the file system.
+func (e *Evaluator) AddModule(name string, globals starlark.StringDict) {
+	e.modules[name] = globals
+}
+
+// SetConfigRoot sets the directory that "//" labels are resolved against.
+// When unset, the directory of the evaluated file is used.
+func (e *Evaluator) SetConfigRoot(root string) {
+	e.root = root
+}
+
 // Eval evaluates a Starlark file.
 func (e *Evaluator) Eval(filename string, src any) (starlark.StringDict, error) {
+	root := e.root
+	if root == "" {
+		root = DefaultRoot(filename)
+	}
+	loader := NewLoader(root, e.predeclared)
+
 	thread := &starlark.Thread{
 		Name: "copybara",
-		Load: e.load,
+		Load: func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+			return e.load(thread, loader, module)
+		},
 	}
 
 	return starlark.ExecFile(thread, filename, src, e.predeclared)
 }
 
 // load implements module loading.
-func (e *Evaluator) load(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+func (e *Evaluator) load(thread *starlark.Thread, loader *Loader, module string) (starlark.StringDict, error) {
 	if m, ok := e.modules[module]; ok {
 		return m, nil
 	}
 
-	return nil, fmt.Errorf("cannot load %s: module not found", module)
+	return loader.Load(thread, module)
 }
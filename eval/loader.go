@@ -0,0 +1,166 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+// ErrLoadCycle is returned when load() statements form a cycle.
+var ErrLoadCycle = errors.New("cycle in load graph")
+
+// Loader resolves load() statements against the file system.
+//
+// Labels are resolved as follows:
+//   - "//path/to/file.bara.sky" and "//path/to:file.bara.sky" are relative
+//     to the config root
+//   - ":file.bara.sky", "file.bara.sky", "../file.bara.sky" and
+//     "../pkg:file.bara.sky" are relative to the directory of the file
+//     containing the load statement
+//
+// Each file is evaluated once and its globals are cached, so a module
+// loaded from several files is shared. Loaded files see the same
+// predeclared values as the main config and run on the loading thread.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/config/SkylarkParser.java
+type Loader struct {
+	root        string
+	predeclared starlark.StringDict
+	cache       map[string]*loadEntry
+
+	// stack is the chain of files currently being loaded, used to report cycles.
+	stack []string
+}
+
+// loadEntry is the cached result of loading a file.
+type loadEntry struct {
+	globals starlark.StringDict
+	err     error
+	loading bool
+}
+
+// NewLoader creates a loader that resolves root-relative labels against root.
+// An empty root disables root-relative labels.
+func NewLoader(root string, predeclared starlark.StringDict) *Loader {
+	if root != "" {
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+	}
+	return &Loader{
+		root:        root,
+		predeclared: predeclared,
+		cache:       make(map[string]*loadEntry),
+	}
+}
+
+// DefaultRoot returns the config root used when none is configured: the
+// directory of the evaluated config file.
+func DefaultRoot(filename string) string {
+	return filepath.Dir(filename)
+}
+
+// Root returns the config root.
+func (l *Loader) Root() string {
+	return l.root
+}
+
+// Load implements the starlark.Thread Load hook.
+func (l *Loader) Load(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+	from := ""
+	if thread.CallStackDepth() > 0 {
+		from = thread.CallFrame(0).Pos.Filename()
+	}
+
+	path, err := l.Resolve(module, from)
+	if err != nil {
+		return nil, err
+	}
+
+	if e, ok := l.cache[path]; ok {
+		if e.loading {
+			return nil, fmt.Errorf("%w: %s", ErrLoadCycle, l.cycle(path))
+		}
+		return e.globals, e.err
+	}
+
+	e := &loadEntry{loading: true}
+	l.cache[path] = e
+	l.stack = append(l.stack, path)
+
+	e.globals, e.err = l.exec(thread, path)
+
+	l.stack = l.stack[:len(l.stack)-1]
+	e.loading = false
+
+	return e.globals, e.err
+}
+
+// Resolve returns the absolute path of the file referenced by a load label.
+// from is the file containing the load statement; it is only used for
+// relative labels.
+func (l *Loader) Resolve(label, from string) (string, error) {
+	if label == "" {
+		return "", fmt.Errorf("empty load label")
+	}
+
+	var path string
+	if rest, ok := strings.CutPrefix(label, "//"); ok {
+		if l.root == "" {
+			return "", fmt.Errorf("no config root set to resolve %s", label)
+		}
+		rel := filepath.FromSlash(strings.Replace(rest, ":", "/", 1))
+		if !filepath.IsLocal(rel) {
+			return "", fmt.Errorf("label %s escapes the config root", label)
+		}
+		path = filepath.Join(l.root, rel)
+	} else {
+		dir := l.root
+		if from != "" {
+			dir = filepath.Dir(from)
+		}
+		rel := strings.TrimPrefix(label, ":")
+		path = filepath.Join(dir, filepath.FromSlash(strings.Replace(rel, ":", "/", 1)))
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", label, err)
+	}
+	return abs, nil
+}
+
+// exec evaluates a loaded file on the loading thread, so that values
+// registered on the thread (e.g. workflows) are visible to the caller.
+func (l *Loader) exec(thread *starlark.Thread, path string) (starlark.StringDict, error) {
+	src, err := os.ReadFile(path) //nolint:gosec // path is a resolved load label
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("file %s not found", path)
+		}
+		return nil, err
+	}
+	return starlark.ExecFile(thread, path, src, l.predeclared)
+}
+
+// cycle returns a description of the load cycle ending at path.
+func (l *Loader) cycle(path string) string {
+	start := 0
+	for i, p := range l.stack {
+		if p == path {
+			start = i
+			break
+		}
+	}
+	chain := append(l.stack[start:len(l.stack):len(l.stack)], path)
+	for i, p := range chain {
+		if rel, err := filepath.Rel(l.root, p); err == nil && filepath.IsLocal(rel) {
+			chain[i] = "//" + filepath.ToSlash(rel)
+		}
+	}
+	return strings.Join(chain, " -> ")
+}
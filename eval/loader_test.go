@@ -0,0 +1,152 @@
+package eval_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+
+	"github.com/albertocavalcante/starlark-go-copybara/eval"
+)
+
+// writeFiles creates the given files under dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for path, content := range files {
+		fullPath := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+}
+
+func TestEvaluatorLoad(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"common/values.bara.sky": `
+load(":names.bara.sky", "prefix")
+greeting = prefix + "world"
+`,
+		"common/names.bara.sky": `prefix = "hello, "`,
+		"project/copy.bara.sky": `
+load("//common/values.bara.sky", "greeting")
+load("../common:names.bara.sky", "prefix")
+result = greeting + "!"
+same = prefix
+`,
+	})
+
+	e := eval.New()
+	e.SetConfigRoot(root)
+
+	globals, err := e.Eval(filepath.Join(root, "project/copy.bara.sky"), nil)
+	if err != nil {
+		t.Fatalf("Eval() error: %v", err)
+	}
+	if got := globals["result"]; got != starlark.String("hello, world!") {
+		t.Errorf("result = %v, want %q", got, "hello, world!")
+	}
+}
+
+func TestEvaluatorLoadInMemoryModule(t *testing.T) {
+	e := eval.New()
+	e.AddModule("shared", starlark.StringDict{"x": starlark.MakeInt(1)})
+
+	globals, err := e.Eval("copy.bara.sky", `load("shared", "x")
+y = x + 1`)
+	if err != nil {
+		t.Fatalf("Eval() error: %v", err)
+	}
+	if got := globals["y"]; got != starlark.MakeInt(2) {
+		t.Errorf("y = %v, want 2", got)
+	}
+}
+
+func TestEvaluatorLoadMissingFile(t *testing.T) {
+	root := t.TempDir()
+
+	e := eval.New()
+	_, err := e.Eval(filepath.Join(root, "copy.bara.sky"), `load("//missing.bara.sky", "x")`)
+	if err == nil || !strings.Contains(err.Error(), "missing.bara.sky not found") {
+		t.Errorf("expected file not found error, got %v", err)
+	}
+}
+
+func TestLoaderCycle(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.bara.sky": `load("//b.bara.sky", "b")
+a = 1`,
+		"b.bara.sky": `load("//a.bara.sky", "a")
+b = 2`,
+	})
+
+	e := eval.New()
+	_, err := e.Eval(filepath.Join(root, "copy.bara.sky"), `load("//a.bara.sky", "a")`)
+	if !errors.Is(err, eval.ErrLoadCycle) {
+		t.Fatalf("expected ErrLoadCycle, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "//a.bara.sky -> //b.bara.sky -> //a.bara.sky") {
+		t.Errorf("error should describe the cycle, got %v", err)
+	}
+}
+
+func TestLoaderCachesModules(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"shared.bara.sky": `items = []`,
+		"one.bara.sky":    `load("//shared.bara.sky", "items")`,
+	})
+
+	loader := eval.NewLoader(root, nil)
+	thread := &starlark.Thread{Name: "test", Load: loader.Load}
+
+	first, err := loader.Load(thread, "//shared.bara.sky")
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	second, err := loader.Load(thread, "shared.bara.sky")
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if first["items"] != second["items"] {
+		t.Error("expected the same module to be returned from the cache")
+	}
+}
+
+func TestLoaderResolve(t *testing.T) {
+	loader := eval.NewLoader("/config", nil)
+
+	tests := []struct {
+		label   string
+		from    string
+		want    string
+		wantErr bool
+	}{
+		{label: "//a/b.bara.sky", want: "/config/a/b.bara.sky"},
+		{label: "//a:b.bara.sky", want: "/config/a/b.bara.sky"},
+		{label: ":b.bara.sky", from: "/config/x/copy.bara.sky", want: "/config/x/b.bara.sky"},
+		{label: "b.bara.sky", from: "/config/x/copy.bara.sky", want: "/config/x/b.bara.sky"},
+		{label: "../b.bara.sky", from: "/config/x/copy.bara.sky", want: "/config/b.bara.sky"},
+		{label: "//../outside.bara.sky", wantErr: true},
+		{label: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			got, err := loader.Resolve(tt.label, tt.from)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != filepath.FromSlash(tt.want) {
+				t.Errorf("Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,9 +1,12 @@
 package folder
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/albertocavalcante/starlark-go-copybara/vcs"
 )
@@ -59,19 +62,121 @@ func (d *DestinationImpl) Checkout(ref string) error {
 	return nil
 }
 
-// Write writes changes to the destination folder.
-func (d *DestinationImpl) Write(changes []*vcs.Change) error {
+// Write replaces the destination files selected by result.DestinationFiles
+// with the transformed tree in result.WorkDir.
+//
+// Files present in the destination but missing from the workdir are deleted;
+// files outside DestinationFiles are never touched. In dry-run mode the
+// changes are computed but not applied.
+func (d *DestinationImpl) Write(result *vcs.TransformResult) (*vcs.WriteResult, error) {
 	path := d.path()
 
+	owned := func(file string) bool {
+		return result.DestinationFiles == nil || result.DestinationFiles.Matches(filepath.ToSlash(file))
+	}
+
+	// Files produced by the migration
+	newFiles, err := d.fs.ListFiles(result.WorkDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files in %s: %w", result.WorkDir, err)
+	}
+
+	// Files currently in the destination
+	existing := make(map[string]bool)
+	if d.fs.Exists(path) {
+		files, err := d.fs.ListFiles(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files in %s: %w", path, err)
+		}
+		for _, file := range files {
+			if owned(file) {
+				existing[file] = true
+			}
+		}
+	}
+
+	var changes []vcs.FileChange
+	toWrite := make(map[string]bool)
+	for _, file := range newFiles {
+		if !owned(file) {
+			continue
+		}
+		if !existing[file] {
+			changes = append(changes, vcs.FileChange{Path: file, Op: vcs.FileAdded})
+			toWrite[file] = true
+			continue
+		}
+		delete(existing, file)
+
+		same, err := d.sameFile(filepath.Join(result.WorkDir, file), filepath.Join(path, file))
+		if err != nil {
+			return nil, err
+		}
+		if !same {
+			changes = append(changes, vcs.FileChange{Path: file, Op: vcs.FileModified})
+			toWrite[file] = true
+		}
+	}
+	for file := range existing {
+		changes = append(changes, vcs.FileChange{Path: file, Op: vcs.FileDeleted})
+	}
+
+	slices.SortFunc(changes, func(a, b vcs.FileChange) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	writeResult := &vcs.WriteResult{Files: changes}
+	if result.DryRun {
+		return writeResult, nil
+	}
+
 	// Ensure destination directory exists
 	if err := d.fs.MkdirAll(path, 0o755); err != nil {
-		return fmt.Errorf("failed to create destination directory %s: %w", path, err)
+		return nil, fmt.Errorf("failed to create destination directory %s: %w", path, err)
 	}
 
-	// Write is typically called after transformations have already placed
-	// files in a working directory. For folder destinations, this is usually
-	// a no-op since files are written directly during transformation.
-	return nil
+	for _, change := range changes {
+		fullPath := filepath.Join(path, change.Path)
+		if change.Op == vcs.FileDeleted {
+			if err := d.fs.Remove(fullPath); err != nil {
+				return nil, fmt.Errorf("failed to remove %s: %w", change.Path, err)
+			}
+			continue
+		}
+		if !toWrite[change.Path] {
+			continue
+		}
+		if err := d.fs.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create directory for %s: %w", change.Path, err)
+		}
+		if err := CopyFile(d.fs, filepath.Join(result.WorkDir, change.Path), fullPath); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", change.Path, err)
+		}
+	}
+
+	return writeResult, nil
+}
+
+// sameFile returns true if both files have the same content and permissions.
+func (d *DestinationImpl) sameFile(a, b string) (bool, error) {
+	aData, err := d.fs.ReadFile(a)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", a, err)
+	}
+	bData, err := d.fs.ReadFile(b)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", b, err)
+	}
+	if !bytes.Equal(aData, bData) {
+		return false, nil
+	}
+
+	aInfo, aErr := d.fs.Stat(a)
+	bInfo, bErr := d.fs.Stat(b)
+	if aErr != nil || bErr != nil {
+		return true, nil
+	}
+	return aInfo.Mode().Perm() == bInfo.Mode().Perm(), nil
 }
 
 // WriteFile writes a single file to the destination.
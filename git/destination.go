@@ -135,3 +135,8 @@ func (d *Destination) AttrNames() []string {
 		attrPrimaryBranchMigration,
 	}
 }
+
+// Impl returns an implementation of the Destination that can write to the repository.
+func (d *Destination) Impl() *DestinationImpl {
+	return NewDestinationImpl(d)
+}
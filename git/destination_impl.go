@@ -0,0 +1,640 @@
+package git
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/albertocavalcante/starlark-go-copybara/authoring"
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+	"github.com/albertocavalcante/starlark-go-copybara/vcs"
+)
+
+// Compile-time interface verification.
+var (
+	_ vcs.Destination         = (*DestinationImpl)(nil)
+	_ vcs.ChangeRequestWriter = (*DestinationImpl)(nil)
+	_ vcs.LastRevFinder       = (*DestinationImpl)(nil)
+	_ vcs.LabelFinder         = (*DestinationImpl)(nil)
+)
+
+// OriginRevIDLabel is the label added to destination commits with the
+// origin revision they were migrated from.
+const OriginRevIDLabel = "GitOrigin-RevId"
+
+// defaultBranch is the branch used when neither push nor fetch is configured.
+const defaultBranch = "master"
+
+// destinationRemote is the remote name used for the destination URL in the cache repository.
+const destinationRemote = "destination"
+
+// DestinationImpl implements the vcs.Destination interface for git repositories.
+//
+// Each write fetches the destination branch into a local bare repository,
+// builds a tree where the files matched by destination_files are replaced
+// by the transformed files, commits it and pushes it.
+type DestinationImpl struct {
+	destination *Destination
+	repoDir     string
+	committer   *authoring.Author
+	forcePush   bool
+	pushRef     string
+	lastCommit  string
+}
+
+// NewDestinationImpl creates a new DestinationImpl from a Destination configuration.
+func NewDestinationImpl(dest *Destination) *DestinationImpl {
+	return &DestinationImpl{
+		destination: dest,
+		repoDir:     cacheDir("destination", dest.url),
+	}
+}
+
+// WithRepoDir sets the directory of the local cache repository.
+func (d *DestinationImpl) WithRepoDir(dir string) *DestinationImpl {
+	d.repoDir = dir
+	return d
+}
+
+// WithCommitter sets the committer of destination commits. By default the
+// commit author is used.
+func (d *DestinationImpl) WithCommitter(committer *authoring.Author) *DestinationImpl {
+	d.committer = committer
+	return d
+}
+
+// URL returns the repository URL.
+func (d *DestinationImpl) URL() string {
+	return d.destination.url
+}
+
+// Ref returns the last commit written, or the push branch.
+func (d *DestinationImpl) Ref() string {
+	if d.lastCommit != "" {
+		return d.lastCommit
+	}
+	return d.pushBranch()
+}
+
+// Checkout is a no-op for git destinations; Write always starts from the
+// fetch branch.
+func (d *DestinationImpl) Checkout(ref string) error {
+	return nil
+}
+
+// pushBranch returns the branch commits are pushed to.
+func (d *DestinationImpl) pushBranch() string {
+	if d.destination.push != "" {
+		return d.destination.push
+	}
+	if d.destination.fetch != "" {
+		return d.destination.fetch
+	}
+	return defaultBranch
+}
+
+// fetchBranch returns the branch used as parent of new commits.
+func (d *DestinationImpl) fetchBranch() string {
+	if d.destination.fetch != "" {
+		return d.destination.fetch
+	}
+	return d.pushBranch()
+}
+
+// Repo returns the local cache repository configured with the destination remote.
+func (d *DestinationImpl) Repo() (*Repo, error) {
+	repo, err := OpenRepo(d.repoDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.SetRemote(destinationRemote, d.destination.url); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// FetchHead fetches the fetch branch and returns its commit, or "" if the
+// branch does not exist yet.
+func (d *DestinationImpl) FetchHead(repo *Repo) (string, error) {
+	branch := d.fetchBranch()
+	out, err := repo.Run("ls-remote", destinationRemote, "refs/heads/"+branch)
+	if err != nil {
+		return "", fmt.Errorf("failed to list %s: %w", d.destination.url, err)
+	}
+	if strings.TrimSpace(out) == "" {
+		return "", nil
+	}
+
+	local := "refs/copybara/destination/" + branch
+	if err := repo.Fetch(destinationRemote, false, "+refs/heads/"+branch+":"+local); err != nil {
+		return "", fmt.Errorf("failed to fetch %s from %s: %w", branch, d.destination.url, err)
+	}
+	return repo.ResolveCommit(local)
+}
+
+// Write commits the transformed tree to the destination.
+//
+// Files matched by result.DestinationFiles are replaced by the files in
+// result.WorkDir; other destination files are kept. The commit carries the
+// resolved author and a GitOrigin-RevId label. When nothing changes, no
+// commit is created. In dry-run mode the changes are computed only; with
+// skip_push the commit is created locally but not pushed.
+func (d *DestinationImpl) Write(result *vcs.TransformResult) (*vcs.WriteResult, error) {
+	repo, err := d.Repo()
+	if err != nil {
+		return nil, err
+	}
+
+	parent, err := d.FetchHead(repo)
+	if err != nil {
+		return nil, err
+	}
+	return d.write(repo, parent, result)
+}
+
+// WriteChangeRequest commits the transformed tree on top of the destination
+// revision baseline. Files are compared against baseline, so only the
+// changes of the migrated change end up in the commit. Pushing fails if the
+// push branch has moved past baseline.
+func (d *DestinationImpl) WriteChangeRequest(baseline string, result *vcs.TransformResult) (*vcs.WriteResult, error) {
+	repo, err := d.Repo()
+	if err != nil {
+		return nil, err
+	}
+
+	parent, err := d.FetchRev(repo, baseline)
+	if err != nil {
+		return nil, err
+	}
+	return d.write(repo, parent, result)
+}
+
+// FetchRev makes the destination commit rev available in the cache
+// repository and returns its full SHA-1.
+//
+// rev may come from a label of an origin change, so only full commit SHAs
+// are fetched from the destination, and values that look like a git option
+// are rejected.
+func (d *DestinationImpl) FetchRev(repo *Repo, rev string) (string, error) {
+	if rev == "" || strings.HasPrefix(rev, "-") {
+		return "", fmt.Errorf("invalid destination revision %q", rev)
+	}
+	if _, err := d.FetchHead(repo); err != nil {
+		return "", err
+	}
+	if sha, err := repo.ResolveCommit(rev); err == nil {
+		return sha, nil
+	}
+	if !commitSHA.MatchString(rev) {
+		return "", fmt.Errorf("cannot find destination revision %q: only full commit SHAs can be fetched", rev)
+	}
+	if err := repo.Fetch(destinationRemote, false, rev); err != nil {
+		return "", fmt.Errorf("failed to fetch %s from %s: %w", rev, d.destination.url, err)
+	}
+	return repo.ResolveCommit(rev)
+}
+
+// write commits the transformed tree on top of parent and pushes it.
+//
+// The integrate labels of the message are resolved first: FAKE_MERGE
+// strategies add the referenced commit as a parent and INCLUDE_FILES
+// strategies copy its files outside of destination_files into the tree.
+func (d *DestinationImpl) write(repo *Repo, parent string, result *vcs.TransformResult) (*vcs.WriteResult, error) {
+	integrations, err := resolveIntegrations(repo, d.destination.integrates, result.Message)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := []string{parent}
+	include := make(map[string]treeEntry)
+	for _, in := range integrations {
+		if in.strategy != StrategyIncludeFiles {
+			parents = append(parents, in.commit)
+		}
+		if in.strategy == StrategyFakeMerge {
+			continue
+		}
+		entries, err := lsTree(repo, in.commit)
+		if err != nil {
+			return nil, err
+		}
+		for path, entry := range entries {
+			include[path] = entry
+		}
+	}
+
+	tree, changes, err := d.buildTree(repo, parent, result, include)
+	if err != nil {
+		return nil, err
+	}
+
+	writeResult := &vcs.WriteResult{Files: changes}
+	if len(changes) == 0 || result.DryRun {
+		return writeResult, nil
+	}
+
+	label := result.RevIDLabel
+	if label == "" {
+		label = OriginRevIDLabel
+	}
+	message := commitMessage(removeIntegrateLabels(result.Message, d.destination.integrates), label, result.OriginRef)
+	commit, err := d.commit(repo, tree, parents, message, result.Author)
+	if err != nil {
+		return nil, err
+	}
+	writeResult.DestinationRef = commit
+	d.lastCommit = commit
+
+	target := d.pushRef
+	if target == "" {
+		target = "refs/heads/" + d.pushBranch()
+	}
+	refspecs := []string{commit + ":" + target}
+	if d.forcePush {
+		refspecs[0] = "+" + refspecs[0]
+	}
+
+	if d.destination.tagName != "" {
+		tag, err := d.tag(repo, commit, message, result.Author, result.Changes)
+		if err != nil {
+			return nil, err
+		}
+		refspecs = append(refspecs, "refs/tags/"+tag+":refs/tags/"+tag)
+	}
+
+	if d.destination.skipPush {
+		return writeResult, nil
+	}
+
+	args := append([]string{"push", "--quiet", destinationRemote}, refspecs...)
+	if _, err := repo.Run(args...); err != nil {
+		return nil, fmt.Errorf("failed to push to %s: %w", d.destination.url, err)
+	}
+	return writeResult, nil
+}
+
+// LastRev returns the value of the most recent label in the first-parent
+// history of the fetch branch, or "" if the branch does not exist or no
+// commit carries the label.
+func (d *DestinationImpl) LastRev(label string) (string, error) {
+	var rev string
+	err := d.scanHistory(func(_ string, labels map[string][]string) bool {
+		if values := labels[label]; len(values) > 0 {
+			rev = values[len(values)-1]
+			return true
+		}
+		return false
+	})
+	return rev, err
+}
+
+// FindByLabel returns the most recent commit in the first-parent history of
+// the fetch branch whose message has the label with the given value.
+func (d *DestinationImpl) FindByLabel(label, value string) (string, error) {
+	var rev string
+	err := d.scanHistory(func(sha string, labels map[string][]string) bool {
+		if slices.Contains(labels[label], value) {
+			rev = sha
+			return true
+		}
+		return false
+	})
+	return rev, err
+}
+
+// scanHistory calls visit with the labels of each commit in the
+// first-parent history of the fetch branch, newest first, until it
+// returns true.
+func (d *DestinationImpl) scanHistory(visit func(sha string, labels map[string][]string) bool) error {
+	repo, err := d.Repo()
+	if err != nil {
+		return err
+	}
+
+	head, err := d.FetchHead(repo)
+	if err != nil || head == "" {
+		return err
+	}
+
+	out, err := repo.Run("log", "--first-parent", "--format=%x1e%H%x00%B", head)
+	if err != nil {
+		return err
+	}
+	for record := range strings.SplitSeq(out, "\x1e") {
+		sha, message, ok := strings.Cut(record, "\x00")
+		if ok && visit(sha, transform.ParseLabels(message)) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// treeEntry is a file in a git tree.
+type treeEntry struct {
+	mode string
+	sha  string
+}
+
+// buildTree writes a tree with the owned files of parent replaced by the
+// files in result.WorkDir and returns it with the list of changed files.
+// Files of include outside of the owned files are added to the tree too.
+func (d *DestinationImpl) buildTree(repo *Repo, parent string, result *vcs.TransformResult, include map[string]treeEntry) (string, []vcs.FileChange, error) {
+	owned := func(path string) bool {
+		return result.DestinationFiles == nil || result.DestinationFiles.Matches(path)
+	}
+
+	parentEntries := make(map[string]treeEntry)
+	if parent != "" {
+		var err error
+		if parentEntries, err = lsTree(repo, parent); err != nil {
+			return "", nil, err
+		}
+	}
+	existing := make(map[string]treeEntry)
+	for path, entry := range parentEntries {
+		if owned(path) {
+			existing[path] = entry
+		}
+	}
+
+	files, err := hashWorkDir(repo, result.WorkDir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var changes []vcs.FileChange
+	var index strings.Builder
+	for path, entry := range files {
+		if !owned(path) {
+			continue
+		}
+		old, ok := existing[path]
+		delete(existing, path)
+		switch {
+		case !ok:
+			changes = append(changes, vcs.FileChange{Path: path, Op: vcs.FileAdded})
+		case old != entry:
+			changes = append(changes, vcs.FileChange{Path: path, Op: vcs.FileModified})
+		default:
+			continue
+		}
+		fmt.Fprintf(&index, "%s %s\t%s\n", entry.mode, entry.sha, path)
+	}
+	for path := range existing {
+		changes = append(changes, vcs.FileChange{Path: path, Op: vcs.FileDeleted})
+		fmt.Fprintf(&index, "0 %s\t%s\n", strings.Repeat("0", 40), path)
+	}
+	for path, entry := range include {
+		if owned(path) {
+			continue
+		}
+		old, ok := parentEntries[path]
+		switch {
+		case !ok:
+			changes = append(changes, vcs.FileChange{Path: path, Op: vcs.FileAdded})
+		case old != entry:
+			changes = append(changes, vcs.FileChange{Path: path, Op: vcs.FileModified})
+		default:
+			continue
+		}
+		fmt.Fprintf(&index, "%s %s\t%s\n", entry.mode, entry.sha, path)
+	}
+
+	slices.SortFunc(changes, func(a, b vcs.FileChange) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	if len(changes) == 0 {
+		return "", nil, nil
+	}
+
+	indexFile := filepath.Join(repo.Dir(), "copybara-index")
+	defer func() { _ = os.Remove(indexFile) }()
+	indexed := repo.WithEnv("GIT_INDEX_FILE=" + indexFile)
+
+	if parent != "" {
+		_, err = indexed.Run("read-tree", parent)
+	} else {
+		_, err = indexed.Run("read-tree", "--empty")
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := indexed.RunInput(index.String(), "update-index", "--index-info"); err != nil {
+		return "", nil, err
+	}
+	tree, err := indexed.Run("write-tree")
+	if err != nil {
+		return "", nil, err
+	}
+	return strings.TrimSpace(tree), changes, nil
+}
+
+// lsTree returns the files in a commit, keyed by path.
+func lsTree(repo *Repo, rev string) (map[string]treeEntry, error) {
+	out, err := repo.Run("ls-tree", "-r", "-z", "--full-tree", rev)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]treeEntry)
+	for line := range strings.SplitSeq(out, "\x00") {
+		if line == "" {
+			continue
+		}
+		meta, path, ok := strings.Cut(line, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected ls-tree output: %q", line)
+		}
+		entries[path] = treeEntry{mode: fields[0], sha: fields[2]}
+	}
+	return entries, nil
+}
+
+// hashWorkDir writes the files under dir as blobs and returns them keyed
+// by slash-separated path.
+func hashWorkDir(repo *Repo, dir string) (map[string]treeEntry, error) {
+	files := make(map[string]treeEntry)
+	var regular []string
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			sha, err := repo.RunInput(target, "hash-object", "-w", "--stdin")
+			if err != nil {
+				return err
+			}
+			files[rel] = treeEntry{mode: "120000", sha: strings.TrimSpace(sha)}
+			return nil
+		}
+
+		mode := "100644"
+		if info.Mode().Perm()&0o111 != 0 {
+			mode = "100755"
+		}
+		files[rel] = treeEntry{mode: mode}
+		regular = append(regular, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	if len(regular) == 0 {
+		return files, nil
+	}
+
+	paths := make([]string, len(regular))
+	for i, rel := range regular {
+		paths[i] = filepath.Join(dir, filepath.FromSlash(rel))
+	}
+	out, err := repo.RunInput(strings.Join(paths, "\n")+"\n", "hash-object", "-w", "--no-filters", "--stdin-paths")
+	if err != nil {
+		return nil, err
+	}
+	shas := strings.Fields(out)
+	if len(shas) != len(regular) {
+		return nil, fmt.Errorf("hash-object returned %d hashes for %d files", len(shas), len(regular))
+	}
+	for i, rel := range regular {
+		entry := files[rel]
+		entry.sha = shas[i]
+		files[rel] = entry
+	}
+	return files, nil
+}
+
+// commitMessage appends the origin revision label to message.
+func commitMessage(message, label, originRef string) string {
+	message = strings.TrimRight(message, "\n")
+	if originRef == "" {
+		return message + "\n"
+	}
+
+	line := label + ": " + originRef
+	paragraphs := strings.Split(message, "\n\n")
+	if last := paragraphs[len(paragraphs)-1]; len(paragraphs) > 1 && isLabelBlock(last) {
+		return message + "\n" + line + "\n"
+	}
+	return message + "\n\n" + line + "\n"
+}
+
+// isLabelBlock returns true if every line of block is a label.
+func isLabelBlock(block string) bool {
+	labels := transform.ParseLabels(block)
+	n := 0
+	for _, values := range labels {
+		n += len(values)
+	}
+	return n == len(strings.Split(block, "\n"))
+}
+
+// identity returns the parsed commit author and the committer to use with it.
+func (d *DestinationImpl) identity(author string) (*authoring.Author, *authoring.Author, error) {
+	a, err := authoring.ParseAuthor(author)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid commit author %q: %w", author, err)
+	}
+	if d.committer != nil {
+		return a, d.committer, nil
+	}
+	return a, a, nil
+}
+
+// commit creates a commit of tree with the given parents. Empty parents are
+// skipped.
+func (d *DestinationImpl) commit(repo *Repo, tree string, parents []string, message, author string) (string, error) {
+	a, committer, err := d.identity(author)
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"commit-tree", tree}
+	for _, parent := range parents {
+		if parent != "" {
+			args = append(args, "-p", parent)
+		}
+	}
+	out, err := repo.WithEnv(
+		"GIT_AUTHOR_NAME="+a.Name(),
+		"GIT_AUTHOR_EMAIL="+a.Email(),
+		"GIT_COMMITTER_NAME="+committer.Name(),
+		"GIT_COMMITTER_EMAIL="+committer.Email(),
+	).RunInput(message, args...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// tag creates the tag configured by tag_name (and tag_msg) for commit and
+// returns its name. Templates reference labels of the commit message and
+// of the migrated changes. Annotated tags are signed by the committer.
+func (d *DestinationImpl) tag(repo *Repo, commit, message, author string, changes []*vcs.Change) (string, error) {
+	_, committer, err := d.identity(author)
+	if err != nil {
+		return "", err
+	}
+
+	labels := transform.ParseLabels(message)
+	for _, c := range changes {
+		for name, values := range c.Labels {
+			labels[name] = append(labels[name], values...)
+		}
+	}
+
+	name, err := expandTemplate(d.destination.tagName, labels)
+	if err != nil {
+		return "", fmt.Errorf("tag_name: %w", err)
+	}
+	// The name may come from labels of the migrated changes.
+	if strings.HasPrefix(name, "-") {
+		return "", fmt.Errorf("tag_name: invalid tag name %q", name)
+	}
+	if _, err := repo.Run("check-ref-format", "refs/tags/"+name); err != nil {
+		return "", fmt.Errorf("tag_name: invalid tag name %q", name)
+	}
+
+	args := []string{"tag", "--force"}
+	if d.destination.tagMsg != "" {
+		msg, err := expandTemplate(d.destination.tagMsg, labels)
+		if err != nil {
+			return "", fmt.Errorf("tag_msg: %w", err)
+		}
+		args = append(args, "-a", "-m", msg)
+	}
+	args = append(args, name, commit)
+
+	tagger := repo.WithEnv(
+		"GIT_COMMITTER_NAME="+committer.Name(),
+		"GIT_COMMITTER_EMAIL="+committer.Email(),
+	)
+	if _, err := tagger.Run(args...); err != nil {
+		return "", fmt.Errorf("failed to create tag %q: %w", name, err)
+	}
+	return name, nil
+}
@@ -0,0 +1,339 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/albertocavalcante/starlark-go-copybara/vcs"
+)
+
+// newBareRepo creates an empty bare repository and returns it as a testRepo.
+func newBareRepo(t *testing.T) *testRepo {
+	t.Helper()
+	r := &testRepo{t: t, dir: t.TempDir()}
+	r.git("init", "--quiet", "--bare", "--initial-branch=main")
+	return r
+}
+
+// newTestDestination returns a destination implementation using a private
+// cache directory.
+func newTestDestination(t *testing.T, dest *Destination) *DestinationImpl {
+	t.Helper()
+	return dest.Impl().WithRepoDir(filepath.Join(t.TempDir(), "cache"))
+}
+
+// workDir creates a directory with the given files.
+func workDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for path, content := range files {
+		full := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// prefixMatcher matches paths under a prefix.
+type prefixMatcher string
+
+func (p prefixMatcher) Matches(path string) bool {
+	return strings.HasPrefix(path, string(p))
+}
+
+func TestDestinationImplWrite(t *testing.T) {
+	remote := newBareRepo(t)
+	dest := newTestDestination(t, &Destination{url: remote.url(), push: "main"})
+
+	result, err := dest.Write(&vcs.TransformResult{
+		WorkDir:   workDir(t, map[string]string{"a.txt": "a\n", "dir/b.txt": "b\n"}),
+		OriginRef: "abc123",
+		Message:   "Import project\n",
+		Author:    "Jane Doe <jane@example.com>",
+	})
+	if err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if len(result.Files) != 2 || result.DestinationRef == "" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	if head := remote.git("rev-parse", "refs/heads/main"); head != result.DestinationRef {
+		t.Errorf("main = %s, want %s", head, result.DestinationRef)
+	}
+	if author := remote.git("log", "-1", "--format=%an <%ae>", "main"); author != "Jane Doe <jane@example.com>" {
+		t.Errorf("author = %q", author)
+	}
+	if msg := remote.git("log", "-1", "--format=%B", "main"); msg != "Import project\n\nGitOrigin-RevId: abc123" {
+		t.Errorf("message = %q", msg)
+	}
+	if content := remote.git("show", "main:dir/b.txt"); content != "b" {
+		t.Errorf("dir/b.txt = %q", content)
+	}
+}
+
+func TestDestinationImplDestinationFiles(t *testing.T) {
+	remote := newBareRepo(t)
+	dest := newTestDestination(t, &Destination{url: remote.url(), push: "main"})
+
+	if _, err := dest.Write(&vcs.TransformResult{
+		WorkDir:   workDir(t, map[string]string{"lib/old.txt": "old\n", "lib/keep.txt": "keep\n", "LICENSE": "mit\n"}),
+		OriginRef: "first",
+		Message:   "First",
+		Author:    "A <a@example.com>",
+	}); err != nil {
+		t.Fatalf("first Write() error: %v", err)
+	}
+
+	result, err := dest.Write(&vcs.TransformResult{
+		WorkDir:          workDir(t, map[string]string{"lib/new.txt": "new\n", "lib/keep.txt": "keep\n", "LICENSE": "ignored\n"}),
+		DestinationFiles: prefixMatcher("lib/"),
+		OriginRef:        "second",
+		Message:          "Second\n\nBug: 42",
+		Author:           "A <a@example.com>",
+	})
+	if err != nil {
+		t.Fatalf("second Write() error: %v", err)
+	}
+
+	want := []vcs.FileChange{
+		{Path: "lib/new.txt", Op: vcs.FileAdded},
+		{Path: "lib/old.txt", Op: vcs.FileDeleted},
+	}
+	if !slices.Equal(result.Files, want) {
+		t.Errorf("Files = %v, want %v", result.Files, want)
+	}
+
+	files := strings.Fields(remote.git("ls-tree", "-r", "--name-only", "main"))
+	if !slices.Equal(files, []string{"LICENSE", "lib/keep.txt", "lib/new.txt"}) {
+		t.Errorf("files = %v", files)
+	}
+	if content := remote.git("show", "main:LICENSE"); content != "mit" {
+		t.Errorf("LICENSE outside destination_files changed: %q", content)
+	}
+	if msg := remote.git("log", "-1", "--format=%B", "main"); msg != "Second\n\nBug: 42\nGitOrigin-RevId: second" {
+		t.Errorf("message = %q", msg)
+	}
+	if parents := remote.git("log", "-1", "--format=%P", "main"); len(strings.Fields(parents)) != 1 {
+		t.Errorf("expected the second commit to have a parent, got %q", parents)
+	}
+}
+
+func TestDestinationImplNoChanges(t *testing.T) {
+	remote := newBareRepo(t)
+	dest := newTestDestination(t, &Destination{url: remote.url(), push: "main"})
+	files := map[string]string{"a.txt": "a\n"}
+
+	first, err := dest.Write(&vcs.TransformResult{WorkDir: workDir(t, files), Message: "First", Author: "A <a@example.com>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := dest.Write(&vcs.TransformResult{WorkDir: workDir(t, files), Message: "Again", Author: "A <a@example.com>"})
+	if err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if !result.Empty() || result.DestinationRef != "" {
+		t.Errorf("expected empty result, got %+v", result)
+	}
+	if head := remote.git("rev-parse", "main"); head != first.DestinationRef {
+		t.Errorf("main moved to %s", head)
+	}
+}
+
+func TestDestinationImplDryRunAndSkipPush(t *testing.T) {
+	remote := newBareRepo(t)
+	files := map[string]string{"a.txt": "a\n"}
+
+	dryRun := newTestDestination(t, &Destination{url: remote.url(), push: "main"})
+	result, err := dryRun.Write(&vcs.TransformResult{WorkDir: workDir(t, files), Message: "m", Author: "A <a@example.com>", DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run Write() error: %v", err)
+	}
+	if len(result.Files) != 1 || result.DestinationRef != "" {
+		t.Errorf("unexpected dry run result: %+v", result)
+	}
+
+	skipPush := newTestDestination(t, &Destination{url: remote.url(), push: "main", skipPush: true})
+	result, err = skipPush.Write(&vcs.TransformResult{WorkDir: workDir(t, files), Message: "m", Author: "A <a@example.com>"})
+	if err != nil {
+		t.Fatalf("skip_push Write() error: %v", err)
+	}
+	if result.DestinationRef == "" {
+		t.Error("skip_push should still create a local commit")
+	}
+
+	if refs := remote.git("for-each-ref"); refs != "" {
+		t.Errorf("nothing should be pushed, got refs %q", refs)
+	}
+}
+
+func TestDestinationImplTag(t *testing.T) {
+	remote := newBareRepo(t)
+	dest := newTestDestination(t, &Destination{
+		url:     remote.url(),
+		push:    "main",
+		tagName: "release-${Version}",
+		tagMsg:  "Release ${Version} from ${GitOrigin-RevId}",
+	})
+
+	result, err := dest.Write(&vcs.TransformResult{
+		WorkDir:   workDir(t, map[string]string{"a.txt": "a\n"}),
+		OriginRef: "abc123",
+		Message:   "Import",
+		Author:    "A <a@example.com>",
+		Changes:   []*vcs.Change{{Ref: "abc123", Labels: map[string][]string{"Version": {"1.2"}}}},
+	})
+	if err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+
+	if tagged := remote.git("rev-parse", "release-1.2^{commit}"); tagged != result.DestinationRef {
+		t.Errorf("tag points to %s, want %s", tagged, result.DestinationRef)
+	}
+	if msg := remote.git("tag", "-l", "--format=%(contents)", "release-1.2"); msg != "Release 1.2 from abc123" {
+		t.Errorf("tag message = %q", msg)
+	}
+}
+
+func TestDestinationImplTagMissingLabel(t *testing.T) {
+	remote := newBareRepo(t)
+	dest := newTestDestination(t, &Destination{url: remote.url(), push: "main", tagName: "v${Missing}"})
+
+	_, err := dest.Write(&vcs.TransformResult{
+		WorkDir: workDir(t, map[string]string{"a.txt": "a\n"}),
+		Message: "Import",
+		Author:  "A <a@example.com>",
+	})
+	if err == nil || !strings.Contains(err.Error(), "Missing") {
+		t.Errorf("expected missing label error, got %v", err)
+	}
+}
+
+func TestDestinationImplTagInvalidName(t *testing.T) {
+	for _, version := range []string{"-f", "1..2", "1 2"} {
+		t.Run(version, func(t *testing.T) {
+			remote := newBareRepo(t)
+			dest := newTestDestination(t, &Destination{url: remote.url(), push: "main", tagName: "${Version}"})
+
+			_, err := dest.Write(&vcs.TransformResult{
+				WorkDir: workDir(t, map[string]string{"a.txt": "a\n"}),
+				Message: "Import\n\nVersion: " + version + "\n",
+				Author:  "A <a@example.com>",
+			})
+			if err == nil || !strings.Contains(err.Error(), "invalid tag name") {
+				t.Errorf("expected an invalid tag name error, got %v", err)
+			}
+			if tags := remote.git("tag", "-l"); tags != "" {
+				t.Errorf("no tag expected, got %q", tags)
+			}
+		})
+	}
+}
+
+func TestDestinationImplWriteChangeRequest(t *testing.T) {
+	remote := newBareRepo(t)
+	dest := newTestDestination(t, &Destination{url: remote.url(), push: "main"})
+	first, err := dest.Write(&vcs.TransformResult{
+		WorkDir: workDir(t, map[string]string{"a.txt": "a\n"}),
+		Message: "Import",
+		Author:  "A <a@example.com>",
+	})
+	if err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+
+	result, err := dest.WriteChangeRequest(first.DestinationRef, &vcs.TransformResult{
+		WorkDir: workDir(t, map[string]string{"a.txt": "b\n"}),
+		Message: "Change",
+		Author:  "A <a@example.com>",
+	})
+	if err != nil {
+		t.Fatalf("WriteChangeRequest() error: %v", err)
+	}
+	if parent := remote.git("rev-parse", result.DestinationRef+"^"); parent != first.DestinationRef {
+		t.Errorf("parent = %s, want %s", parent, first.DestinationRef)
+	}
+
+	// Baselines come from origin labels and must not be read as git options
+	// or arbitrary refspecs.
+	marker := filepath.Join(t.TempDir(), "pwned")
+	for _, baseline := range []string{
+		"--upload-pack=touch " + marker,
+		"refs/heads/main:refs/heads/other",
+		"",
+	} {
+		_, err := dest.WriteChangeRequest(baseline, &vcs.TransformResult{
+			WorkDir: workDir(t, map[string]string{"a.txt": "c\n"}),
+			Message: "Change",
+			Author:  "A <a@example.com>",
+		})
+		if err == nil {
+			t.Errorf("WriteChangeRequest(%q) should fail", baseline)
+		}
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("a baseline label value ran a command")
+	}
+}
+
+func TestCommitMessage(t *testing.T) {
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"Title\n", "Title\n\nGitOrigin-RevId: r1\n"},
+		{"Title\n\nBody text", "Title\n\nBody text\n\nGitOrigin-RevId: r1\n"},
+		{"Title\n\nBug: 1\nChange-Id: x\n", "Title\n\nBug: 1\nChange-Id: x\nGitOrigin-RevId: r1\n"},
+	}
+	for _, tt := range tests {
+		if got := commitMessage(tt.message, OriginRevIDLabel, "r1"); got != tt.want {
+			t.Errorf("commitMessage(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestDestinationImplLastRev(t *testing.T) {
+	remote := newBareRepo(t)
+	dest := newTestDestination(t, &Destination{url: remote.url(), push: "main"})
+
+	if rev, err := dest.LastRev(OriginRevIDLabel); err != nil || rev != "" {
+		t.Fatalf("LastRev() on empty destination = %q, %v", rev, err)
+	}
+
+	for i, ref := range []string{"first", "second"} {
+		if _, err := dest.Write(&vcs.TransformResult{
+			WorkDir:    workDir(t, map[string]string{"a.txt": ref}),
+			OriginRef:  ref,
+			RevIDLabel: "Custom-RevId",
+			Message:    "Change " + string(rune('1'+i)),
+			Author:     "A <a@example.com>",
+		}); err != nil {
+			t.Fatalf("Write() error: %v", err)
+		}
+	}
+
+	rev, err := newTestDestination(t, &Destination{url: remote.url(), push: "main"}).LastRev("Custom-RevId")
+	if err != nil {
+		t.Fatalf("LastRev() error: %v", err)
+	}
+	if rev != "second" {
+		t.Errorf("LastRev() = %q, want %q", rev, "second")
+	}
+	if sha, err := dest.FindByLabel("Custom-RevId", "first"); err != nil || sha != remote.git("rev-parse", "main~1") {
+		t.Errorf("FindByLabel(first) = %q, %v", sha, err)
+	}
+	if sha, _ := dest.FindByLabel("Custom-RevId", "missing"); sha != "" {
+		t.Errorf("FindByLabel(missing) = %q, want none", sha)
+	}
+	if rev, _ := dest.LastRev(OriginRevIDLabel); rev != "" {
+		t.Errorf("LastRev(%s) = %q, want none", OriginRevIDLabel, rev)
+	}
+}
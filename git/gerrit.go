@@ -0,0 +1,310 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+// ChangeIDPolicy defines how the Gerrit destination handles the Change-Id
+// label of the migrated message.
+type ChangeIDPolicy string
+
+const (
+	// ChangeIDFailIfPresent fails if the message already has a Change-Id.
+	ChangeIDFailIfPresent ChangeIDPolicy = "FAIL_IF_PRESENT"
+	// ChangeIDRequire requires the message to have a Change-Id and uses it.
+	ChangeIDRequire ChangeIDPolicy = "REQUIRE"
+	// ChangeIDReplace replaces the Change-Id of the message, if any.
+	ChangeIDReplace ChangeIDPolicy = "REPLACE"
+	// ChangeIDReuse uses the Change-Id of the message, or creates one.
+	ChangeIDReuse ChangeIDPolicy = "REUSE"
+)
+
+// ParseChangeIDPolicy parses a string into a ChangeIDPolicy.
+func ParseChangeIDPolicy(s string) (ChangeIDPolicy, error) {
+	switch strings.ToUpper(s) {
+	case "FAIL_IF_PRESENT", "":
+		return ChangeIDFailIfPresent, nil
+	case "REQUIRE":
+		return ChangeIDRequire, nil
+	case "REPLACE":
+		return ChangeIDReplace, nil
+	case "REUSE":
+		return ChangeIDReuse, nil
+	default:
+		return "", fmt.Errorf("invalid change_id_policy: %q", s)
+	}
+}
+
+// GerritOrigin represents a Gerrit repository origin.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/git/GerritOrigin.java
+type GerritOrigin struct {
+	url          string
+	ref          string
+	branch       string
+	submodules   SubmoduleStrategy
+	firstParent  bool
+	partialFetch bool
+}
+
+// String implements starlark.Value.
+func (g *GerritOrigin) String() string {
+	var parts []string
+	parts = append(parts, fmt.Sprintf("url = %q", g.url))
+	if g.ref != "" {
+		parts = append(parts, fmt.Sprintf("ref = %q", g.ref))
+	}
+	if g.branch != "" {
+		parts = append(parts, fmt.Sprintf("branch = %q", g.branch))
+	}
+	return fmt.Sprintf("git.gerrit_origin(%s)", strings.Join(parts, ", "))
+}
+
+// Type implements starlark.Value.
+func (g *GerritOrigin) Type() string {
+	return "git.gerrit_origin"
+}
+
+// Freeze implements starlark.Value.
+func (g *GerritOrigin) Freeze() {}
+
+// Truth implements starlark.Value.
+func (g *GerritOrigin) Truth() starlark.Bool {
+	return starlark.True
+}
+
+// Hash implements starlark.Value.
+func (g *GerritOrigin) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: git.gerrit_origin")
+}
+
+// URL returns the repository URL.
+func (g *GerritOrigin) URL() string {
+	return g.url
+}
+
+// Ref returns the Git reference.
+func (g *GerritOrigin) Ref() string {
+	return g.ref
+}
+
+// Branch returns the branch migrated changes must target, if any.
+func (g *GerritOrigin) Branch() string {
+	return g.branch
+}
+
+// Submodules returns the submodule strategy.
+func (g *GerritOrigin) Submodules() SubmoduleStrategy {
+	return g.submodules
+}
+
+// FirstParent returns whether to use first parent only.
+func (g *GerritOrigin) FirstParent() bool {
+	return g.firstParent
+}
+
+// PartialFetch returns whether partial fetch is enabled.
+func (g *GerritOrigin) PartialFetch() bool {
+	return g.partialFetch
+}
+
+// Impl returns an implementation of the GerritOrigin that can read changes.
+func (g *GerritOrigin) Impl() *GerritOriginImpl {
+	return NewGerritOriginImpl(g)
+}
+
+// Attr implements starlark.HasAttrs.
+func (g *GerritOrigin) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "url":
+		return starlark.String(g.url), nil
+	case "ref":
+		return starlark.String(g.ref), nil
+	case "branch":
+		return starlark.String(g.branch), nil
+	case "submodules":
+		return starlark.String(g.submodules), nil
+	case "first_parent":
+		return starlark.Bool(g.firstParent), nil
+	case "partial_fetch":
+		return starlark.Bool(g.partialFetch), nil
+	default:
+		return nil, nil
+	}
+}
+
+// AttrNames implements starlark.HasAttrs.
+func (g *GerritOrigin) AttrNames() []string {
+	return []string{
+		"url",
+		"ref",
+		"branch",
+		"submodules",
+		"first_parent",
+		"partial_fetch",
+	}
+}
+
+// GerritDestination represents a Gerrit destination that uploads changes
+// for review.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/git/GerritDestination.java
+type GerritDestination struct {
+	url            string
+	fetch          string
+	pushToRefsFor  string
+	submit         bool
+	changeIDPolicy ChangeIDPolicy
+	topic          string
+	reviewers      []string
+	cc             []string
+	labels         []string
+	integrates     []*IntegrateChanges
+}
+
+// String implements starlark.Value.
+func (g *GerritDestination) String() string {
+	var parts []string
+	parts = append(parts, fmt.Sprintf("url = %q", g.url))
+	if g.fetch != "" {
+		parts = append(parts, fmt.Sprintf("fetch = %q", g.fetch))
+	}
+	if g.pushToRefsFor != "" && g.pushToRefsFor != g.fetch {
+		parts = append(parts, fmt.Sprintf("push_to_refs_for = %q", g.pushToRefsFor))
+	}
+	if g.submit {
+		parts = append(parts, "submit = True")
+	}
+	if g.topic != "" {
+		parts = append(parts, fmt.Sprintf("topic = %q", g.topic))
+	}
+	return fmt.Sprintf("git.gerrit_destination(%s)", strings.Join(parts, ", "))
+}
+
+// Type implements starlark.Value.
+func (g *GerritDestination) Type() string {
+	return "git.gerrit_destination"
+}
+
+// Freeze implements starlark.Value.
+func (g *GerritDestination) Freeze() {}
+
+// Truth implements starlark.Value.
+func (g *GerritDestination) Truth() starlark.Bool {
+	return starlark.True
+}
+
+// Hash implements starlark.Value.
+func (g *GerritDestination) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: git.gerrit_destination")
+}
+
+// URL returns the repository URL.
+func (g *GerritDestination) URL() string {
+	return g.url
+}
+
+// Fetch returns the branch changes are based on.
+func (g *GerritDestination) Fetch() string {
+	return g.fetch
+}
+
+// PushToRefsFor returns the branch changes are uploaded for review to.
+func (g *GerritDestination) PushToRefsFor() string {
+	return g.pushToRefsFor
+}
+
+// Submit returns whether changes are pushed directly to the branch instead
+// of being uploaded for review.
+func (g *GerritDestination) Submit() bool {
+	return g.submit
+}
+
+// ChangeIDPolicy returns how existing Change-Id labels are handled.
+func (g *GerritDestination) ChangeIDPolicy() ChangeIDPolicy {
+	return g.changeIDPolicy
+}
+
+// Topic returns the topic template.
+func (g *GerritDestination) Topic() string {
+	return g.topic
+}
+
+// Reviewers returns the reviewer templates.
+func (g *GerritDestination) Reviewers() []string {
+	return g.reviewers
+}
+
+// CC returns the cc templates.
+func (g *GerritDestination) CC() []string {
+	return g.cc
+}
+
+// Labels returns the review labels voted on upload, such as "Code-Review+1".
+func (g *GerritDestination) Labels() []string {
+	return g.labels
+}
+
+// Integrates returns the integrate changes configuration.
+func (g *GerritDestination) Integrates() []*IntegrateChanges {
+	return g.integrates
+}
+
+// Impl returns an implementation of the GerritDestination that can upload
+// changes.
+func (g *GerritDestination) Impl() *GerritDestinationImpl {
+	return NewGerritDestinationImpl(g)
+}
+
+// Attr implements starlark.HasAttrs.
+func (g *GerritDestination) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "url":
+		return starlark.String(g.url), nil
+	case "fetch":
+		return starlark.String(g.fetch), nil
+	case "push_to_refs_for":
+		return starlark.String(g.pushToRefsFor), nil
+	case "submit":
+		return starlark.Bool(g.submit), nil
+	case "change_id_policy":
+		return starlark.String(g.changeIDPolicy), nil
+	case "topic":
+		return starlark.String(g.topic), nil
+	case "reviewers":
+		return stringList(g.reviewers), nil
+	case "cc":
+		return stringList(g.cc), nil
+	case "labels":
+		return stringList(g.labels), nil
+	default:
+		return nil, nil
+	}
+}
+
+// AttrNames implements starlark.HasAttrs.
+func (g *GerritDestination) AttrNames() []string {
+	return []string{
+		"url",
+		"fetch",
+		"push_to_refs_for",
+		"submit",
+		"change_id_policy",
+		"topic",
+		"reviewers",
+		"cc",
+		"labels",
+	}
+}
+
+// stringList converts a slice of strings to a Starlark list.
+func stringList(values []string) *starlark.List {
+	list := make([]starlark.Value, len(values))
+	for i, v := range values {
+		list[i] = starlark.String(v)
+	}
+	return starlark.NewList(list)
+}
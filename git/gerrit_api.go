@@ -0,0 +1,199 @@
+package git
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// GerritAPI is the subset of the Gerrit REST API used by the Gerrit origins
+// and destinations.
+type GerritAPI interface {
+	// URL returns the base URL of the Gerrit server.
+	URL() string
+
+	// GetChange returns a change by number or Change-Id, with its current
+	// revision.
+	GetChange(id string) (*ChangeInfo, error)
+
+	// QueryChanges returns the changes matching a Gerrit search query,
+	// with their current revision.
+	QueryChanges(query string) ([]*ChangeInfo, error)
+}
+
+// Gerrit change statuses.
+const (
+	ChangeStatusNew       = "NEW"
+	ChangeStatusMerged    = "MERGED"
+	ChangeStatusAbandoned = "ABANDONED"
+)
+
+// ChangeInfo is a Gerrit change.
+type ChangeInfo struct {
+	ID              string                   `json:"id"`
+	Project         string                   `json:"project"`
+	Branch          string                   `json:"branch"`
+	Topic           string                   `json:"topic"`
+	ChangeID        string                   `json:"change_id"`
+	Subject         string                   `json:"subject"`
+	Status          string                   `json:"status"`
+	Number          int                      `json:"_number"`
+	Owner           AccountInfo              `json:"owner"`
+	CurrentRevision string                   `json:"current_revision"`
+	Revisions       map[string]*RevisionInfo `json:"revisions"`
+}
+
+// AccountInfo is a Gerrit account.
+type AccountInfo struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Username string `json:"username"`
+}
+
+// RevisionInfo is a patch set of a Gerrit change.
+type RevisionInfo struct {
+	Number int    `json:"_number"`
+	Ref    string `json:"ref"`
+}
+
+// GerritClient is a GerritAPI implementation using the Gerrit REST API.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/git/gerritapi/GerritApi.java
+type GerritClient struct {
+	baseURL  string
+	username string
+	password string
+	http     *http.Client
+}
+
+// Compile-time interface verification.
+var _ GerritAPI = (*GerritClient)(nil)
+
+// gerritXSSIPrefix is prepended by Gerrit to every JSON response.
+const gerritXSSIPrefix = ")]}'"
+
+// NewGerritClient creates a client for the Gerrit server at baseURL. When
+// a username is given, requests are authenticated with the HTTP password.
+func NewGerritClient(baseURL, username, password string) *GerritClient {
+	return &GerritClient{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		username: username,
+		password: password,
+		http:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// DefaultGerritClient creates a client for the Gerrit server hosting
+// repoURL, configured by the GERRIT_API_URL, GERRIT_USERNAME and
+// GERRIT_PASSWORD environment variables.
+func DefaultGerritClient(repoURL string) *GerritClient {
+	baseURL := os.Getenv("GERRIT_API_URL")
+	if baseURL == "" {
+		if u, err := url.Parse(repoURL); err == nil && u.Host != "" {
+			baseURL = "https://" + u.Host
+		}
+	}
+	return NewGerritClient(baseURL, os.Getenv("GERRIT_USERNAME"), os.Getenv("GERRIT_PASSWORD"))
+}
+
+// URL implements GerritAPI.
+func (c *GerritClient) URL() string {
+	return c.baseURL
+}
+
+// GetChange implements GerritAPI.
+func (c *GerritClient) GetChange(id string) (*ChangeInfo, error) {
+	var change ChangeInfo
+	path := "/changes/" + url.PathEscape(id) + "?o=CURRENT_REVISION&o=DETAILED_ACCOUNTS"
+	if err := c.do(http.MethodGet, path, nil, &change); err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// QueryChanges implements GerritAPI.
+func (c *GerritClient) QueryChanges(query string) ([]*ChangeInfo, error) {
+	var changes []*ChangeInfo
+	params := url.Values{"q": {query}, "o": {"CURRENT_REVISION"}}
+	if err := c.do(http.MethodGet, "/changes/?"+params.Encode(), nil, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// do sends a request with an optional JSON body and decodes the JSON
+// response into out. Authenticated requests use the "/a" endpoints.
+func (c *GerritClient) do(method, path string, body, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	endpoint := c.baseURL + path
+	if c.username != "" {
+		endpoint = c.baseURL + "/a" + path
+	}
+	req, err := http.NewRequest(method, endpoint, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("gerrit: %s %s: %w", method, path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("gerrit: %s %s: %w", method, path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("gerrit: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	data = bytes.TrimPrefix(data, []byte(gerritXSSIPrefix))
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("gerrit: %s %s: invalid response: %w", method, path, err)
+	}
+	return nil
+}
+
+// gerritProject returns the Gerrit project of a repository URL such as
+// https://gerrit.example.com/a/project/name.
+func gerritProject(repoURL string) (string, error) {
+	p := repoURL
+	if u, err := url.Parse(repoURL); err == nil && u.Scheme != "" {
+		p = u.Path
+	}
+	p = strings.TrimSuffix(strings.Trim(p, "/"), ".git")
+	p = strings.TrimPrefix(p, "a/")
+	if p == "" {
+		return "", fmt.Errorf("cannot find the Gerrit project name in %q", repoURL)
+	}
+	return p, nil
+}
+
+// gerritChangeURL returns the web URL of a change.
+func gerritChangeURL(client GerritAPI, project string, number int) string {
+	return fmt.Sprintf("%s/c/%s/+/%d", strings.TrimRight(client.URL(), "/"), project, number)
+}
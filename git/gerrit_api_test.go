@@ -0,0 +1,234 @@
+package git
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+)
+
+// fakeGerrit is an in-memory Gerrit REST API serving the changes of a
+// single project.
+//
+// When backed by a repository, changes pushed to refs/for/<branch> are
+// turned into changes (or new patch sets of the change with the same
+// Change-Id) before each request, as Gerrit does on upload.
+type fakeGerrit struct {
+	t       *testing.T
+	project string
+	repo    *testRepo
+	server  *httptest.Server
+
+	mu      sync.Mutex
+	changes []*ChangeInfo
+	pushes  []string
+	calls   []string
+}
+
+// newFakeGerrit starts a fake Gerrit server for project, backed by repo if
+// not nil.
+func newFakeGerrit(t *testing.T, project string, repo *testRepo) *fakeGerrit {
+	t.Helper()
+	f := &fakeGerrit{t: t, project: project, repo: repo}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// client returns an authenticated client for the fake server.
+func (f *fakeGerrit) client() *GerritClient {
+	return NewGerritClient(f.server.URL, "user", "secret")
+}
+
+// addChange registers a change whose patch sets are the given commits,
+// oldest first.
+func (f *fakeGerrit) addChange(number int, changeID, branch string, patchSets ...string) *ChangeInfo {
+	c := &ChangeInfo{
+		ID:        fmt.Sprintf("%s~%s~%s", f.project, branch, changeID),
+		Project:   f.project,
+		Branch:    branch,
+		ChangeID:  changeID,
+		Status:    ChangeStatusNew,
+		Number:    number,
+		Revisions: make(map[string]*RevisionInfo),
+	}
+	for _, sha := range patchSets {
+		f.addPatchSet(c, sha)
+	}
+	f.changes = append(f.changes, c)
+	return c
+}
+
+// addPatchSet adds sha as the new current patch set of c.
+func (f *fakeGerrit) addPatchSet(c *ChangeInfo, sha string) {
+	ps := len(c.Revisions) + 1
+	c.Revisions[sha] = &RevisionInfo{Number: ps, Ref: gerritPatchSetRef(c.Number, ps)}
+	c.CurrentRevision = sha
+	if f.repo != nil {
+		f.repo.git("update-ref", gerritPatchSetRef(c.Number, ps), sha)
+	}
+}
+
+// receive turns refs/for pushes into changes and patch sets.
+func (f *fakeGerrit) receive() {
+	if f.repo == nil {
+		return
+	}
+	out := f.repo.git("for-each-ref", "--format=%(refname) %(objectname)", "refs/for/")
+	for line := range strings.SplitSeq(out, "\n") {
+		ref, sha, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		f.pushes = append(f.pushes, ref)
+		f.repo.git("update-ref", "-d", ref)
+
+		branch, _, _ := strings.Cut(strings.TrimPrefix(ref, "refs/for/"), "%")
+		ids := transform.ParseLabels(f.repo.git("log", "-1", "--format=%B", sha))[ChangeIDLabel]
+		if len(ids) == 0 {
+			f.t.Errorf("pushed commit %s has no Change-Id", sha)
+			continue
+		}
+		if c := f.find(ids[0], branch); c != nil && c.Status == ChangeStatusNew {
+			f.addPatchSet(c, sha)
+			continue
+		}
+		f.addChange(len(f.changes)+1, ids[0], branch, sha)
+	}
+}
+
+// find returns the change with the given Change-Id on branch.
+func (f *fakeGerrit) find(changeID, branch string) *ChangeInfo {
+	for _, c := range f.changes {
+		if c.ChangeID == changeID && c.Branch == branch {
+			return c
+		}
+	}
+	return nil
+}
+
+func (f *fakeGerrit) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, r.Method+" "+r.URL.Path)
+	f.receive()
+
+	path, ok := strings.CutPrefix(r.URL.Path, "/a")
+	if user, pass, _ := r.BasicAuth(); !ok || user != "user" || pass != "secret" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case path == "/changes/" && r.Method == http.MethodGet:
+		matches := []*ChangeInfo{}
+		for _, c := range f.changes {
+			if f.matches(c, r.URL.Query().Get("q")) {
+				matches = append(matches, c)
+			}
+		}
+		writeGerritJSON(w, matches)
+
+	case strings.HasPrefix(path, "/changes/") && r.Method == http.MethodGet:
+		id := strings.TrimPrefix(path, "/changes/")
+		for _, c := range f.changes {
+			if strconv.Itoa(c.Number) == id || c.ID == id {
+				writeGerritJSON(w, c)
+				return
+			}
+		}
+		http.Error(w, "Not found: "+id, http.StatusNotFound)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// matches evaluates a query made of "change:", "project:" and "branch:"
+// operators.
+func (f *fakeGerrit) matches(c *ChangeInfo, query string) bool {
+	for term := range strings.FieldsSeq(query) {
+		op, value, _ := strings.Cut(term, ":")
+		switch op {
+		case "change":
+			if c.ChangeID != value && strconv.Itoa(c.Number) != value {
+				return false
+			}
+		case "project":
+			if c.Project != value {
+				return false
+			}
+		case "branch":
+			if c.Branch != value {
+				return false
+			}
+		default:
+			f.t.Errorf("unsupported query operator %q", op)
+			return false
+		}
+	}
+	return true
+}
+
+// writeGerritJSON writes v as a Gerrit JSON response, with the XSSI prefix.
+func writeGerritJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(gerritXSSIPrefix + "\n"))
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestGerritClient(t *testing.T) {
+	fake := newFakeGerrit(t, "platform/project", nil)
+	fake.addChange(1234, "Iabc", "main", "1111111111111111111111111111111111111111")
+	client := fake.client()
+
+	change, err := client.GetChange("1234")
+	if err != nil {
+		t.Fatalf("GetChange() error: %v", err)
+	}
+	if change.ChangeID != "Iabc" || change.Revisions[change.CurrentRevision].Ref != "refs/changes/34/1234/1" {
+		t.Errorf("GetChange() = %+v", change)
+	}
+	if fake.calls[0] != "GET /a/changes/1234" {
+		t.Errorf("calls = %v", fake.calls)
+	}
+
+	changes, err := client.QueryChanges("change:Iabc project:platform/project branch:main")
+	if err != nil || len(changes) != 1 || changes[0].Number != 1234 {
+		t.Errorf("QueryChanges() = %v, %v", changes, err)
+	}
+	if changes, _ := client.QueryChanges("change:Iabc branch:other"); len(changes) != 0 {
+		t.Errorf("QueryChanges(other branch) = %v", changes)
+	}
+
+	if _, err := client.GetChange("99"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected a 404 error, got %v", err)
+	}
+	if _, err := NewGerritClient(fake.server.URL, "user", "wrong").GetChange("1234"); err == nil {
+		t.Error("expected an authentication error")
+	}
+}
+
+func TestGerritProject(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{url: "https://gerrit.example.com/platform/project", want: "platform/project"},
+		{url: "https://gerrit.example.com/a/platform/project.git", want: "platform/project"},
+		{url: "https://gerrit.example.com/", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := gerritProject(tt.url)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("gerritProject(%q) = %q, %v", tt.url, got, err)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package git
+
+import (
+	"crypto/sha1" //nolint:gosec // Change-Ids are SHA-1 based identifiers
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+	"github.com/albertocavalcante/starlark-go-copybara/vcs"
+)
+
+// Compile-time interface verification.
+var (
+	_ vcs.Destination         = (*GerritDestinationImpl)(nil)
+	_ vcs.ChangeRequestWriter = (*GerritDestinationImpl)(nil)
+)
+
+// ChangeIDLabel is the label Gerrit uses to identify a change across patch
+// sets.
+const ChangeIDLabel = "Change-Id"
+
+// maxChangeIDAttempts bounds the Change-Id candidates tried when the
+// changes of the previous ones were merged or abandoned.
+const maxChangeIDAttempts = 20
+
+// changeIDLine matches Change-Id label lines.
+var changeIDLine = regexp.MustCompile(`(?m)^` + ChangeIDLabel + `: .*(\n|$)`)
+
+// GerritDestinationImpl implements the vcs.Destination interface for
+// Gerrit.
+//
+// Each write commits the transformed tree with a Change-Id label and pushes
+// it to refs/for/<push_to_refs_for>, passing the topic, reviewers, cc and
+// labels as push options. The Change-Id is derived from the workflow and
+// the context reference, so that later runs upload new patch sets of the
+// same change while it is open. With submit, commits are pushed directly
+// to the branch instead.
+type GerritDestinationImpl struct {
+	*DestinationImpl
+	gerrit *GerritDestination
+	client GerritAPI
+}
+
+// NewGerritDestinationImpl creates a new GerritDestinationImpl from a
+// GerritDestination configuration.
+func NewGerritDestinationImpl(gerrit *GerritDestination) *GerritDestinationImpl {
+	return &GerritDestinationImpl{
+		DestinationImpl: NewDestinationImpl(&Destination{
+			url:        gerrit.url,
+			push:       gerrit.pushToRefsFor,
+			fetch:      gerrit.fetch,
+			integrates: gerrit.integrates,
+		}),
+		gerrit: gerrit,
+		client: DefaultGerritClient(gerrit.url),
+	}
+}
+
+// WithGerritClient sets the client used to call the Gerrit API.
+func (g *GerritDestinationImpl) WithGerritClient(client GerritAPI) *GerritDestinationImpl {
+	g.client = client
+	return g
+}
+
+// WithRepoDir sets the directory of the local cache repository.
+func (g *GerritDestinationImpl) WithRepoDir(dir string) *GerritDestinationImpl {
+	g.DestinationImpl.WithRepoDir(dir)
+	return g
+}
+
+// Write commits the transformed tree on top of the fetch branch and
+// uploads it for review.
+func (g *GerritDestinationImpl) Write(result *vcs.TransformResult) (*vcs.WriteResult, error) {
+	return g.write(result, g.DestinationImpl.Write)
+}
+
+// WriteChangeRequest commits the transformed tree on top of the destination
+// revision baseline and uploads it for review.
+func (g *GerritDestinationImpl) WriteChangeRequest(baseline string, result *vcs.TransformResult) (*vcs.WriteResult, error) {
+	return g.write(result, func(r *vcs.TransformResult) (*vcs.WriteResult, error) {
+		return g.DestinationImpl.WriteChangeRequest(baseline, r)
+	})
+}
+
+// write adds the Change-Id to the message, pushes the change with push and
+// looks up the uploaded change.
+func (g *GerritDestinationImpl) write(result *vcs.TransformResult, push func(*vcs.TransformResult) (*vcs.WriteResult, error)) (*vcs.WriteResult, error) {
+	project, err := gerritProject(g.gerrit.url)
+	if err != nil {
+		return nil, err
+	}
+
+	changeID, err := g.changeID(project, result)
+	if err != nil {
+		return nil, err
+	}
+	withID := *result
+	withID.Message = commitMessage(changeIDLine.ReplaceAllString(result.Message, ""), ChangeIDLabel, changeID)
+
+	g.pushRef = ""
+	if !g.gerrit.submit {
+		if g.pushRef, err = g.refsFor(prLabels(result)); err != nil {
+			return nil, err
+		}
+	}
+
+	writeResult, err := push(&withID)
+	if err != nil {
+		return nil, err
+	}
+	if writeResult.Empty() || result.DryRun || writeResult.DestinationRef == "" || g.gerrit.submit {
+		return writeResult, nil
+	}
+
+	changes, err := g.client.QueryChanges(g.changeQuery(project, changeID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find change %s: %w", changeID, err)
+	}
+	if len(changes) == 0 {
+		return nil, fmt.Errorf("change %s was not found after uploading it", changeID)
+	}
+	writeResult.ChangeRequest = gerritChangeURL(g.client, project, changes[0].Number)
+	return writeResult, nil
+}
+
+// changeID returns the Change-Id of the migrated change according to the
+// change_id_policy.
+//
+// New Change-Ids are derived from the workflow, the context reference and
+// the destination. When a change with that Change-Id was already merged or
+// abandoned, the next candidate is used, so that a new change is created.
+func (g *GerritDestinationImpl) changeID(project string, result *vcs.TransformResult) (string, error) {
+	existing := transform.ParseLabels(result.Message)[ChangeIDLabel]
+	switch g.gerrit.changeIDPolicy {
+	case ChangeIDRequire:
+		if len(existing) == 0 {
+			return "", fmt.Errorf("change_id_policy is REQUIRE, but the message has no %s label", ChangeIDLabel)
+		}
+		return existing[len(existing)-1], nil
+	case ChangeIDReuse:
+		if len(existing) > 0 {
+			return existing[len(existing)-1], nil
+		}
+	case ChangeIDReplace:
+		// A new Change-Id is created below.
+	default:
+		if len(existing) > 0 {
+			return "", fmt.Errorf("change_id_policy is FAIL_IF_PRESENT, but the message has a %s label: %s",
+				ChangeIDLabel, existing[0])
+		}
+	}
+
+	for attempt := range maxChangeIDAttempts {
+		id := g.newChangeID(result, attempt)
+		changes, err := g.client.QueryChanges(g.changeQuery(project, id))
+		if err != nil {
+			return "", fmt.Errorf("failed to find change %s: %w", id, err)
+		}
+		if len(changes) == 0 || changes[0].Status == ChangeStatusNew {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("no Change-Id available after %d attempts: the changes of all candidates are merged or abandoned",
+		maxChangeIDAttempts)
+}
+
+// newChangeID returns the Change-Id candidate of the given attempt for the
+// workflow and context reference of result.
+func (g *GerritDestinationImpl) newChangeID(result *vcs.TransformResult, attempt int) string {
+	contextRef := result.ContextRef
+	if contextRef == "" {
+		contextRef = result.OriginRef
+	}
+	identity := strings.Join([]string{result.Workflow, contextRef, g.gerrit.url, g.pushBranch(), strconv.Itoa(attempt)}, "\x00")
+	sum := sha1.Sum([]byte(identity)) //nolint:gosec // Change-Ids are not security sensitive
+	return "I" + hex.EncodeToString(sum[:])
+}
+
+// changeQuery returns the Gerrit query matching the change with the given
+// Change-Id in the destination project and branch.
+func (g *GerritDestinationImpl) changeQuery(project, changeID string) string {
+	return fmt.Sprintf("change:%s project:%s branch:%s", changeID, project, g.pushBranch())
+}
+
+// refsFor returns the reference changes are uploaded to, with the topic,
+// reviewers, cc and labels as push options. Templates reference labels of
+// the message and of the migrated changes.
+func (g *GerritDestinationImpl) refsFor(labels map[string][]string) (string, error) {
+	var options []string
+	add := func(key, template string) error {
+		value, err := expandTemplate(template, labels)
+		if err != nil {
+			return err
+		}
+		if strings.ContainsFunc(value, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+			return fmt.Errorf("%q cannot be used as a push option: it contains a comma or whitespace", value)
+		}
+		if value != "" {
+			options = append(options, key+"="+value)
+		}
+		return nil
+	}
+
+	if g.gerrit.topic != "" {
+		if err := add("topic", g.gerrit.topic); err != nil {
+			return "", fmt.Errorf("topic: %w", err)
+		}
+	}
+	for _, r := range g.gerrit.reviewers {
+		if err := add("r", r); err != nil {
+			return "", fmt.Errorf("reviewers: %w", err)
+		}
+	}
+	for _, cc := range g.gerrit.cc {
+		if err := add("cc", cc); err != nil {
+			return "", fmt.Errorf("cc: %w", err)
+		}
+	}
+	for _, l := range g.gerrit.labels {
+		options = append(options, "l="+l)
+	}
+
+	ref := "refs/for/" + g.pushBranch()
+	if len(options) > 0 {
+		ref += "%" + strings.Join(options, ",")
+	}
+	return ref, nil
+}
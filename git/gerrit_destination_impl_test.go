@@ -0,0 +1,228 @@
+package git
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+	"github.com/albertocavalcante/starlark-go-copybara/vcs"
+)
+
+// newGerritRemote creates a bare repository with a "main" branch and a fake
+// Gerrit server receiving the changes pushed to it.
+func newGerritRemote(t *testing.T) (*testRepo, *fakeGerrit) {
+	t.Helper()
+	seed := newTestRepo(t)
+	seed.commit("Initial", map[string]string{"README.md": "readme\n"})
+
+	remote := newBareRepo(t)
+	seed.git("push", "--quiet", remote.url(), "main")
+
+	project, err := gerritProject(remote.url())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return remote, newFakeGerrit(t, project, remote)
+}
+
+// newTestGerritDestination returns a Gerrit destination implementation
+// using a private cache directory and the fake API.
+func newTestGerritDestination(t *testing.T, dest *GerritDestination, fake *fakeGerrit) *GerritDestinationImpl {
+	t.Helper()
+	return dest.Impl().WithGerritClient(fake.client()).WithRepoDir(filepath.Join(t.TempDir(), "cache"))
+}
+
+// gerritResult returns a transform result for the given workflow and
+// context reference.
+func gerritResult(t *testing.T, content, message, contextRef string) *vcs.TransformResult {
+	t.Helper()
+	return &vcs.TransformResult{
+		WorkDir:    workDir(t, map[string]string{"README.md": "readme\n", "a.txt": content}),
+		OriginRef:  "origin-" + strings.TrimSpace(content),
+		Message:    message,
+		Author:     "A <a@example.com>",
+		Workflow:   "default",
+		ContextRef: contextRef,
+	}
+}
+
+func TestGerritDestinationImplWrite(t *testing.T) {
+	remote, fake := newGerritRemote(t)
+	dest := newTestGerritDestination(t, &GerritDestination{
+		url:           remote.url(),
+		fetch:         "main",
+		pushToRefsFor: "main",
+		topic:         "import-${Bug}",
+		reviewers:     []string{"r@example.com"},
+		cc:            []string{"cc@example.com"},
+		labels:        []string{"Code-Review+1"},
+	}, fake)
+
+	first, err := dest.Write(gerritResult(t, "one\n", "Fix things\n\nBug: 42\n", "pr-1"))
+	if err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if len(fake.changes) != 1 {
+		t.Fatalf("got %d changes, want 1", len(fake.changes))
+	}
+	change := fake.changes[0]
+	if first.ChangeRequest != fake.server.URL+"/c/"+fake.project+"/+/1" {
+		t.Errorf("ChangeRequest = %q", first.ChangeRequest)
+	}
+	wantPush := "refs/for/main%topic=import-42,r=r@example.com,cc=cc@example.com,l=Code-Review+1"
+	if !slices.Equal(fake.pushes, []string{wantPush}) {
+		t.Errorf("pushes = %v, want %s", fake.pushes, wantPush)
+	}
+
+	message := remote.git("log", "-1", "--format=%B", first.DestinationRef)
+	labels := transform.ParseLabels(message)
+	if !slices.Equal(labels[ChangeIDLabel], []string{change.ChangeID}) || !strings.HasPrefix(change.ChangeID, "I") {
+		t.Errorf("message = %q", message)
+	}
+	if !slices.Equal(labels[OriginRevIDLabel], []string{"origin-one"}) {
+		t.Errorf("message = %q", message)
+	}
+	if parent := remote.git("rev-parse", first.DestinationRef+"^"); parent != remote.git("rev-parse", "main") {
+		t.Errorf("change should be based on main, parent is %s", parent)
+	}
+
+	// The same workflow and context reference upload a new patch set.
+	second, err := dest.Write(gerritResult(t, "two\n", "Fix things\n\nBug: 42\n", "pr-1"))
+	if err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if second.ChangeRequest != first.ChangeRequest || len(fake.changes) != 1 || len(change.Revisions) != 2 {
+		t.Errorf("expected a new patch set, got %q and %d changes", second.ChangeRequest, len(fake.changes))
+	}
+
+	// Another context reference creates another change.
+	other, err := dest.Write(gerritResult(t, "three\n", "Other\n\nBug: 43\n", "pr-2"))
+	if err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if other.ChangeRequest == first.ChangeRequest || len(fake.changes) != 2 {
+		t.Errorf("expected a new change, got %q and %d changes", other.ChangeRequest, len(fake.changes))
+	}
+
+	// Once the change is merged, the same context reference creates a new
+	// change with another Change-Id.
+	change.Status = ChangeStatusMerged
+	next, err := dest.Write(gerritResult(t, "four\n", "Fix more\n\nBug: 42\n", "pr-1"))
+	if err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if len(fake.changes) != 3 || fake.changes[2].ChangeID == change.ChangeID {
+		t.Errorf("expected a new change after merge, got %d changes", len(fake.changes))
+	}
+	if next.ChangeRequest != fake.server.URL+"/c/"+fake.project+"/+/3" {
+		t.Errorf("ChangeRequest = %q", next.ChangeRequest)
+	}
+}
+
+func TestGerritDestinationImplChangeIDPolicy(t *testing.T) {
+	const existing = "Ideadbeef"
+	tests := []struct {
+		policy  ChangeIDPolicy
+		message string
+		want    string
+		wantErr bool
+	}{
+		{policy: ChangeIDFailIfPresent, message: "Msg\n\nChange-Id: " + existing + "\n", wantErr: true},
+		{policy: ChangeIDRequire, message: "Msg\n", wantErr: true},
+		{policy: ChangeIDRequire, message: "Msg\n\nChange-Id: " + existing + "\n", want: existing},
+		{policy: ChangeIDReuse, message: "Msg\n\nChange-Id: " + existing + "\n", want: existing},
+		{policy: ChangeIDReuse, message: "Msg\n"},
+		{policy: ChangeIDReplace, message: "Msg\n\nChange-Id: " + existing + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy)+" "+strings.ReplaceAll(tt.message, "\n", " "), func(t *testing.T) {
+			remote, fake := newGerritRemote(t)
+			dest := newTestGerritDestination(t, &GerritDestination{
+				url:            remote.url(),
+				fetch:          "main",
+				pushToRefsFor:  "main",
+				changeIDPolicy: tt.policy,
+			}, fake)
+
+			result, err := dest.Write(gerritResult(t, "one\n", tt.message, "ref"))
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Write() error: %v", err)
+			}
+
+			ids := transform.ParseLabels(remote.git("log", "-1", "--format=%B", result.DestinationRef))[ChangeIDLabel]
+			if len(ids) != 1 || (tt.want != "" && ids[0] != tt.want) || (tt.want == "" && ids[0] == existing) {
+				t.Errorf("Change-Id = %v, want %q", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestGerritDestinationImplChangeIDAttempts(t *testing.T) {
+	remote, fake := newGerritRemote(t)
+	dest := newTestGerritDestination(t, &GerritDestination{url: remote.url(), fetch: "main", pushToRefsFor: "main"}, fake)
+
+	result := gerritResult(t, "one\n", "Msg\n", "pr-1")
+	for attempt := range maxChangeIDAttempts {
+		fake.addChange(attempt+1, dest.newChangeID(result, attempt), "main").Status = ChangeStatusAbandoned
+	}
+	if _, err := dest.Write(result); err == nil || !strings.Contains(err.Error(), "no Change-Id available") {
+		t.Errorf("expected an error once every Change-Id candidate is used, got %v", err)
+	}
+	if len(fake.pushes) != 0 {
+		t.Errorf("nothing should be pushed, got %v", fake.pushes)
+	}
+}
+
+func TestGerritDestinationImplPushOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		dest GerritDestination
+	}{
+		{"topic with comma", GerritDestination{topic: "a,r=evil@example.com"}},
+		{"topic label with whitespace", GerritDestination{topic: "import-${Bug}"}},
+		{"reviewer with comma", GerritDestination{reviewers: []string{"r@example.com,l=Code-Review+2"}}},
+		{"cc with newline", GerritDestination{cc: []string{"cc@example.com\n"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := NewGerritDestinationImpl(&tt.dest)
+			_, err := dest.refsFor(map[string][]string{"Bug": {"42 43"}})
+			if err == nil {
+				t.Error("expected an error for an unsafe push option")
+			}
+		})
+	}
+}
+
+func TestGerritDestinationImplSubmit(t *testing.T) {
+	remote, fake := newGerritRemote(t)
+	dest := newTestGerritDestination(t, &GerritDestination{
+		url:           remote.url(),
+		fetch:         "main",
+		pushToRefsFor: "main",
+		submit:        true,
+	}, fake)
+
+	result, err := dest.Write(gerritResult(t, "one\n", "Submit\n", "ref"))
+	if err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if head := remote.git("rev-parse", "main"); head != result.DestinationRef {
+		t.Errorf("main = %s, want %s", head, result.DestinationRef)
+	}
+	if result.ChangeRequest != "" || len(fake.pushes) != 0 {
+		t.Errorf("submit should not upload for review: %q, %v", result.ChangeRequest, fake.pushes)
+	}
+	if !strings.Contains(remote.git("log", "-1", "--format=%B", "main"), "Change-Id: I") {
+		t.Error("submitted commit should have a Change-Id")
+	}
+}
@@ -0,0 +1,211 @@
+package git
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/albertocavalcante/starlark-go-copybara/vcs"
+)
+
+// Compile-time interface verification.
+var _ vcs.Origin = (*GerritOriginImpl)(nil)
+
+// Labels exposing the metadata of the migrated Gerrit change.
+const (
+	LabelGerritChangeNumber = "GERRIT_CHANGE_NUMBER"
+	LabelGerritChangeID     = "GERRIT_CHANGE_ID"
+	LabelGerritChangeURL    = "GERRIT_CHANGE_URL"
+	LabelGerritBranch       = "GERRIT_CHANGE_BRANCH"
+	LabelGerritTopic        = "GERRIT_CHANGE_TOPIC"
+	LabelGerritOwnerEmail   = "GERRIT_OWNER_EMAIL"
+	LabelGerritOwnerUser    = "GERRIT_OWNER_USERNAME"
+)
+
+var (
+	// gerritChangeRef matches refs/changes/NN/NNNNNN/P references.
+	gerritChangeRef = regexp.MustCompile(`^refs/changes/(\d{2})/(\d+)/(\d+)$`)
+
+	// gerritChangeWebURL matches the URL of a change, optionally with a
+	// patch set: https://host/c/project/+/123[/P] or https://host/#/c/123[/P].
+	gerritChangeWebURL = regexp.MustCompile(`^https?://[^/]+(?:/.*)?/(?:c/(.+)/\+|#/c)/(\d+)(?:/(\d+))?/?$`)
+)
+
+// GerritOriginImpl implements the vcs.Origin interface for Gerrit changes.
+//
+// Checkout accepts a refs/changes/NN/NNNNNN/P reference, a change number
+// or a change URL: the change is looked up through the Gerrit REST API and
+// the requested patch set, or the current one, is fetched. Other
+// references are resolved as in git.origin.
+type GerritOriginImpl struct {
+	*OriginImpl
+	gerrit *GerritOrigin
+	client GerritAPI
+	change *ChangeInfo
+}
+
+// NewGerritOriginImpl creates a new GerritOriginImpl from a GerritOrigin
+// configuration.
+func NewGerritOriginImpl(gerrit *GerritOrigin) *GerritOriginImpl {
+	return &GerritOriginImpl{
+		OriginImpl: NewOriginImpl(&Origin{
+			url:          gerrit.url,
+			ref:          gerrit.ref,
+			submodules:   gerrit.submodules,
+			firstParent:  gerrit.firstParent,
+			partialFetch: gerrit.partialFetch,
+		}),
+		gerrit: gerrit,
+		client: DefaultGerritClient(gerrit.url),
+	}
+}
+
+// WithGerritClient sets the client used to call the Gerrit API.
+func (g *GerritOriginImpl) WithGerritClient(client GerritAPI) *GerritOriginImpl {
+	g.client = client
+	return g
+}
+
+// WithRepoDir sets the directory of the local cache repository.
+func (g *GerritOriginImpl) WithRepoDir(dir string) *GerritOriginImpl {
+	g.OriginImpl.WithRepoDir(dir)
+	return g
+}
+
+// Change returns the change checked out, or nil.
+func (g *GerritOriginImpl) Change() *ChangeInfo {
+	return g.change
+}
+
+// Checkout resolves ref to a commit. Change references, numbers and URLs
+// are resolved to a patch set of the change.
+func (g *GerritOriginImpl) Checkout(ref string) error {
+	project, err := gerritProject(g.gerrit.url)
+	if err != nil {
+		return err
+	}
+	number, patchSet, ok, err := parseGerritChangeRef(ref, project)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		g.change = nil
+		return g.OriginImpl.Checkout(ref)
+	}
+
+	change, err := g.client.GetChange(strconv.Itoa(number))
+	if err != nil {
+		return fmt.Errorf("failed to get change %d: %w", number, err)
+	}
+	if g.gerrit.branch != "" && change.Branch != g.gerrit.branch {
+		return fmt.Errorf("change %d targets branch %q, but the origin only migrates changes for %q",
+			number, change.Branch, g.gerrit.branch)
+	}
+
+	local := gerritPatchSetRef(number, patchSet)
+	if patchSet == 0 {
+		current := change.Revisions[change.CurrentRevision]
+		if current == nil {
+			return fmt.Errorf("change %d has no current revision", number)
+		}
+		local = current.Ref
+	}
+
+	repo, err := g.Repo()
+	if err != nil {
+		return err
+	}
+	if err := repo.Fetch(originRemote, g.gerrit.partialFetch, "+"+local+":"+local); err != nil {
+		return fmt.Errorf("failed to fetch change %d: %w", number, err)
+	}
+	sha, err := repo.ResolveCommit(local)
+	if err != nil {
+		return err
+	}
+
+	g.change = change
+	g.resolved = sha
+	return nil
+}
+
+// parseGerritChangeRef returns the change number and patch set of ref,
+// which may be a refs/changes reference, a change number or a change URL
+// of project. The patch set is 0 when not given. ok is false for other
+// references.
+func parseGerritChangeRef(ref, project string) (number, patchSet int, ok bool, err error) {
+	if m := gerritChangeRef.FindStringSubmatch(ref); m != nil {
+		number, _ = strconv.Atoi(m[2])
+		patchSet, _ = strconv.Atoi(m[3])
+		if fmt.Sprintf("%02d", number%100) != m[1] {
+			return 0, 0, false, fmt.Errorf("invalid change reference %q", ref)
+		}
+		return number, patchSet, true, nil
+	}
+
+	if m := gerritChangeWebURL.FindStringSubmatch(ref); m != nil {
+		if m[1] != "" && m[1] != project {
+			return 0, 0, false, fmt.Errorf("change %s does not belong to %s", ref, project)
+		}
+		number, _ = strconv.Atoi(m[2])
+		if m[3] != "" {
+			patchSet, _ = strconv.Atoi(m[3])
+		}
+		return number, patchSet, true, nil
+	}
+
+	number, err = strconv.Atoi(ref)
+	if err != nil || number <= 0 {
+		return 0, 0, false, nil
+	}
+	return number, 0, true, nil
+}
+
+// gerritPatchSetRef returns the reference of a patch set of a change.
+func gerritPatchSetRef(number, patchSet int) string {
+	return fmt.Sprintf("refs/changes/%02d/%d/%d", number%100, number, patchSet)
+}
+
+// Changes returns the changes after baseline up to the checked out
+// reference. When a Gerrit change is checked out, its metadata is added to
+// the labels of the last change.
+func (g *GerritOriginImpl) Changes(baseline string) ([]*vcs.Change, error) {
+	changes, err := g.OriginImpl.Changes(baseline)
+	if err != nil || g.change == nil || len(changes) == 0 {
+		return changes, err
+	}
+
+	project, err := gerritProject(g.gerrit.url)
+	if err != nil {
+		return nil, err
+	}
+
+	last := changes[len(changes)-1]
+	if last.Labels == nil {
+		last.Labels = make(map[string][]string)
+	}
+	for name, values := range g.changeLabels(project) {
+		last.Labels[name] = append(last.Labels[name], values...)
+	}
+	return changes, nil
+}
+
+// changeLabels returns the labels describing the checked out change.
+func (g *GerritOriginImpl) changeLabels(project string) map[string][]string {
+	c := g.change
+	labels := map[string][]string{
+		LabelGerritChangeNumber: {strconv.Itoa(c.Number)},
+		LabelGerritChangeID:     {c.ChangeID},
+		LabelGerritChangeURL:    {gerritChangeURL(g.client, project, c.Number)},
+		LabelGerritBranch:       {c.Branch},
+	}
+	if c.Topic != "" {
+		labels[LabelGerritTopic] = []string{c.Topic}
+	}
+	if c.Owner.Email != "" {
+		labels[LabelGerritOwnerEmail] = []string{c.Owner.Email}
+	}
+	if c.Owner.Username != "" {
+		labels[LabelGerritOwnerUser] = []string{c.Owner.Username}
+	}
+	return labels
+}
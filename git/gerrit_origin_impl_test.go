@@ -0,0 +1,149 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// newGerritOriginRepo creates a repository at <tmp>/project with a commit
+// on main and change 1 with two patch sets on top of it.
+func newGerritOriginRepo(t *testing.T) (repo *testRepo, fake *fakeGerrit, ps1, ps2 string) {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "project")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	repo = &testRepo{t: t, dir: dir}
+	repo.git("init", "--quiet", "--initial-branch=main")
+	base := repo.commit("Initial", map[string]string{"a.txt": "a\n"})
+
+	ps1 = repo.commit("Change\n\nChange-Id: I0123", map[string]string{"a.txt": "one\n"})
+	repo.git("reset", "--quiet", "--hard", base)
+	ps2 = repo.commit("Change\n\nChange-Id: I0123", map[string]string{"a.txt": "two\n"})
+	repo.git("reset", "--quiet", "--hard", base)
+
+	project, err := gerritProject(repo.url())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake = newFakeGerrit(t, project, repo)
+	c := fake.addChange(1, "I0123", "main", ps1, ps2)
+	c.Topic = "feature"
+	c.Owner = AccountInfo{Name: "Owner", Email: "owner@example.com", Username: "owner"}
+	return repo, fake, ps1, ps2
+}
+
+// newTestGerritOrigin returns a Gerrit origin implementation using a
+// private cache directory and the fake API.
+func newTestGerritOrigin(t *testing.T, origin *GerritOrigin, fake *fakeGerrit) *GerritOriginImpl {
+	t.Helper()
+	return origin.Impl().WithGerritClient(fake.client()).WithRepoDir(filepath.Join(t.TempDir(), "cache"))
+}
+
+func TestGerritOriginImplCheckout(t *testing.T) {
+	repo, fake, ps1, ps2 := newGerritOriginRepo(t)
+	project := fake.project
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{ref: "1", want: ps2},
+		{ref: "refs/changes/01/1/1", want: ps1},
+		{ref: "refs/changes/01/1/2", want: ps2},
+		{ref: "https://gerrit.example.com/c/" + project + "/+/1", want: ps2},
+		{ref: "https://gerrit.example.com/c/" + project + "/+/1/1", want: ps1},
+		{ref: "https://gerrit.example.com/#/c/1/", want: ps2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			origin := newTestGerritOrigin(t, &GerritOrigin{url: repo.url(), ref: "main", firstParent: true}, fake)
+			if err := origin.Checkout(tt.ref); err != nil {
+				t.Fatalf("Checkout(%q) error: %v", tt.ref, err)
+			}
+			if origin.Ref() != tt.want {
+				t.Errorf("Ref() = %s, want %s", origin.Ref(), tt.want)
+			}
+			if origin.Change() == nil || origin.Change().Number != 1 {
+				t.Errorf("Change() = %+v", origin.Change())
+			}
+		})
+	}
+
+	t.Run("labels", func(t *testing.T) {
+		origin := newTestGerritOrigin(t, &GerritOrigin{url: repo.url(), ref: "main", firstParent: true}, fake)
+		if err := origin.Checkout("1"); err != nil {
+			t.Fatalf("Checkout() error: %v", err)
+		}
+		changes, err := origin.Changes("")
+		if err != nil {
+			t.Fatalf("Changes() error: %v", err)
+		}
+		labels := changes[len(changes)-1].Labels
+		want := map[string][]string{
+			"Change-Id":             {"I0123"},
+			LabelGerritChangeNumber: {"1"},
+			LabelGerritChangeID:     {"I0123"},
+			LabelGerritChangeURL:    {fake.server.URL + "/c/" + project + "/+/1"},
+			LabelGerritBranch:       {"main"},
+			LabelGerritTopic:        {"feature"},
+			LabelGerritOwnerEmail:   {"owner@example.com"},
+			LabelGerritOwnerUser:    {"owner"},
+		}
+		for name, values := range want {
+			if !slices.Equal(labels[name], values) {
+				t.Errorf("label %s = %v, want %v", name, labels[name], values)
+			}
+		}
+	})
+
+	t.Run("branch filter", func(t *testing.T) {
+		origin := newTestGerritOrigin(t, &GerritOrigin{url: repo.url(), ref: "main", branch: "release"}, fake)
+		if err := origin.Checkout("1"); err == nil {
+			t.Error("expected an error for a change of another branch")
+		}
+	})
+
+	t.Run("other project", func(t *testing.T) {
+		origin := newTestGerritOrigin(t, &GerritOrigin{url: repo.url(), ref: "main"}, fake)
+		if err := origin.Checkout("https://gerrit.example.com/c/other/+/1"); err == nil {
+			t.Error("expected an error for a change of another project")
+		}
+	})
+
+	t.Run("branch", func(t *testing.T) {
+		origin := newTestGerritOrigin(t, &GerritOrigin{url: repo.url(), ref: "main"}, fake)
+		if err := origin.Checkout("main"); err != nil {
+			t.Fatalf("Checkout(main) error: %v", err)
+		}
+		if origin.Change() != nil || origin.Ref() != repo.git("rev-parse", "main") {
+			t.Errorf("branch checkout resolved to %s", origin.Ref())
+		}
+	})
+}
+
+func TestParseGerritChangeRef(t *testing.T) {
+	tests := []struct {
+		ref          string
+		wantNumber   int
+		wantPatchSet int
+		wantOK       bool
+		wantErr      bool
+	}{
+		{ref: "refs/changes/34/1234/5", wantNumber: 1234, wantPatchSet: 5, wantOK: true},
+		{ref: "refs/changes/01/1234/5", wantErr: true},
+		{ref: "1234", wantNumber: 1234, wantOK: true},
+		{ref: "https://host/c/p/+/1234/2", wantNumber: 1234, wantPatchSet: 2, wantOK: true},
+		{ref: "https://host/c/other/+/1234", wantErr: true},
+		{ref: "main"},
+		{ref: "refs/heads/main"},
+	}
+	for _, tt := range tests {
+		number, patchSet, ok, err := parseGerritChangeRef(tt.ref, "p")
+		if (err != nil) != tt.wantErr || number != tt.wantNumber || patchSet != tt.wantPatchSet || ok != tt.wantOK {
+			t.Errorf("parseGerritChangeRef(%q) = %d, %d, %v, %v", tt.ref, number, patchSet, ok, err)
+		}
+	}
+}
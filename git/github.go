@@ -160,6 +160,12 @@ func (g *GitHubOrigin) PrimaryBranchMigration() bool {
 	return g.primaryBranchMigration
 }
 
+// Impl returns an implementation of the GitHubOrigin that can read pull
+// requests.
+func (g *GitHubOrigin) Impl() *GitHubOriginImpl {
+	return NewGitHubOriginImpl(g)
+}
+
 // Attr implements starlark.HasAttrs.
 func (g *GitHubOrigin) Attr(name string) (starlark.Value, error) {
 	switch name {
@@ -301,6 +307,12 @@ func (g *GitHubPrDestination) Integrates() []*IntegrateChanges {
 	return g.integrates
 }
 
+// Impl returns an implementation of the GitHubPrDestination that can push
+// branches and open pull requests.
+func (g *GitHubPrDestination) Impl() *GitHubPrDestinationImpl {
+	return NewGitHubPrDestinationImpl(g)
+}
+
 // Attr implements starlark.HasAttrs.
 func (g *GitHubPrDestination) Attr(name string) (starlark.Value, error) {
 	switch name {
@@ -0,0 +1,272 @@
+package git
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultGitHubAPIURL is the base URL of the public GitHub REST API.
+const DefaultGitHubAPIURL = "https://api.github.com"
+
+// GitHubAPI is the subset of the GitHub REST API used by the GitHub origins
+// and destinations. Repositories are given as "owner/name".
+type GitHubAPI interface {
+	// ListPullRequests returns the pull requests of repo whose head is
+	// "owner:branch" and whose state is "open", "closed" or "all".
+	ListPullRequests(repo, head, state string) ([]*PullRequest, error)
+
+	// CreatePullRequest opens a pull request.
+	CreatePullRequest(repo string, req *CreatePullRequestRequest) (*PullRequest, error)
+
+	// UpdatePullRequest updates the title and body of a pull request.
+	UpdatePullRequest(repo string, number int, req *UpdatePullRequestRequest) (*PullRequest, error)
+
+	// GetPullRequest returns a pull request by number.
+	GetPullRequest(repo string, number int) (*PullRequest, error)
+
+	// ListReviews returns the reviews of a pull request, oldest first.
+	ListReviews(repo string, number int) ([]*Review, error)
+}
+
+// PullRequest is a GitHub pull request.
+type PullRequest struct {
+	Number  int           `json:"number"`
+	State   string        `json:"state"`
+	Title   string        `json:"title"`
+	Body    string        `json:"body"`
+	Draft   bool          `json:"draft"`
+	HTMLURL string        `json:"html_url"`
+	User    GitHubUser    `json:"user"`
+	Head    GitHubRef     `json:"head"`
+	Base    GitHubRef     `json:"base"`
+	Labels  []GitHubLabel `json:"labels"`
+}
+
+// GitHubUser is a GitHub account.
+type GitHubUser struct {
+	Login string `json:"login"`
+}
+
+// GitHubRef is the head or base of a pull request.
+type GitHubRef struct {
+	Ref string `json:"ref"`
+	SHA string `json:"sha"`
+}
+
+// GitHubLabel is a label of an issue or pull request.
+type GitHubLabel struct {
+	Name string `json:"name"`
+}
+
+// Review is a pull request review.
+type Review struct {
+	User     GitHubUser `json:"user"`
+	State    string     `json:"state"`
+	CommitID string     `json:"commit_id"`
+}
+
+// CreatePullRequestRequest is the payload to open a pull request.
+type CreatePullRequestRequest struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	Head  string `json:"head"`
+	Base  string `json:"base"`
+	Draft bool   `json:"draft"`
+}
+
+// UpdatePullRequestRequest is the payload to update a pull request.
+type UpdatePullRequestRequest struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// GitHubClient is a GitHubAPI implementation using the GitHub REST API.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/git/github/api/GitHubApi.java
+type GitHubClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// Compile-time interface verification.
+var _ GitHubAPI = (*GitHubClient)(nil)
+
+// NewGitHubClient creates a client for the API at baseURL. An empty token
+// sends unauthenticated requests.
+func NewGitHubClient(baseURL, token string) *GitHubClient {
+	return &GitHubClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// DefaultGitHubClient creates a client configured by the GITHUB_API_URL
+// and GITHUB_TOKEN environment variables.
+func DefaultGitHubClient() *GitHubClient {
+	baseURL := os.Getenv("GITHUB_API_URL")
+	if baseURL == "" {
+		baseURL = DefaultGitHubAPIURL
+	}
+	return NewGitHubClient(baseURL, os.Getenv("GITHUB_TOKEN"))
+}
+
+// ListPullRequests implements GitHubAPI.
+func (c *GitHubClient) ListPullRequests(repo, head, state string) ([]*PullRequest, error) {
+	query := url.Values{"head": {head}, "state": {state}}
+	var prs []*PullRequest
+	if err := c.do(http.MethodGet, "/repos/"+repo+"/pulls?"+query.Encode(), nil, &prs); err != nil {
+		return nil, err
+	}
+	return prs, nil
+}
+
+// CreatePullRequest implements GitHubAPI.
+func (c *GitHubClient) CreatePullRequest(repo string, req *CreatePullRequestRequest) (*PullRequest, error) {
+	var pr PullRequest
+	if err := c.do(http.MethodPost, "/repos/"+repo+"/pulls", req, &pr); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+// UpdatePullRequest implements GitHubAPI.
+func (c *GitHubClient) UpdatePullRequest(repo string, number int, req *UpdatePullRequestRequest) (*PullRequest, error) {
+	var pr PullRequest
+	if err := c.do(http.MethodPatch, fmt.Sprintf("/repos/%s/pulls/%d", repo, number), req, &pr); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+// GetPullRequest implements GitHubAPI.
+func (c *GitHubClient) GetPullRequest(repo string, number int) (*PullRequest, error) {
+	var pr PullRequest
+	if err := c.do(http.MethodGet, fmt.Sprintf("/repos/%s/pulls/%d", repo, number), nil, &pr); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+// ListReviews implements GitHubAPI. The pages of reviews are followed
+// through the Link response headers.
+func (c *GitHubClient) ListReviews(repo string, number int) ([]*Review, error) {
+	var reviews []*Review
+	path := fmt.Sprintf("/repos/%s/pulls/%d/reviews?per_page=100", repo, number)
+	for path != "" {
+		var page []*Review
+		header, err := c.request(http.MethodGet, path, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, page...)
+		if path, err = c.nextPage(header); err != nil {
+			return nil, err
+		}
+	}
+	return reviews, nil
+}
+
+// linkNext matches the rel="next" URL of a Link header.
+var linkNext = regexp.MustCompile(`<([^>]*)>\s*;\s*rel="next"`)
+
+// nextPage returns the path of the next page announced by the Link header,
+// or "" on the last page. Links outside the API base URL are rejected, so
+// that the token is never sent to another host.
+func (c *GitHubClient) nextPage(header http.Header) (string, error) {
+	for _, link := range header.Values("Link") {
+		m := linkNext.FindStringSubmatch(link)
+		if m == nil {
+			continue
+		}
+		path, ok := strings.CutPrefix(m[1], c.baseURL)
+		if !ok || !strings.HasPrefix(path, "/") {
+			return "", fmt.Errorf("github: next page %q is outside %s", m[1], c.baseURL)
+		}
+		return path, nil
+	}
+	return "", nil
+}
+
+// do sends a request with an optional JSON body and decodes the JSON
+// response into out.
+func (c *GitHubClient) do(method, path string, body, out any) error {
+	_, err := c.request(method, path, body, out)
+	return err
+}
+
+// request is like do, and also returns the response headers.
+func (c *GitHubClient) request(method, path string, body, out any) (http.Header, error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("github: %s %s: %w", method, path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("github: %s %s: %w", method, path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(data, &apiErr)
+		return nil, fmt.Errorf("github: %s %s: %s: %s", method, path, resp.Status, apiErr.Message)
+	}
+	if out == nil {
+		return resp.Header, nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return nil, fmt.Errorf("github: %s %s: invalid response: %w", method, path, err)
+	}
+	return resp.Header, nil
+}
+
+// gitHubRepoName returns the "owner/name" of a repository URL such as
+// https://github.com/owner/name.git.
+func gitHubRepoName(repoURL string) (string, error) {
+	p := repoURL
+	if u, err := url.Parse(repoURL); err == nil && u.Scheme != "" {
+		p = u.Path
+	} else if _, after, ok := strings.Cut(repoURL, ":"); ok {
+		// scp-like syntax: git@github.com:owner/name.git
+		p = after
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimSuffix(p, ".git"), "/"), "/")
+	if len(parts) < 2 || parts[len(parts)-2] == "" || parts[len(parts)-1] == "" {
+		return "", fmt.Errorf("cannot find the GitHub repository name in %q", repoURL)
+	}
+	return parts[len(parts)-2] + "/" + parts[len(parts)-1], nil
+}
@@ -0,0 +1,223 @@
+package git
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeGitHub is an in-memory GitHub REST API serving the pull requests of
+// a single repository.
+type fakeGitHub struct {
+	t      *testing.T
+	repo   string
+	server *httptest.Server
+
+	mu      sync.Mutex
+	prs     []*PullRequest
+	reviews map[int][]*Review
+	calls   []string
+
+	// pageSize, when set, splits the reviews into pages linked by Link
+	// headers.
+	pageSize int
+}
+
+// newFakeGitHub starts a fake GitHub API for repo ("owner/name").
+func newFakeGitHub(t *testing.T, repo string) *fakeGitHub {
+	t.Helper()
+	f := &fakeGitHub{t: t, repo: repo, reviews: make(map[int][]*Review)}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// client returns a client for the fake API.
+func (f *fakeGitHub) client() *GitHubClient {
+	return NewGitHubClient(f.server.URL, "secret")
+}
+
+func (f *fakeGitHub) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, r.Method+" "+r.URL.Path)
+
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "Bad credentials"})
+		return
+	}
+
+	prefix := "/repos/" + f.repo + "/pulls"
+	rest, ok := strings.CutPrefix(r.URL.Path, prefix)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		head, state := r.URL.Query().Get("head"), r.URL.Query().Get("state")
+		matches := []*PullRequest{}
+		for _, pr := range f.prs {
+			if (head == "" || f.owner()+":"+pr.Head.Ref == head) && (state == "all" || pr.State == state) {
+				matches = append(matches, pr)
+			}
+		}
+		writeJSON(w, http.StatusOK, matches)
+
+	case rest == "" && r.Method == http.MethodPost:
+		var req CreatePullRequestRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+			return
+		}
+		pr := &PullRequest{
+			Number:  len(f.prs) + 1,
+			State:   "open",
+			Title:   req.Title,
+			Body:    req.Body,
+			Draft:   req.Draft,
+			HTMLURL: fmt.Sprintf("https://github.com/%s/pull/%d", f.repo, len(f.prs)+1),
+			Head:    GitHubRef{Ref: req.Head},
+			Base:    GitHubRef{Ref: req.Base},
+		}
+		f.prs = append(f.prs, pr)
+		writeJSON(w, http.StatusCreated, pr)
+
+	case strings.HasSuffix(rest, "/reviews") && r.Method == http.MethodGet:
+		pr := f.find(strings.TrimSuffix(rest, "/reviews"))
+		if pr == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+			return
+		}
+		reviews := f.reviews[pr.Number]
+		if reviews == nil {
+			reviews = []*Review{}
+		}
+		if f.pageSize > 0 {
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			page = max(page, 1)
+			start := min((page-1)*f.pageSize, len(reviews))
+			end := min(start+f.pageSize, len(reviews))
+			if end < len(reviews) {
+				w.Header().Set("Link", fmt.Sprintf(`<%s%s?page=%d>; rel="next", <%s%s?page=%d>; rel="last"`,
+					f.server.URL, r.URL.Path, page+1, f.server.URL, r.URL.Path, (len(reviews)+f.pageSize-1)/f.pageSize))
+			}
+			reviews = reviews[start:end]
+		}
+		writeJSON(w, http.StatusOK, reviews)
+
+	case r.Method == http.MethodGet:
+		pr := f.find(rest)
+		if pr == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+			return
+		}
+		writeJSON(w, http.StatusOK, pr)
+
+	case r.Method == http.MethodPatch:
+		pr := f.find(rest)
+		if pr == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+			return
+		}
+		var req UpdatePullRequestRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+			return
+		}
+		pr.Title, pr.Body = req.Title, req.Body
+		writeJSON(w, http.StatusOK, pr)
+
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"message": "Method Not Allowed"})
+	}
+}
+
+// owner returns the repository owner.
+func (f *fakeGitHub) owner() string {
+	owner, _, _ := strings.Cut(f.repo, "/")
+	return owner
+}
+
+// find returns the pull request for a "/<number>" path suffix.
+func (f *fakeGitHub) find(suffix string) *PullRequest {
+	number, err := strconv.Atoi(strings.TrimPrefix(suffix, "/"))
+	if err != nil {
+		return nil
+	}
+	for _, pr := range f.prs {
+		if pr.Number == number {
+			return pr
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestGitHubClientError(t *testing.T) {
+	fake := newFakeGitHub(t, "octo/project")
+
+	_, err := NewGitHubClient(fake.server.URL, "wrong").ListPullRequests("octo/project", "octo:branch", "open")
+	if err == nil || !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "Bad credentials") {
+		t.Errorf("expected an authentication error, got %v", err)
+	}
+}
+
+func TestGitHubClientListReviewsPages(t *testing.T) {
+	fake := newFakeGitHub(t, "octo/project")
+	fake.pageSize = 2
+	fake.prs = []*PullRequest{{Number: 1, State: "open"}}
+	for i := range 5 {
+		fake.reviews[1] = append(fake.reviews[1], &Review{State: "COMMENTED", CommitID: strconv.Itoa(i)})
+	}
+
+	reviews, err := fake.client().ListReviews("octo/project", 1)
+	if err != nil {
+		t.Fatalf("ListReviews() error: %v", err)
+	}
+	if len(reviews) != 5 || reviews[4].CommitID != "4" {
+		t.Errorf("got %d reviews, want all 5", len(reviews))
+	}
+	if len(fake.calls) != 3 {
+		t.Errorf("expected 3 requests, got %v", fake.calls)
+	}
+}
+
+func TestGitHubClientNextPageOtherHost(t *testing.T) {
+	client := NewGitHubClient("https://api.github.com", "secret")
+	header := http.Header{"Link": {`<https://evil.example.com/reviews?page=2>; rel="next"`}}
+	if _, err := client.nextPage(header); err == nil {
+		t.Error("expected an error for a next page on another host")
+	}
+}
+
+func TestGitHubRepoName(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{"https://github.com/octo/project", "octo/project", false},
+		{"https://github.com/octo/project.git", "octo/project", false},
+		{"git@github.com:octo/project.git", "octo/project", false},
+		{"file:///tmp/x/octo/project", "octo/project", false},
+		{"https://github.com/", "", true},
+	}
+	for _, tt := range tests {
+		got, err := gitHubRepoName(tt.url)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("gitHubRepoName(%q) = %q, %v", tt.url, got, err)
+		}
+	}
+}
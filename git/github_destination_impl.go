@@ -0,0 +1,193 @@
+package git
+
+import (
+	"crypto/sha1" //nolint:gosec // used to derive branch names
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+	"github.com/albertocavalcante/starlark-go-copybara/vcs"
+)
+
+// Compile-time interface verification.
+var (
+	_ vcs.Destination         = (*GitHubPrDestinationImpl)(nil)
+	_ vcs.ChangeRequestWriter = (*GitHubPrDestinationImpl)(nil)
+)
+
+// defaultPrBranch returns the branch pushed when pr_branch is not set.
+//
+// The branch is derived from the workflow and the context reference, so
+// each change request gets its own branch and pull request, and later runs
+// for the same change request update them.
+func defaultPrBranch(result *vcs.TransformResult) string {
+	contextRef := result.ContextRef
+	if contextRef == "" {
+		contextRef = result.OriginRef
+	}
+	sum := sha1.Sum([]byte(result.Workflow + "\x00" + contextRef)) //nolint:gosec // branch names are not security sensitive
+	return "copybara/push-" + hex.EncodeToString(sum[:])[:16]
+}
+
+// GitHubPrDestinationImpl implements the vcs.Destination interface for
+// GitHub pull requests.
+//
+// Each write commits the transformed tree on top of destination_ref, force
+// pushes it to pr_branch and opens a pull request from pr_branch, or
+// updates the one already open.
+type GitHubPrDestinationImpl struct {
+	*DestinationImpl
+	pr     *GitHubPrDestination
+	client GitHubAPI
+}
+
+// NewGitHubPrDestinationImpl creates a new GitHubPrDestinationImpl from a
+// GitHubPrDestination configuration.
+func NewGitHubPrDestinationImpl(pr *GitHubPrDestination) *GitHubPrDestinationImpl {
+	dest := NewDestinationImpl(&Destination{
+		url:        pr.url,
+		fetch:      pr.destinationRef,
+		integrates: pr.integrates,
+	})
+	dest.forcePush = true
+	return &GitHubPrDestinationImpl{
+		DestinationImpl: dest,
+		pr:              pr,
+		client:          DefaultGitHubClient(),
+	}
+}
+
+// WithGitHubClient sets the client used to call the GitHub API.
+func (g *GitHubPrDestinationImpl) WithGitHubClient(client GitHubAPI) *GitHubPrDestinationImpl {
+	g.client = client
+	return g
+}
+
+// WithRepoDir sets the directory of the local cache repository.
+func (g *GitHubPrDestinationImpl) WithRepoDir(dir string) *GitHubPrDestinationImpl {
+	g.DestinationImpl.WithRepoDir(dir)
+	return g
+}
+
+// Write commits the transformed tree on top of destination_ref and opens
+// or updates the pull request.
+func (g *GitHubPrDestinationImpl) Write(result *vcs.TransformResult) (*vcs.WriteResult, error) {
+	return g.write(result, func() (*vcs.WriteResult, error) {
+		return g.DestinationImpl.Write(result)
+	})
+}
+
+// WriteChangeRequest commits the transformed tree on top of the destination
+// revision baseline and opens or updates the pull request.
+func (g *GitHubPrDestinationImpl) WriteChangeRequest(baseline string, result *vcs.TransformResult) (*vcs.WriteResult, error) {
+	return g.write(result, func() (*vcs.WriteResult, error) {
+		return g.DestinationImpl.WriteChangeRequest(baseline, result)
+	})
+}
+
+// write pushes the pull request branch with push and creates or updates
+// the pull request.
+func (g *GitHubPrDestinationImpl) write(result *vcs.TransformResult, push func() (*vcs.WriteResult, error)) (*vcs.WriteResult, error) {
+	repo, err := gitHubRepoName(g.pr.url)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := prLabels(result)
+	branch := g.pr.prBranch
+	if branch == "" {
+		branch = defaultPrBranch(result)
+	}
+	if branch, err = expandTemplate(branch, labels); err != nil {
+		return nil, fmt.Errorf("pr_branch: %w", err)
+	}
+	g.destination.push = branch
+
+	writeResult, err := push()
+	if err != nil {
+		return nil, err
+	}
+	if writeResult.Empty() || result.DryRun || writeResult.DestinationRef == "" {
+		return writeResult, nil
+	}
+
+	title, body, err := g.description(result.Message, labels)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, _, _ := strings.Cut(repo, "/")
+	prs, err := g.client.ListPullRequests(repo, owner+":"+branch, "open")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find pull requests for %s: %w", branch, err)
+	}
+
+	var pr *PullRequest
+	switch {
+	case len(prs) == 0:
+		pr, err = g.client.CreatePullRequest(repo, &CreatePullRequestRequest{
+			Title: title,
+			Body:  body,
+			Head:  branch,
+			Base:  g.pr.destinationRef,
+			Draft: g.pr.draft,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create pull request: %w", err)
+		}
+	case g.pr.updateDescription:
+		pr, err = g.client.UpdatePullRequest(repo, prs[0].Number, &UpdatePullRequestRequest{Title: title, Body: body})
+		if err != nil {
+			return nil, fmt.Errorf("failed to update pull request #%d: %w", prs[0].Number, err)
+		}
+	default:
+		pr = prs[0]
+	}
+
+	writeResult.ChangeRequest = pr.HTMLURL
+	if writeResult.ChangeRequest == "" {
+		writeResult.ChangeRequest = fmt.Sprintf("%s#%d", repo, pr.Number)
+	}
+	return writeResult, nil
+}
+
+// description returns the pull request title and body. They default to the
+// first line and the rest of the message.
+func (g *GitHubPrDestinationImpl) description(message string, labels map[string][]string) (string, string, error) {
+	firstLine, rest, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	title, body := firstLine, strings.TrimSpace(rest)
+
+	var err error
+	if g.pr.title != "" {
+		if title, err = expandTemplate(g.pr.title, labels); err != nil {
+			return "", "", fmt.Errorf("title: %w", err)
+		}
+	}
+	if g.pr.body != "" {
+		if body, err = expandTemplate(g.pr.body, labels); err != nil {
+			return "", "", fmt.Errorf("body: %w", err)
+		}
+	}
+	return title, body, nil
+}
+
+// prLabels returns the labels available to pull request templates: the
+// labels of the message and of the migrated changes, and the origin
+// revision label.
+func prLabels(result *vcs.TransformResult) map[string][]string {
+	labels := transform.ParseLabels(result.Message)
+	for _, c := range result.Changes {
+		for name, values := range c.Labels {
+			labels[name] = append(labels[name], values...)
+		}
+	}
+	if result.OriginRef != "" {
+		label := result.RevIDLabel
+		if label == "" {
+			label = OriginRevIDLabel
+		}
+		labels[label] = append(labels[label], result.OriginRef)
+	}
+	return labels
+}
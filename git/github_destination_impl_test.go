@@ -0,0 +1,151 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/albertocavalcante/starlark-go-copybara/vcs"
+)
+
+// newGitHubRemote creates a bare repository at <tmp>/octo/project with a
+// "main" branch, so that its URL names the octo/project repository.
+func newGitHubRemote(t *testing.T) *testRepo {
+	t.Helper()
+	seed := newTestRepo(t)
+	seed.commit("Initial", map[string]string{"README.md": "readme\n"})
+
+	dir := filepath.Join(t.TempDir(), "octo", "project")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	remote := &testRepo{t: t, dir: dir}
+	remote.git("init", "--quiet", "--bare", "--initial-branch=main")
+	seed.git("push", "--quiet", remote.url(), "main")
+	return remote
+}
+
+func TestGitHubPrDestinationImplWrite(t *testing.T) {
+	remote := newGitHubRemote(t)
+	fake := newFakeGitHub(t, "octo/project")
+
+	dest := (&GitHubPrDestination{
+		url:               remote.url(),
+		destinationRef:    "main",
+		prBranch:          "import/${Bug}",
+		title:             "Import ${Bug}",
+		draft:             true,
+		updateDescription: true,
+	}).Impl().WithGitHubClient(fake.client()).WithRepoDir(filepath.Join(t.TempDir(), "cache"))
+
+	write := func(content, ref string) *vcs.WriteResult {
+		t.Helper()
+		result, err := dest.Write(&vcs.TransformResult{
+			WorkDir:   workDir(t, map[string]string{"README.md": "readme\n", "a.txt": content}),
+			OriginRef: ref,
+			Message:   "Fix things\n\nDetails for " + ref + "\n\nBug: 42\n",
+			Author:    "A <a@example.com>",
+		})
+		if err != nil {
+			t.Fatalf("Write() error: %v", err)
+		}
+		return result
+	}
+
+	first := write("one\n", "r1")
+	if first.ChangeRequest != "https://github.com/octo/project/pull/1" {
+		t.Errorf("ChangeRequest = %q", first.ChangeRequest)
+	}
+	if head := remote.git("rev-parse", "import/42"); head != first.DestinationRef {
+		t.Errorf("import/42 = %s, want %s", head, first.DestinationRef)
+	}
+	if parent := remote.git("rev-parse", "import/42^"); parent != remote.git("rev-parse", "main") {
+		t.Errorf("PR commit should be based on main, parent is %s", parent)
+	}
+
+	if len(fake.prs) != 1 {
+		t.Fatalf("got %d pull requests, want 1", len(fake.prs))
+	}
+	pr := fake.prs[0]
+	if pr.Title != "Import 42" || pr.Body != "Details for r1\n\nBug: 42" || !pr.Draft || pr.Base.Ref != "main" || pr.Head.Ref != "import/42" {
+		t.Errorf("unexpected pull request: %+v", pr)
+	}
+
+	// A second write force-pushes the branch and updates the same pull request.
+	second := write("two\n", "r2")
+	if second.ChangeRequest != first.ChangeRequest || len(fake.prs) != 1 {
+		t.Errorf("expected the pull request to be updated, got %q and %d PRs", second.ChangeRequest, len(fake.prs))
+	}
+	if head := remote.git("rev-parse", "import/42"); head != second.DestinationRef {
+		t.Errorf("import/42 = %s, want %s", head, second.DestinationRef)
+	}
+	if pr.Body != "Details for r2\n\nBug: 42" {
+		t.Errorf("description not updated: %q", pr.Body)
+	}
+}
+
+func TestGitHubPrDestinationImplDefaultBranch(t *testing.T) {
+	remote := newGitHubRemote(t)
+	fake := newFakeGitHub(t, "octo/project")
+
+	dest := (&GitHubPrDestination{url: remote.url(), destinationRef: "main"}).
+		Impl().WithGitHubClient(fake.client()).WithRepoDir(filepath.Join(t.TempDir(), "cache"))
+
+	write := func(content, contextRef string) *vcs.WriteResult {
+		t.Helper()
+		result, err := dest.Write(&vcs.TransformResult{
+			WorkDir:    workDir(t, map[string]string{"a.txt": content}),
+			OriginRef:  "r-" + content,
+			ContextRef: contextRef,
+			Workflow:   "default",
+			Message:    "Change " + contextRef,
+			Author:     "A <a@example.com>",
+		})
+		if err != nil {
+			t.Fatalf("Write() error: %v", err)
+		}
+		return result
+	}
+
+	first := write("one\n", "refs/pull/1/head")
+	second := write("two\n", "refs/pull/2/head")
+	if first.ChangeRequest == second.ChangeRequest || len(fake.prs) != 2 {
+		t.Fatalf("expected one pull request per context ref, got %q, %q and %d PRs", first.ChangeRequest, second.ChangeRequest, len(fake.prs))
+	}
+	if fake.prs[0].Head.Ref == fake.prs[1].Head.Ref {
+		t.Errorf("both pull requests use branch %q", fake.prs[0].Head.Ref)
+	}
+	if !strings.HasPrefix(fake.prs[0].Head.Ref, "copybara/push-") {
+		t.Errorf("unexpected default branch %q", fake.prs[0].Head.Ref)
+	}
+
+	// Rerunning for the same context ref updates its pull request.
+	third := write("three\n", "refs/pull/1/head")
+	if third.ChangeRequest != first.ChangeRequest || len(fake.prs) != 2 {
+		t.Errorf("expected %q to be updated, got %q and %d PRs", first.ChangeRequest, third.ChangeRequest, len(fake.prs))
+	}
+	if head := remote.git("rev-parse", fake.prs[0].Head.Ref); head != third.DestinationRef {
+		t.Errorf("%s = %s, want %s", fake.prs[0].Head.Ref, head, third.DestinationRef)
+	}
+}
+
+func TestGitHubPrDestinationImplMissingLabel(t *testing.T) {
+	remote := newGitHubRemote(t)
+	fake := newFakeGitHub(t, "octo/project")
+
+	dest := (&GitHubPrDestination{url: remote.url(), destinationRef: "main", prBranch: "import/${Missing}"}).
+		Impl().WithGitHubClient(fake.client()).WithRepoDir(filepath.Join(t.TempDir(), "cache"))
+
+	_, err := dest.Write(&vcs.TransformResult{
+		WorkDir: workDir(t, map[string]string{"a.txt": "a\n"}),
+		Message: "Change",
+		Author:  "A <a@example.com>",
+	})
+	if err == nil {
+		t.Fatal("expected a pr_branch template error")
+	}
+	if len(fake.calls) != 0 {
+		t.Errorf("no API call expected, got %v", fake.calls)
+	}
+}
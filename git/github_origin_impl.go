@@ -0,0 +1,240 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/albertocavalcante/starlark-go-copybara/vcs"
+)
+
+// Compile-time interface verification.
+var _ vcs.Origin = (*GitHubOriginImpl)(nil)
+
+// Labels exposing the metadata of the migrated pull request.
+const (
+	LabelPRNumber     = "GITHUB_PR_NUMBER"
+	LabelPRTitle      = "GITHUB_PR_TITLE"
+	LabelPRUser       = "GITHUB_PR_USER"
+	LabelPRURL        = "GITHUB_PR_URL"
+	LabelPRLabel      = "GITHUB_PR_LABEL"
+	LabelPRHeadSHA    = "GITHUB_PR_HEAD_SHA"
+	LabelPRBaseBranch = "GITHUB_BASE_BRANCH"
+)
+
+// ErrPullRequestRejected is returned when a pull request does not match
+// the state or review_state of the origin.
+var ErrPullRequestRejected = errors.New("pull request rejected")
+
+// pullRequestURL matches the URL of a GitHub pull request.
+var pullRequestURL = regexp.MustCompile(`^https?://[^/]+/([^/]+/[^/]+)/pull/(\d+)/?$`)
+
+// GitHubOriginImpl implements the vcs.Origin interface for GitHub pull
+// requests.
+//
+// Checkout accepts a pull request number or URL: the pull request is
+// looked up through the GitHub API, checked against the state and
+// review_state filters, and its head is fetched from refs/pull/N/head.
+// Other references are resolved as in git.origin.
+type GitHubOriginImpl struct {
+	*OriginImpl
+	github *GitHubOrigin
+	client GitHubAPI
+	pr     *PullRequest
+}
+
+// NewGitHubOriginImpl creates a new GitHubOriginImpl from a GitHubOrigin configuration.
+func NewGitHubOriginImpl(github *GitHubOrigin) *GitHubOriginImpl {
+	return &GitHubOriginImpl{
+		OriginImpl: NewOriginImpl(&Origin{
+			url:          github.url,
+			ref:          github.ref,
+			submodules:   github.submodules,
+			firstParent:  github.firstParent,
+			partialFetch: github.partialFetch,
+		}),
+		github: github,
+		client: DefaultGitHubClient(),
+	}
+}
+
+// WithGitHubClient sets the client used to call the GitHub API.
+func (g *GitHubOriginImpl) WithGitHubClient(client GitHubAPI) *GitHubOriginImpl {
+	g.client = client
+	return g
+}
+
+// WithRepoDir sets the directory of the local cache repository.
+func (g *GitHubOriginImpl) WithRepoDir(dir string) *GitHubOriginImpl {
+	g.OriginImpl.WithRepoDir(dir)
+	return g
+}
+
+// PullRequest returns the pull request checked out, or nil.
+func (g *GitHubOriginImpl) PullRequest() *PullRequest {
+	return g.pr
+}
+
+// Checkout resolves ref to a commit. Pull request numbers and URLs are
+// resolved to the head of the pull request.
+func (g *GitHubOriginImpl) Checkout(ref string) error {
+	repo, err := gitHubRepoName(g.github.url)
+	if err != nil {
+		return err
+	}
+	number, ok, err := parsePullRequestRef(ref, repo)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		g.pr = nil
+		return g.OriginImpl.Checkout(ref)
+	}
+
+	pr, err := g.client.GetPullRequest(repo, number)
+	if err != nil {
+		return fmt.Errorf("failed to get pull request #%d: %w", number, err)
+	}
+	if err := g.checkState(pr); err != nil {
+		return err
+	}
+	if err := g.checkReviews(repo, pr); err != nil {
+		return err
+	}
+
+	gitRepo, err := g.Repo()
+	if err != nil {
+		return err
+	}
+	local := fmt.Sprintf("refs/pull/%d/head", number)
+	if err := gitRepo.Fetch(originRemote, g.github.partialFetch, "+"+local+":"+local); err != nil {
+		return fmt.Errorf("failed to fetch pull request #%d: %w", number, err)
+	}
+	sha, err := gitRepo.ResolveCommit(local)
+	if err != nil {
+		return err
+	}
+	// The filters above were checked against pr.Head.SHA; refuse to migrate
+	// a head pushed after the pull request was looked up.
+	if sha != pr.Head.SHA {
+		return fmt.Errorf("pull request #%d head moved from %s to %s while checking it out, retry the migration",
+			number, pr.Head.SHA, sha)
+	}
+
+	g.pr = pr
+	g.resolved = sha
+	return nil
+}
+
+// parsePullRequestRef returns the pull request number of ref, which may be
+// a number or a pull request URL of repo. ok is false for other references.
+func parsePullRequestRef(ref, repo string) (number int, ok bool, err error) {
+	if m := pullRequestURL.FindStringSubmatch(ref); m != nil {
+		if !strings.EqualFold(m[1], repo) {
+			return 0, false, fmt.Errorf("pull request %s does not belong to %s", ref, repo)
+		}
+		ref = m[2]
+	}
+	number, err = strconv.Atoi(ref)
+	if err != nil || number <= 0 {
+		return 0, false, nil
+	}
+	return number, true, nil
+}
+
+// checkState verifies the pull request state against the state filter.
+func (g *GitHubOriginImpl) checkState(pr *PullRequest) error {
+	switch g.github.state {
+	case StateFilterAll:
+		return nil
+	case StateFilterClosed:
+		if pr.State == "closed" {
+			return nil
+		}
+	default:
+		if pr.State == "open" {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: pull request #%d is %s, but the origin only migrates %s pull requests",
+		ErrPullRequestRejected, pr.Number, pr.State, strings.ToLower(string(g.github.state)))
+}
+
+// checkReviews verifies the pull request reviews against review_state.
+// Only the latest review of each user counts; comments and dismissed
+// reviews are ignored.
+func (g *GitHubOriginImpl) checkReviews(repo string, pr *PullRequest) error {
+	if g.github.reviewState == "" || g.github.reviewState == ReviewStateAny {
+		return nil
+	}
+
+	reviews, err := g.client.ListReviews(repo, pr.Number)
+	if err != nil {
+		return fmt.Errorf("failed to get reviews of pull request #%d: %w", pr.Number, err)
+	}
+
+	latest := make(map[string]*Review)
+	for _, r := range reviews {
+		if r.State == "COMMENTED" || r.State == "PENDING" || r.State == "DISMISSED" {
+			continue
+		}
+		latest[r.User.Login] = r
+	}
+
+	var satisfied bool
+	switch g.github.reviewState {
+	case ReviewStateHasReviewers:
+		satisfied = len(latest) > 0
+	case ReviewStateAnyCommitApproved:
+		for _, r := range latest {
+			satisfied = satisfied || r.State == "APPROVED"
+		}
+	case ReviewStateHeadCommitApproved:
+		for _, r := range latest {
+			satisfied = satisfied || (r.State == "APPROVED" && r.CommitID == pr.Head.SHA)
+		}
+	}
+	if !satisfied {
+		return fmt.Errorf("%w: pull request #%d does not satisfy review_state %s",
+			ErrPullRequestRejected, pr.Number, g.github.reviewState)
+	}
+	return nil
+}
+
+// Changes returns the changes after baseline up to the checked out
+// reference. When a pull request is checked out, its metadata is added to
+// the labels of the last change.
+func (g *GitHubOriginImpl) Changes(baseline string) ([]*vcs.Change, error) {
+	changes, err := g.OriginImpl.Changes(baseline)
+	if err != nil || g.pr == nil || len(changes) == 0 {
+		return changes, err
+	}
+
+	last := changes[len(changes)-1]
+	if last.Labels == nil {
+		last.Labels = make(map[string][]string)
+	}
+	for name, values := range g.prLabels() {
+		last.Labels[name] = append(last.Labels[name], values...)
+	}
+	return changes, nil
+}
+
+// prLabels returns the labels describing the checked out pull request.
+func (g *GitHubOriginImpl) prLabels() map[string][]string {
+	pr := g.pr
+	labels := map[string][]string{
+		LabelPRNumber:     {strconv.Itoa(pr.Number)},
+		LabelPRTitle:      {pr.Title},
+		LabelPRUser:       {pr.User.Login},
+		LabelPRURL:        {pr.HTMLURL},
+		LabelPRHeadSHA:    {g.resolved},
+		LabelPRBaseBranch: {pr.Base.Ref},
+	}
+	for _, l := range pr.Labels {
+		labels[LabelPRLabel] = append(labels[LabelPRLabel], l.Name)
+	}
+	return labels
+}
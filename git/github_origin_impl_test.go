@@ -0,0 +1,179 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// newGitHubOriginRepo creates a repository at <tmp>/octo/project with a
+// commit on main and pull request #1 whose head is a commit on top of it.
+func newGitHubOriginRepo(t *testing.T) (repo *testRepo, head string) {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "octo", "project")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	repo = &testRepo{t: t, dir: dir}
+	repo.git("init", "--quiet", "--initial-branch=main")
+	repo.commit("Initial", map[string]string{"a.txt": "a\n"})
+
+	repo.git("checkout", "--quiet", "-b", "feature")
+	head = repo.commit("Feature", map[string]string{"a.txt": "feature\n"})
+	repo.git("update-ref", "refs/pull/1/head", head)
+	repo.git("checkout", "--quiet", "main")
+	return repo, head
+}
+
+// newTestGitHubOrigin returns a GitHub origin implementation using a
+// private cache directory and the fake API.
+func newTestGitHubOrigin(t *testing.T, origin *GitHubOrigin, fake *fakeGitHub) *GitHubOriginImpl {
+	t.Helper()
+	return origin.Impl().WithGitHubClient(fake.client()).WithRepoDir(filepath.Join(t.TempDir(), "cache"))
+}
+
+func TestGitHubOriginImplCheckout(t *testing.T) {
+	repo, head := newGitHubOriginRepo(t)
+	fake := newFakeGitHub(t, "octo/project")
+	fake.prs = []*PullRequest{{
+		Number:  1,
+		State:   "open",
+		Title:   "Add feature",
+		HTMLURL: "https://github.com/octo/project/pull/1",
+		User:    GitHubUser{Login: "octocat"},
+		Head:    GitHubRef{Ref: "feature", SHA: head},
+		Base:    GitHubRef{Ref: "main"},
+		Labels:  []GitHubLabel{{Name: "bug"}, {Name: "import"}},
+	}}
+
+	for _, ref := range []string{"1", "https://github.com/octo/project/pull/1"} {
+		t.Run(ref, func(t *testing.T) {
+			origin := newTestGitHubOrigin(t, &GitHubOrigin{url: repo.url(), ref: "main", firstParent: true}, fake)
+			if err := origin.Checkout(ref); err != nil {
+				t.Fatalf("Checkout(%q) error: %v", ref, err)
+			}
+			if origin.Ref() != head {
+				t.Errorf("Ref() = %s, want %s", origin.Ref(), head)
+			}
+
+			dir := t.TempDir()
+			if err := origin.CopyTo(dir); err != nil {
+				t.Fatalf("CopyTo() error: %v", err)
+			}
+			if data, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(data) != "feature\n" {
+				t.Errorf("a.txt = %q", data)
+			}
+
+			changes, err := origin.Changes("")
+			if err != nil {
+				t.Fatalf("Changes() error: %v", err)
+			}
+			labels := changes[len(changes)-1].Labels
+			want := map[string][]string{
+				LabelPRNumber:     {"1"},
+				LabelPRTitle:      {"Add feature"},
+				LabelPRUser:       {"octocat"},
+				LabelPRURL:        {"https://github.com/octo/project/pull/1"},
+				LabelPRHeadSHA:    {head},
+				LabelPRBaseBranch: {"main"},
+				LabelPRLabel:      {"bug", "import"},
+			}
+			for name, values := range want {
+				if !slices.Equal(labels[name], values) {
+					t.Errorf("label %s = %v, want %v", name, labels[name], values)
+				}
+			}
+		})
+	}
+
+	t.Run("head moved", func(t *testing.T) {
+		moved := *fake.prs[0]
+		moved.Head.SHA = "0000000000000000000000000000000000000001"
+		stale := newFakeGitHub(t, "octo/project")
+		stale.prs = []*PullRequest{&moved}
+
+		origin := newTestGitHubOrigin(t, &GitHubOrigin{url: repo.url(), ref: "main"}, stale)
+		if err := origin.Checkout("1"); err == nil || origin.PullRequest() != nil {
+			t.Error("expected an error when the fetched head differs from the pull request head")
+		}
+	})
+
+	t.Run("other repository", func(t *testing.T) {
+		origin := newTestGitHubOrigin(t, &GitHubOrigin{url: repo.url(), ref: "main"}, fake)
+		if err := origin.Checkout("https://github.com/other/repo/pull/1"); err == nil {
+			t.Error("expected an error for a pull request of another repository")
+		}
+	})
+
+	t.Run("branch", func(t *testing.T) {
+		origin := newTestGitHubOrigin(t, &GitHubOrigin{url: repo.url(), ref: "main"}, fake)
+		if err := origin.Checkout("main"); err != nil {
+			t.Fatalf("Checkout(main) error: %v", err)
+		}
+		if origin.PullRequest() != nil || origin.Ref() != repo.git("rev-parse", "main") {
+			t.Errorf("branch checkout resolved to %s", origin.Ref())
+		}
+	})
+}
+
+func TestGitHubOriginImplFilters(t *testing.T) {
+	repo, head := newGitHubOriginRepo(t)
+	const oldCommit = "0000000000000000000000000000000000000001"
+
+	tests := []struct {
+		name        string
+		state       StateFilter
+		reviewState ReviewState
+		prState     string
+		reviews     []*Review
+		wantErr     bool
+	}{
+		{"open pull request", StateFilterOpen, ReviewStateAny, "open", nil, false},
+		{"closed pull request", StateFilterOpen, ReviewStateAny, "closed", nil, true},
+		{"closed filter", StateFilterClosed, ReviewStateAny, "closed", nil, false},
+		{"all filter", StateFilterAll, ReviewStateAny, "closed", nil, false},
+		{"no reviewers", StateFilterOpen, ReviewStateHasReviewers, "open", nil, true},
+		{"has reviewers", StateFilterOpen, ReviewStateHasReviewers, "open",
+			[]*Review{{User: GitHubUser{Login: "r"}, State: "CHANGES_REQUESTED"}}, false},
+		{"only comments", StateFilterOpen, ReviewStateHasReviewers, "open",
+			[]*Review{{User: GitHubUser{Login: "r"}, State: "COMMENTED"}}, true},
+		{"dismissed review", StateFilterOpen, ReviewStateHasReviewers, "open",
+			[]*Review{{User: GitHubUser{Login: "r"}, State: "DISMISSED"}}, true},
+		{"any commit approved", StateFilterOpen, ReviewStateAnyCommitApproved, "open",
+			[]*Review{{User: GitHubUser{Login: "r"}, State: "APPROVED", CommitID: oldCommit}}, false},
+		{"approval withdrawn", StateFilterOpen, ReviewStateAnyCommitApproved, "open",
+			[]*Review{
+				{User: GitHubUser{Login: "r"}, State: "APPROVED", CommitID: oldCommit},
+				{User: GitHubUser{Login: "r"}, State: "CHANGES_REQUESTED", CommitID: head},
+			}, true},
+		{"old commit approved", StateFilterOpen, ReviewStateHeadCommitApproved, "open",
+			[]*Review{{User: GitHubUser{Login: "r"}, State: "APPROVED", CommitID: oldCommit}}, true},
+		{"head commit approved", StateFilterOpen, ReviewStateHeadCommitApproved, "open",
+			[]*Review{{User: GitHubUser{Login: "r"}, State: "APPROVED", CommitID: head}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeGitHub(t, "octo/project")
+			fake.prs = []*PullRequest{{Number: 1, State: tt.prState, Head: GitHubRef{Ref: "feature", SHA: head}}}
+			fake.reviews[1] = tt.reviews
+
+			origin := newTestGitHubOrigin(t, &GitHubOrigin{
+				url:         repo.url(),
+				ref:         "main",
+				state:       tt.state,
+				reviewState: tt.reviewState,
+			}, fake)
+
+			err := origin.Checkout("1")
+			if tt.wantErr && !errors.Is(err, ErrPullRequestRejected) {
+				t.Errorf("expected ErrPullRequestRejected, got %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Checkout() error: %v", err)
+			}
+		})
+	}
+}
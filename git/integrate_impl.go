@@ -0,0 +1,85 @@
+package git
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+)
+
+// integration is a commit referenced by an integrate label, resolved in
+// the destination cache repository.
+type integration struct {
+	commit   string
+	strategy IntegrateStrategy
+}
+
+// parseIntegrateLabel parses an integrate label value of the form
+// "<url> [<ref>]". The ref defaults to HEAD.
+//
+// Label values come from origin commit messages, so the URL is checked
+// with checkUntrustedURL and the ref may not look like a git option.
+func parseIntegrateLabel(value string) (url, ref string, err error) {
+	fields := strings.Fields(value)
+	switch len(fields) {
+	case 1:
+		url, ref = fields[0], "HEAD"
+	case 2:
+		url, ref = fields[0], fields[1]
+	default:
+		return "", "", fmt.Errorf("invalid integrate label value %q, expected \"<url> [<ref>]\"", value)
+	}
+
+	if err := checkUntrustedURL("integrate", url); err != nil {
+		return "", "", err
+	}
+	if strings.HasPrefix(ref, "-") {
+		return "", "", fmt.Errorf("invalid integrate ref %q", ref)
+	}
+	return url, ref, nil
+}
+
+// resolveIntegrations fetches the commits referenced by the integrate
+// labels of message. Failures are skipped for integrates that ignore errors.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/git/GitIntegrateChanges.java
+func resolveIntegrations(repo *Repo, integrates []*IntegrateChanges, message string) ([]integration, error) {
+	labels := transform.ParseLabels(message)
+
+	var result []integration
+	for _, ic := range integrates {
+		for _, value := range labels[ic.label] {
+			commit, err := fetchIntegration(repo, value)
+			if err != nil {
+				if ic.ignoreErrors {
+					continue
+				}
+				return nil, fmt.Errorf("failed to integrate %s=%s: %w", ic.label, value, err)
+			}
+			result = append(result, integration{commit: commit, strategy: ic.strategy})
+		}
+	}
+	return result, nil
+}
+
+// fetchIntegration fetches the commit referenced by an integrate label value.
+func fetchIntegration(repo *Repo, value string) (string, error) {
+	url, ref, err := parseIntegrateLabel(value)
+	if err != nil {
+		return "", err
+	}
+	if _, err := repo.Run("fetch", "--quiet", "--no-tags", "--", url, ref); err != nil {
+		return "", err
+	}
+	return repo.ResolveCommit("FETCH_HEAD")
+}
+
+// removeIntegrateLabels removes the integrate labels from message.
+func removeIntegrateLabels(message string, integrates []*IntegrateChanges) string {
+	for _, ic := range integrates {
+		pattern := regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(ic.label) + `[:=].*(\n|$)`)
+		message = pattern.ReplaceAllString(message, "")
+	}
+	return message
+}
@@ -0,0 +1,129 @@
+package git
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/albertocavalcante/starlark-go-copybara/vcs"
+)
+
+func TestDestinationImplIntegrate(t *testing.T) {
+	review := newTestRepo(t)
+	integrated := review.commit("Review", map[string]string{"lib/a.txt": "review\n", "docs/notes.md": "notes\n"})
+
+	tests := []struct {
+		strategy    IntegrateStrategy
+		wantParents int
+		wantNotes   bool
+	}{
+		{StrategyFakeMerge, 2, false},
+		{StrategyFakeMergeAndIncludeFiles, 2, true},
+		{StrategyIncludeFiles, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			remote := newBareRepo(t)
+			dest := newTestDestination(t, &Destination{
+				url:        remote.url(),
+				push:       "main",
+				integrates: []*IntegrateChanges{NewIntegrateChanges("", tt.strategy, false)},
+			})
+			if _, err := dest.Write(&vcs.TransformResult{
+				WorkDir: workDir(t, map[string]string{"lib/a.txt": "a\n"}),
+				Message: "Initial",
+				Author:  "A <a@example.com>",
+			}); err != nil {
+				t.Fatalf("first Write() error: %v", err)
+			}
+
+			result, err := dest.Write(&vcs.TransformResult{
+				WorkDir:          workDir(t, map[string]string{"lib/a.txt": "migrated\n"}),
+				DestinationFiles: prefixMatcher("lib/"),
+				OriginRef:        "abc",
+				Message:          "Merge review\n\n" + DefaultIntegrateLabel + "=" + review.url() + " " + integrated + "\n",
+				Author:           "A <a@example.com>",
+			})
+			if err != nil {
+				t.Fatalf("Write() error: %v", err)
+			}
+
+			parents := strings.Fields(remote.git("log", "-1", "--format=%P", "main"))
+			if len(parents) != tt.wantParents {
+				t.Errorf("parents = %v, want %d", parents, tt.wantParents)
+			}
+			if tt.wantParents == 2 && parents[1] != integrated {
+				t.Errorf("second parent = %s, want %s", parents[1], integrated)
+			}
+
+			files := remote.git("ls-tree", "-r", "--name-only", "main")
+			if got := strings.Contains(files, "docs/notes.md"); got != tt.wantNotes {
+				t.Errorf("docs/notes.md included = %v, want %v", got, tt.wantNotes)
+			}
+			if content := remote.git("show", "main:lib/a.txt"); content != "migrated" {
+				t.Errorf("lib/a.txt = %q, destination files must come from the migration", content)
+			}
+			if msg := remote.git("log", "-1", "--format=%B", "main"); msg != "Merge review\n\nGitOrigin-RevId: abc" {
+				t.Errorf("message = %q, integrate label should be removed", msg)
+			}
+			if tt.wantNotes && len(result.Files) != 2 {
+				t.Errorf("Files = %v, want lib/a.txt and docs/notes.md", result.Files)
+			}
+		})
+	}
+}
+
+func TestDestinationImplIntegrateErrors(t *testing.T) {
+	message := "Merge\n\n" + DefaultIntegrateLabel + "=file:///does/not/exist main\n"
+
+	for _, ignoreErrors := range []bool{true, false} {
+		remote := newBareRepo(t)
+		dest := newTestDestination(t, &Destination{
+			url:        remote.url(),
+			push:       "main",
+			integrates: []*IntegrateChanges{NewIntegrateChanges("", StrategyFakeMerge, ignoreErrors)},
+		})
+
+		_, err := dest.Write(&vcs.TransformResult{
+			WorkDir: workDir(t, map[string]string{"a.txt": "a\n"}),
+			Message: message,
+			Author:  "A <a@example.com>",
+		})
+		if ignoreErrors && err != nil {
+			t.Errorf("ignore_errors = True: Write() error: %v", err)
+		}
+		if !ignoreErrors && (err == nil || !strings.Contains(err.Error(), DefaultIntegrateLabel)) {
+			t.Errorf("ignore_errors = False: expected integrate error, got %v", err)
+		}
+	}
+}
+
+func TestParseIntegrateLabel(t *testing.T) {
+	tests := []struct {
+		value   string
+		url     string
+		ref     string
+		wantErr bool
+	}{
+		{"https://example.com/repo", "https://example.com/repo", "HEAD", false},
+		{"https://example.com/repo feature", "https://example.com/repo", "feature", false},
+		{"", "", "", true},
+		{"a b c", "", "", true},
+		{"ssh://git@example.com/repo", "ssh://git@example.com/repo", "HEAD", false},
+		{"file:///srv/repo", "file:///srv/repo", "HEAD", false},
+		{"/srv/repo main", "/srv/repo", "main", false},
+		{"../repo", "../repo", "HEAD", false},
+		{"--upload-pack=touch${IFS}/tmp/PWNED;git-upload-pack /repo", "", "", true},
+		{"https://example.com/repo --upload-pack=touch", "", "", true},
+		{"ext::sh -c touch% /tmp/PWNED", "", "", true},
+		{"ext::sh", "", "", true},
+		{"git@example.com:repo", "", "", true},
+		{"http://example.com/repo", "", "", true},
+	}
+	for _, tt := range tests {
+		url, ref, err := parseIntegrateLabel(tt.value)
+		if (err != nil) != tt.wantErr || url != tt.url || ref != tt.ref {
+			t.Errorf("parseIntegrateLabel(%q) = %q, %q, %v", tt.value, url, ref, err)
+		}
+	}
+}
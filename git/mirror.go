@@ -0,0 +1,199 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+// DefaultMirrorRefspec is the refspec mirrored when none is configured.
+const DefaultMirrorRefspec = "refs/heads/*"
+
+// Mirror represents git.mirror() configuration: a plain copy of references
+// from one repository to another, without transformations.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/git/Mirror.java
+type Mirror struct {
+	name         string
+	origin       string
+	destination  string
+	refspecs     []Refspec
+	prune        bool
+	partialFetch bool
+	description  string
+}
+
+// Refspec maps origin references to destination references.
+type Refspec struct {
+	// Origin is the reference, or pattern, read from the origin.
+	Origin string
+	// Destination is the reference, or pattern, written to the destination.
+	Destination string
+}
+
+// String returns the refspec in git syntax.
+func (r Refspec) String() string {
+	if r.Origin == r.Destination {
+		return r.Origin
+	}
+	return r.Origin + ":" + r.Destination
+}
+
+// ParseRefspec parses a refspec of the form "<origin>[:<destination>]".
+// Both sides must be full references and either both or none can contain
+// a single "*".
+func ParseRefspec(s string) (Refspec, error) {
+	src, dst, found := strings.Cut(strings.TrimPrefix(s, "+"), ":")
+	if !found {
+		dst = src
+	}
+	for _, ref := range []string{src, dst} {
+		if !strings.HasPrefix(ref, "refs/") || strings.Count(ref, "*") > 1 {
+			return Refspec{}, fmt.Errorf("invalid refspec %q", s)
+		}
+	}
+	if strings.Contains(src, "*") != strings.Contains(dst, "*") {
+		return Refspec{}, fmt.Errorf("invalid refspec %q: wildcard must be used on both sides", s)
+	}
+	return Refspec{Origin: src, Destination: dst}, nil
+}
+
+// String implements starlark.Value.
+func (m *Mirror) String() string {
+	parts := []string{
+		fmt.Sprintf("name = %q", m.name),
+		fmt.Sprintf("origin = %q", m.origin),
+		fmt.Sprintf("destination = %q", m.destination),
+	}
+	if len(m.refspecs) != 1 || m.refspecs[0].String() != DefaultMirrorRefspec {
+		specs := make([]string, len(m.refspecs))
+		for i, r := range m.refspecs {
+			specs[i] = fmt.Sprintf("%q", r.String())
+		}
+		parts = append(parts, fmt.Sprintf("refspecs = [%s]", strings.Join(specs, ", ")))
+	}
+	if m.prune {
+		parts = append(parts, "prune = True")
+	}
+	return fmt.Sprintf("git.mirror(%s)", strings.Join(parts, ", "))
+}
+
+// Type implements starlark.Value.
+func (m *Mirror) Type() string {
+	return "git.mirror"
+}
+
+// Freeze implements starlark.Value.
+func (m *Mirror) Freeze() {}
+
+// Truth implements starlark.Value.
+func (m *Mirror) Truth() starlark.Bool {
+	return starlark.True
+}
+
+// Hash implements starlark.Value.
+func (m *Mirror) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: git.mirror")
+}
+
+// Name returns the mirror name.
+func (m *Mirror) Name() string {
+	return m.name
+}
+
+// Origin returns the origin repository URL.
+func (m *Mirror) Origin() string {
+	return m.origin
+}
+
+// Destination returns the destination repository URL.
+func (m *Mirror) Destination() string {
+	return m.destination
+}
+
+// Refspecs returns the mirrored refspecs.
+func (m *Mirror) Refspecs() []Refspec {
+	return m.refspecs
+}
+
+// Prune returns whether destination references missing in the origin are
+// deleted.
+func (m *Mirror) Prune() bool {
+	return m.prune
+}
+
+// PartialFetch returns whether partial fetch is enabled.
+func (m *Mirror) PartialFetch() bool {
+	return m.partialFetch
+}
+
+// Description returns the mirror description.
+func (m *Mirror) Description() string {
+	return m.description
+}
+
+// Impl returns an implementation of the Mirror that can copy references.
+func (m *Mirror) Impl() *MirrorImpl {
+	return NewMirrorImpl(m)
+}
+
+// Attr implements starlark.HasAttrs.
+func (m *Mirror) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "name":
+		return starlark.String(m.name), nil
+	case "origin":
+		return starlark.String(m.origin), nil
+	case "destination":
+		return starlark.String(m.destination), nil
+	case "refspecs":
+		specs := make([]starlark.Value, len(m.refspecs))
+		for i, r := range m.refspecs {
+			specs[i] = starlark.String(r.String())
+		}
+		return starlark.NewList(specs), nil
+	case "prune":
+		return starlark.Bool(m.prune), nil
+	case "partial_fetch":
+		return starlark.Bool(m.partialFetch), nil
+	case "description":
+		return starlark.String(m.description), nil
+	default:
+		return nil, nil
+	}
+}
+
+// AttrNames implements starlark.HasAttrs.
+func (m *Mirror) AttrNames() []string {
+	return []string{
+		"name",
+		"origin",
+		"destination",
+		"refspecs",
+		"prune",
+		"partial_fetch",
+		"description",
+	}
+}
+
+// mirrorsKey is the thread-local key under which git.mirror records the
+// mirrors it creates.
+const mirrorsKey = "copybara.mirrors"
+
+// registerMirror records a mirror on the thread so that it can be found
+// even when the config does not assign it to a global.
+func registerMirror(thread *starlark.Thread, m *Mirror) {
+	if thread == nil {
+		return
+	}
+	mirrors, _ := thread.Local(mirrorsKey).([]*Mirror)
+	thread.SetLocal(mirrorsKey, append(mirrors, m))
+}
+
+// RegisteredMirrors returns the mirrors created by git.mirror on the given
+// thread, in definition order.
+func RegisteredMirrors(thread *starlark.Thread) []*Mirror {
+	mirrors, _ := thread.Local(mirrorsKey).([]*Mirror)
+	return mirrors
+}
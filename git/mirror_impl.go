@@ -0,0 +1,97 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// mirrorRemote is the remote name used for the mirror destination in the
+// cache repository.
+const mirrorRemote = "destination"
+
+// MirrorImpl copies the references of a Mirror from its origin to its
+// destination.
+//
+// The origin is fetched into a local bare repository, which is reused
+// across runs as a cache, and the fetched references are force-pushed to
+// the destination.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/git/Mirror.java
+type MirrorImpl struct {
+	mirror  *Mirror
+	repoDir string
+	dryRun  bool
+}
+
+// NewMirrorImpl creates a new MirrorImpl from a Mirror configuration.
+func NewMirrorImpl(mirror *Mirror) *MirrorImpl {
+	return &MirrorImpl{
+		mirror:  mirror,
+		repoDir: cacheDir("mirror", mirror.origin),
+	}
+}
+
+// WithRepoDir sets the directory of the local cache repository.
+func (m *MirrorImpl) WithRepoDir(dir string) *MirrorImpl {
+	m.repoDir = dir
+	return m
+}
+
+// WithDryRun fetches the origin without pushing to the destination.
+func (m *MirrorImpl) WithDryRun(dryRun bool) *MirrorImpl {
+	m.dryRun = dryRun
+	return m
+}
+
+// Run mirrors the configured refspecs and returns the origin references
+// that were copied.
+func (m *MirrorImpl) Run() ([]string, error) {
+	repo, err := OpenRepo(m.repoDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.SetRemote(originRemote, m.mirror.origin); err != nil {
+		return nil, err
+	}
+	if err := repo.SetRemote(mirrorRemote, m.mirror.destination); err != nil {
+		return nil, err
+	}
+
+	// Origin references are kept under their own names in the cache so
+	// that pruning the fetch also drops references deleted in the origin.
+	fetch := []string{"fetch", "--quiet", "--force", "--no-tags"}
+	push := []string{"push", "--quiet", "--force"}
+	if m.mirror.prune {
+		fetch = append(fetch, "--prune")
+		push = append(push, "--prune")
+	}
+	if m.mirror.partialFetch {
+		fetch = append(fetch, "--filter=blob:none")
+	}
+	fetch = append(fetch, originRemote)
+	push = append(push, mirrorRemote)
+	patterns := make([]string, len(m.mirror.refspecs))
+	for i, r := range m.mirror.refspecs {
+		fetch = append(fetch, "+"+r.Origin+":"+r.Origin)
+		push = append(push, "+"+r.Origin+":"+r.Destination)
+		patterns[i] = r.Origin
+	}
+
+	if _, err := repo.Run(fetch...); err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", m.mirror.origin, err)
+	}
+
+	out, err := repo.Run(append([]string{"for-each-ref", "--format=%(refname)"}, patterns...)...)
+	if err != nil {
+		return nil, err
+	}
+	refs := strings.Fields(out)
+
+	if m.dryRun {
+		return refs, nil
+	}
+	if _, err := repo.Run(push...); err != nil {
+		return nil, fmt.Errorf("failed to push to %s: %w", m.mirror.destination, err)
+	}
+	return refs, nil
+}
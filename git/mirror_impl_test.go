@@ -0,0 +1,90 @@
+package git
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// newTestMirror returns a mirror implementation using a private cache
+// directory.
+func newTestMirror(t *testing.T, mirror *Mirror) *MirrorImpl {
+	t.Helper()
+	return mirror.Impl().WithRepoDir(filepath.Join(t.TempDir(), "cache"))
+}
+
+func TestMirrorImplRun(t *testing.T) {
+	origin := newTestRepo(t)
+	main := origin.commit("First", map[string]string{"a.txt": "a\n"})
+	origin.git("branch", "release")
+	origin.git("tag", "v1")
+
+	dest := newBareRepo(t)
+	mirror := &Mirror{
+		name:        "m",
+		origin:      origin.url(),
+		destination: "file://" + dest.dir,
+		refspecs: []Refspec{
+			{Origin: "refs/heads/*", Destination: "refs/heads/*"},
+			{Origin: "refs/tags/*", Destination: "refs/tags/upstream/*"},
+		},
+	}
+
+	refs, err := newTestMirror(t, mirror).Run()
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	want := []string{"refs/heads/main", "refs/heads/release", "refs/tags/v1"}
+	if !slices.Equal(refs, want) {
+		t.Errorf("Run() = %v, want %v", refs, want)
+	}
+	for _, ref := range []string{"refs/heads/main", "refs/heads/release", "refs/tags/upstream/v1"} {
+		if got := dest.git("rev-parse", ref); got != main {
+			t.Errorf("%s = %s, want %s", ref, got, main)
+		}
+	}
+
+	// Deleted origin branches are only removed from the destination when
+	// pruning.
+	origin.git("branch", "-D", "release")
+	if _, err := newTestMirror(t, mirror).Run(); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if dest.git("branch", "--list", "release") == "" {
+		t.Error("release should be kept without prune")
+	}
+
+	mirror.prune = true
+	if _, err := newTestMirror(t, mirror).Run(); err != nil {
+		t.Fatalf("Run(prune) error: %v", err)
+	}
+	if dest.git("branch", "--list", "release") != "" {
+		t.Error("release should be pruned")
+	}
+	if dest.git("rev-parse", "refs/tags/upstream/v1") != main {
+		t.Error("refs/tags/upstream/v1 should be kept")
+	}
+}
+
+func TestMirrorImplDryRun(t *testing.T) {
+	origin := newTestRepo(t)
+	origin.commit("First", map[string]string{"a.txt": "a\n"})
+	dest := newBareRepo(t)
+
+	mirror := &Mirror{
+		name:        "m",
+		origin:      origin.url(),
+		destination: "file://" + dest.dir,
+		refspecs:    []Refspec{{Origin: "refs/heads/main", Destination: "refs/heads/upstream"}},
+	}
+	refs, err := newTestMirror(t, mirror).WithDryRun(true).Run()
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if !slices.Equal(refs, []string{"refs/heads/main"}) {
+		t.Errorf("Run() = %v", refs)
+	}
+	if out := dest.git("for-each-ref"); out != "" {
+		t.Errorf("dry run should not push, destination has %s", out)
+	}
+}
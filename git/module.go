@@ -5,7 +5,10 @@
 //   - git.destination() - Git repository destination
 //   - git.github_origin() - GitHub origin
 //   - git.github_pr_destination() - GitHub PR destination
+//   - git.gerrit_origin() - Gerrit origin
+//   - git.gerrit_destination() - Gerrit destination
 //   - git.integrate() - Integration configuration
+//   - git.mirror() - Reference mirroring between repositories
 //
 // Reference: https://github.com/google/copybara/tree/master/java/com/google/copybara/git
 package git
@@ -25,7 +28,10 @@ var Module = &starlarkstruct.Module{
 		"destination":           starlark.NewBuiltin("git.destination", destinationFn),
 		"github_origin":         starlark.NewBuiltin("git.github_origin", githubOriginFn),
 		"github_pr_destination": starlark.NewBuiltin("git.github_pr_destination", githubPrDestinationFn),
+		"gerrit_origin":         starlark.NewBuiltin("git.gerrit_origin", gerritOriginFn),
+		"gerrit_destination":    starlark.NewBuiltin("git.gerrit_destination", gerritDestinationFn),
 		"integrate":             starlark.NewBuiltin("git.integrate", integrateFn),
+		"mirror":                starlark.NewBuiltin("git.mirror", mirrorFn),
 	},
 }
 
@@ -232,7 +238,8 @@ func githubOriginFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark
 // Parameters:
 //   - url (required): GitHub repository URL
 //   - destination_ref (optional): Target branch for PR (default: "main")
-//   - pr_branch (optional): PR branch name template
+//   - pr_branch (optional): PR branch name template. Defaults to a branch
+//     derived from the workflow name and the context reference
 //   - title (optional): PR title template
 //   - body (optional): PR body template
 //   - draft (optional): Create draft PRs (default: false)
@@ -294,10 +301,168 @@ func githubPrDestinationFn(thread *starlark.Thread, fn *starlark.Builtin, args s
 	}, nil
 }
 
+// gerritOriginFn implements git.gerrit_origin().
+//
+// Parameters:
+//   - url (required): Gerrit repository URL
+//   - ref (optional): Git reference (default: "master")
+//   - branch (optional): Only migrate changes targeting this branch
+//   - submodules (optional): "YES", "NO", "RECURSIVE" (default: "NO")
+//   - first_parent (optional): Use first parent only (default: true)
+//   - partial_fetch (optional): Enable partial fetch (default: false)
+//
+// Reference: GerritOrigin.java
+func gerritOriginFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		url          string
+		ref          = "master"
+		branch       string
+		submodules   = "NO"
+		firstParent  = true
+		partialFetch = false
+	)
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+		"url", &url,
+		"ref?", &ref,
+		"branch?", &branch,
+		"submodules?", &submodules,
+		"first_parent?", &firstParent,
+		"partial_fetch?", &partialFetch,
+	); err != nil {
+		return nil, err
+	}
+
+	submoduleStrategy, err := ParseSubmoduleStrategy(submodules)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GerritOrigin{
+		url:          url,
+		ref:          ref,
+		branch:       branch,
+		submodules:   submoduleStrategy,
+		firstParent:  firstParent,
+		partialFetch: partialFetch,
+	}, nil
+}
+
+// gerritDestinationFn implements git.gerrit_destination().
+//
+// Parameters:
+//   - url (required): Gerrit repository URL
+//   - fetch (required): Branch changes are based on
+//   - push_to_refs_for (optional): Branch changes are uploaded for review to (default: fetch)
+//   - submit (optional): Push directly to the branch instead of refs/for (default: false)
+//   - change_id_policy (optional): "FAIL_IF_PRESENT", "REQUIRE", "REPLACE", "REUSE" (default: "FAIL_IF_PRESENT")
+//   - topic (optional): Topic template
+//   - reviewers (optional): List of reviewer templates
+//   - cc (optional): List of cc templates
+//   - labels (optional): List of review labels to vote, e.g. "Code-Review+1"
+//   - integrates (optional): List of git.integrate() configurations
+//
+// Reference: GerritDestination.java
+func gerritDestinationFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		url             string
+		fetch           string
+		pushToRefsFor   string
+		submit          = false
+		changeIDPolicy  = "FAIL_IF_PRESENT"
+		topic           string
+		reviewersValue  *starlark.List
+		ccValue         *starlark.List
+		labelsValue     *starlark.List
+		integratesValue *starlark.List
+	)
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+		"url", &url,
+		"fetch", &fetch,
+		"push_to_refs_for?", &pushToRefsFor,
+		"submit?", &submit,
+		"change_id_policy?", &changeIDPolicy,
+		"topic?", &topic,
+		"reviewers?", &reviewersValue,
+		"cc?", &ccValue,
+		"labels?", &labelsValue,
+		"integrates?", &integratesValue,
+	); err != nil {
+		return nil, err
+	}
+
+	if pushToRefsFor == "" {
+		pushToRefsFor = fetch
+	}
+	policy, err := ParseChangeIDPolicy(changeIDPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	reviewers, err := toStrings("reviewers", reviewersValue)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := toStrings("cc", ccValue)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := toStrings("labels", labelsValue)
+	if err != nil {
+		return nil, err
+	}
+	if submit && (topic != "" || len(reviewers) > 0 || len(cc) > 0 || len(labels) > 0) {
+		return nil, fmt.Errorf("%s: topic, reviewers, cc and labels cannot be used with submit = True", fn.Name())
+	}
+
+	// Parse integrates list
+	var integrates []*IntegrateChanges
+	if integratesValue != nil {
+		for i := range integratesValue.Len() {
+			item := integratesValue.Index(i)
+			ic, ok := item.(*IntegrateChanges)
+			if !ok {
+				return nil, fmt.Errorf("integrates[%d]: expected git.integrate, got %s", i, item.Type())
+			}
+			integrates = append(integrates, ic)
+		}
+	}
+
+	return &GerritDestination{
+		url:            url,
+		fetch:          fetch,
+		pushToRefsFor:  pushToRefsFor,
+		submit:         submit,
+		changeIDPolicy: policy,
+		topic:          topic,
+		reviewers:      reviewers,
+		cc:             cc,
+		labels:         labels,
+		integrates:     integrates,
+	}, nil
+}
+
+// toStrings converts an optional Starlark list of strings to a slice.
+func toStrings(name string, list *starlark.List) ([]string, error) {
+	if list == nil {
+		return nil, nil
+	}
+	values := make([]string, list.Len())
+	for i := range list.Len() {
+		s, ok := starlark.AsString(list.Index(i))
+		if !ok {
+			return nil, fmt.Errorf("%s[%d]: expected string, got %s", name, i, list.Index(i).Type())
+		}
+		values[i] = s
+	}
+	return values, nil
+}
+
 // integrateFn implements git.integrate().
 //
 // Parameters:
-//   - label (optional): The label containing the URL to integrate (default: "COPYBARA_INTEGRATE_REVIEW")
+//   - label (optional): The label containing the URL to integrate, as "<url> [<ref>]" (default: "COPYBARA_INTEGRATE_REVIEW")
 //   - strategy (optional): Integration strategy (default: "FAKE_MERGE_AND_INCLUDE_FILES")
 //   - "FAKE_MERGE": Add as parent but ignore files
 //   - "FAKE_MERGE_AND_INCLUDE_FILES": Fake merge but include non-destination files
@@ -327,3 +492,76 @@ func integrateFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tu
 
 	return NewIntegrateChanges(label, strategyVal, ignoreErrors), nil
 }
+
+// mirrorFn implements git.mirror().
+//
+// Parameters:
+//   - name (required): Mirror name, used to run it like a workflow
+//   - origin (required): Origin repository URL
+//   - destination (required): Destination repository URL
+//   - refspecs (optional): References to mirror, as "<origin>[:<destination>]" (default: ["refs/heads/*"])
+//   - prune (optional): Delete destination references missing in the origin (default: false)
+//   - partial_fetch (optional): Enable partial fetch (default: false)
+//   - description (optional): Description of the mirror
+//
+// Reference: GitModule.java
+func mirrorFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		name          string
+		origin        string
+		destination   string
+		refspecsValue *starlark.List
+		prune         = false
+		partialFetch  = false
+		description   string
+	)
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+		"name", &name,
+		"origin", &origin,
+		"destination", &destination,
+		"refspecs?", &refspecsValue,
+		"prune?", &prune,
+		"partial_fetch?", &partialFetch,
+		"description?", &description,
+	); err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("%s: name must not be empty", fn.Name())
+	}
+
+	// Parse refspecs list
+	specs := []string{DefaultMirrorRefspec}
+	if refspecsValue != nil {
+		var err error
+		if specs, err = toStrings("refspecs", refspecsValue); err != nil {
+			return nil, err
+		}
+		if len(specs) == 0 {
+			return nil, fmt.Errorf("%s: refspecs must not be empty", fn.Name())
+		}
+	}
+	refspecs := make([]Refspec, len(specs))
+	for i, s := range specs {
+		r, err := ParseRefspec(s)
+		if err != nil {
+			return nil, fmt.Errorf("refspecs[%d]: %w", i, err)
+		}
+		refspecs[i] = r
+	}
+
+	m := &Mirror{
+		name:         name,
+		origin:       origin,
+		destination:  destination,
+		refspecs:     refspecs,
+		prune:        prune,
+		partialFetch: partialFetch,
+		description:  description,
+	}
+	registerMirror(thread, m)
+
+	return m, nil
+}
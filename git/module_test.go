@@ -1,6 +1,7 @@
 package git
 
 import (
+	"slices"
 	"testing"
 
 	"go.starlark.net/starlark"
@@ -525,6 +526,220 @@ func TestIntegrateFn(t *testing.T) {
 	}
 }
 
+func TestGerritOriginFn(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       string
+		wantRef    string
+		wantBranch string
+		wantString string
+		wantErr    bool
+	}{
+		{
+			name:       "minimal",
+			code:       `git.gerrit_origin(url = "https://gerrit.example.com/project")`,
+			wantRef:    "master",
+			wantString: `git.gerrit_origin(url = "https://gerrit.example.com/project", ref = "master")`,
+		},
+		{
+			name:       "with ref and branch",
+			code:       `git.gerrit_origin(url = "https://gerrit.example.com/project", ref = "main", branch = "main")`,
+			wantRef:    "main",
+			wantBranch: "main",
+			wantString: `git.gerrit_origin(url = "https://gerrit.example.com/project", ref = "main", branch = "main")`,
+		},
+		{
+			name:    "invalid submodules",
+			code:    `git.gerrit_origin(url = "https://gerrit.example.com/project", submodules = "SOME")`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := evalGitExpr(t, tt.code)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("evalGitExpr() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			origin, ok := result.(*GerritOrigin)
+			if !ok {
+				t.Fatalf("expected *GerritOrigin, got %T", result)
+			}
+			if origin.Ref() != tt.wantRef || origin.Branch() != tt.wantBranch || !origin.FirstParent() {
+				t.Errorf("origin = %s", origin)
+			}
+			if origin.String() != tt.wantString {
+				t.Errorf("String() = %s, want %s", origin.String(), tt.wantString)
+			}
+		})
+	}
+}
+
+func TestGerritDestinationFn(t *testing.T) {
+	tests := []struct {
+		name              string
+		code              string
+		wantPushToRefsFor string
+		wantPolicy        ChangeIDPolicy
+		wantReviewers     []string
+		wantErr           bool
+	}{
+		{
+			name:              "minimal",
+			code:              `git.gerrit_destination(url = "https://gerrit.example.com/project", fetch = "main")`,
+			wantPushToRefsFor: "main",
+			wantPolicy:        ChangeIDFailIfPresent,
+		},
+		{
+			name: "with options",
+			code: `git.gerrit_destination(url = "https://gerrit.example.com/project", fetch = "main",
+				push_to_refs_for = "release", change_id_policy = "REUSE", topic = "t",
+				reviewers = ["a@example.com", "${OWNER}"], cc = ["b@example.com"], labels = ["Verified+1"])`,
+			wantPushToRefsFor: "release",
+			wantPolicy:        ChangeIDReuse,
+			wantReviewers:     []string{"a@example.com", "${OWNER}"},
+		},
+		{
+			name:    "missing fetch",
+			code:    `git.gerrit_destination(url = "https://gerrit.example.com/project")`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid change_id_policy",
+			code:    `git.gerrit_destination(url = "https://gerrit.example.com/project", fetch = "main", change_id_policy = "KEEP")`,
+			wantErr: true,
+		},
+		{
+			name:    "submit with reviewers",
+			code:    `git.gerrit_destination(url = "https://gerrit.example.com/project", fetch = "main", submit = True, reviewers = ["a@example.com"])`,
+			wantErr: true,
+		},
+		{
+			name:    "non-string reviewer",
+			code:    `git.gerrit_destination(url = "https://gerrit.example.com/project", fetch = "main", reviewers = [1])`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := evalGitExpr(t, tt.code)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("evalGitExpr() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			dest, ok := result.(*GerritDestination)
+			if !ok {
+				t.Fatalf("expected *GerritDestination, got %T", result)
+			}
+			if dest.Fetch() != "main" || dest.PushToRefsFor() != tt.wantPushToRefsFor {
+				t.Errorf("dest = %s", dest)
+			}
+			if dest.ChangeIDPolicy() != tt.wantPolicy {
+				t.Errorf("ChangeIDPolicy() = %q, want %q", dest.ChangeIDPolicy(), tt.wantPolicy)
+			}
+			if !slices.Equal(dest.Reviewers(), tt.wantReviewers) {
+				t.Errorf("Reviewers() = %v, want %v", dest.Reviewers(), tt.wantReviewers)
+			}
+		})
+	}
+}
+
+func TestMirrorFn(t *testing.T) {
+	tests := []struct {
+		name         string
+		code         string
+		wantRefspecs []Refspec
+		wantPrune    bool
+		wantString   string
+		wantErr      bool
+	}{
+		{
+			name:         "defaults",
+			code:         `git.mirror(name = "m", origin = "https://a.com/r", destination = "https://b.com/r")`,
+			wantRefspecs: []Refspec{{Origin: "refs/heads/*", Destination: "refs/heads/*"}},
+			wantString:   `git.mirror(name = "m", origin = "https://a.com/r", destination = "https://b.com/r")`,
+		},
+		{
+			name: "with refspecs and prune",
+			code: `git.mirror(name = "m", origin = "https://a.com/r", destination = "https://b.com/r",
+				refspecs = ["refs/heads/main", "+refs/tags/*:refs/tags/upstream/*"], prune = True)`,
+			wantRefspecs: []Refspec{
+				{Origin: "refs/heads/main", Destination: "refs/heads/main"},
+				{Origin: "refs/tags/*", Destination: "refs/tags/upstream/*"},
+			},
+			wantPrune: true,
+			wantString: `git.mirror(name = "m", origin = "https://a.com/r", destination = "https://b.com/r", ` +
+				`refspecs = ["refs/heads/main", "refs/tags/*:refs/tags/upstream/*"], prune = True)`,
+		},
+		{
+			name:    "missing destination",
+			code:    `git.mirror(name = "m", origin = "https://a.com/r")`,
+			wantErr: true,
+		},
+		{
+			name:    "empty name",
+			code:    `git.mirror(name = "", origin = "https://a.com/r", destination = "https://b.com/r")`,
+			wantErr: true,
+		},
+		{
+			name:    "empty refspecs",
+			code:    `git.mirror(name = "m", origin = "https://a.com/r", destination = "https://b.com/r", refspecs = [])`,
+			wantErr: true,
+		},
+		{
+			name:    "short refspec",
+			code:    `git.mirror(name = "m", origin = "https://a.com/r", destination = "https://b.com/r", refspecs = ["main"])`,
+			wantErr: true,
+		},
+		{
+			name:    "one-sided wildcard",
+			code:    `git.mirror(name = "m", origin = "https://a.com/r", destination = "https://b.com/r", refspecs = ["refs/heads/*:refs/heads/main"])`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := evalGitExpr(t, tt.code)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("evalGitExpr() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			mirror, ok := result.(*Mirror)
+			if !ok {
+				t.Fatalf("expected *Mirror, got %T", result)
+			}
+
+			if mirror.Name() != "m" || mirror.Origin() != "https://a.com/r" || mirror.Destination() != "https://b.com/r" {
+				t.Errorf("mirror = %s", mirror)
+			}
+			if !slices.Equal(mirror.Refspecs(), tt.wantRefspecs) {
+				t.Errorf("Refspecs() = %v, want %v", mirror.Refspecs(), tt.wantRefspecs)
+			}
+			if mirror.Prune() != tt.wantPrune {
+				t.Errorf("Prune() = %v, want %v", mirror.Prune(), tt.wantPrune)
+			}
+			if mirror.String() != tt.wantString {
+				t.Errorf("String() = %s, want %s", mirror.String(), tt.wantString)
+			}
+		})
+	}
+}
+
 func TestDestinationWithIntegrates(t *testing.T) {
 	code := `git.destination(
 		url = "https://github.com/example/repo",
@@ -1173,7 +1388,10 @@ func TestModuleMembers(t *testing.T) {
 		"destination",
 		"github_origin",
 		"github_pr_destination",
+		"gerrit_origin",
+		"gerrit_destination",
 		"integrate",
+		"mirror",
 	}
 
 	for _, name := range expectedMembers {
@@ -163,3 +163,8 @@ func (o *Origin) AttrNames() []string {
 		attrPrimaryBranchMigration,
 	}
 }
+
+// Impl returns an implementation of the Origin that can fetch and read the repository.
+func (o *Origin) Impl() *OriginImpl {
+	return NewOriginImpl(o)
+}
@@ -0,0 +1,279 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+	"github.com/albertocavalcante/starlark-go-copybara/vcs"
+)
+
+// Compile-time interface verification.
+var _ vcs.Origin = (*OriginImpl)(nil)
+
+// originRemote is the remote name used for the origin URL in the cache repository.
+const originRemote = "origin"
+
+// originRefspecs are the refspecs fetched from the origin.
+var originRefspecs = []string{
+	"+refs/heads/*:refs/remotes/origin/*",
+	"+refs/tags/*:refs/tags/*",
+}
+
+// OriginImpl implements the vcs.Origin interface for git repositories.
+//
+// The origin URL is fetched into a local bare repository, which is reused
+// across runs as a cache.
+type OriginImpl struct {
+	origin   *Origin
+	repoDir  string
+	repo     *Repo
+	fetched  bool
+	resolved string
+}
+
+// NewOriginImpl creates a new OriginImpl from an Origin configuration.
+func NewOriginImpl(origin *Origin) *OriginImpl {
+	return &OriginImpl{
+		origin:  origin,
+		repoDir: cacheDir("origin", origin.url),
+	}
+}
+
+// WithRepoDir sets the directory of the local cache repository.
+func (o *OriginImpl) WithRepoDir(dir string) *OriginImpl {
+	o.repoDir = dir
+	return o
+}
+
+// URL returns the repository URL.
+func (o *OriginImpl) URL() string {
+	return o.origin.url
+}
+
+// Ref returns the resolved commit after Checkout, or the configured reference.
+func (o *OriginImpl) Ref() string {
+	if o.resolved != "" {
+		return o.resolved
+	}
+	return o.origin.ref
+}
+
+// Repo returns the local cache repository, fetching the origin if needed.
+func (o *OriginImpl) Repo() (*Repo, error) {
+	if o.fetched {
+		return o.repo, nil
+	}
+
+	repo, err := OpenRepo(o.repoDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.SetRemote(originRemote, o.origin.url); err != nil {
+		return nil, err
+	}
+	if err := repo.Fetch(originRemote, o.origin.partialFetch, originRefspecs...); err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", o.origin.url, err)
+	}
+
+	o.repo = repo
+	o.fetched = true
+	return repo, nil
+}
+
+// Checkout resolves ref to a commit. An empty ref uses the configured
+// reference. Branch names, tags and commit SHA-1s are accepted.
+func (o *OriginImpl) Checkout(ref string) error {
+	if ref == "" {
+		ref = o.origin.ref
+	}
+
+	repo, err := o.Repo()
+	if err != nil {
+		return err
+	}
+
+	sha, err := repo.ResolveCommit("refs/remotes/origin/"+ref, "refs/tags/"+ref, ref)
+	if err != nil {
+		return fmt.Errorf("%s: %w", o.origin.url, err)
+	}
+	o.resolved = sha
+	return nil
+}
+
+// ensureCheckout resolves the configured reference if Checkout was not called.
+func (o *OriginImpl) ensureCheckout() error {
+	if o.resolved != "" {
+		return nil
+	}
+	return o.Checkout("")
+}
+
+// Changes returns the commits after baseline up to the checked out
+// reference, oldest first. An empty baseline returns the whole history.
+//
+// With first_parent, only the first-parent chain is followed and merges
+// are reported as a single change. With include_branch_commit_logs, the
+// messages of the merged commits are appended to the merge message.
+//
+// The baseline usually comes from a label in the destination history, so
+// it must resolve to a commit and may not look like a git option.
+func (o *OriginImpl) Changes(baseline string) ([]*vcs.Change, error) {
+	if err := o.ensureCheckout(); err != nil {
+		return nil, err
+	}
+
+	rev := o.resolved
+	if baseline != "" {
+		if strings.HasPrefix(baseline, "-") {
+			return nil, fmt.Errorf("invalid baseline revision %q", baseline)
+		}
+		sha, err := o.repo.ResolveCommit(baseline)
+		if err != nil {
+			return nil, fmt.Errorf("baseline revision %q is not a commit of %s: %w", baseline, o.origin.url, err)
+		}
+		rev = sha + ".." + o.resolved
+	}
+
+	changes, err := o.log(o.origin.firstParent, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.origin.submodules != "" && o.origin.submodules != SubmoduleNo {
+		for _, c := range changes {
+			if c.Submodules, err = gitlinks(o.repo, c.Ref); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if o.origin.firstParent && o.origin.includeBranchCommitLogs {
+		for _, c := range changes {
+			if !c.IsMerge {
+				continue
+			}
+			if err := o.appendBranchLogs(c); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return changes, nil
+}
+
+// logFormat separates commits with \x1e and fields with \x00. The file
+// names printed by --name-only follow the last field.
+const logFormat = "%x1e%H%x00%P%x00%an%x00%ae%x00%aI%x00%B%x00"
+
+// log returns the commits selected by revs, oldest first.
+func (o *OriginImpl) log(firstParent bool, revs ...string) ([]*vcs.Change, error) {
+	args := []string{"log", "--reverse", "--format=" + logFormat, "--name-only", "--diff-merges=first-parent", "--no-renames"}
+	if firstParent {
+		args = append(args, "--first-parent")
+	}
+	args = append(args, revs...)
+	args = append(args, "--")
+
+	out, err := o.repo.Run(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*vcs.Change
+	for record := range strings.SplitSeq(out, "\x1e") {
+		if strings.TrimSpace(record) == "" {
+			continue
+		}
+		change, err := parseCommit(record)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// parseCommit parses a single log record.
+func parseCommit(record string) (*vcs.Change, error) {
+	fields := strings.SplitN(record, "\x00", 7)
+	if len(fields) != 7 {
+		return nil, fmt.Errorf("unexpected git log output: %q", record)
+	}
+
+	date, err := time.Parse(time.RFC3339, fields[4])
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit date %q: %w", fields[4], err)
+	}
+
+	var files []string
+	for line := range strings.SplitSeq(fields[6], "\n") {
+		if line != "" {
+			files = append(files, line)
+		}
+	}
+
+	message := fields[5]
+	return &vcs.Change{
+		Ref:     fields[0],
+		Author:  fmt.Sprintf("%s <%s>", fields[2], fields[3]),
+		Message: message,
+		Date:    date,
+		IsMerge: len(strings.Fields(fields[1])) > 1,
+		Labels:  transform.ParseLabels(message),
+		Files:   files,
+	}, nil
+}
+
+// appendBranchLogs appends the messages of the commits merged by c to its message.
+func (o *OriginImpl) appendBranchLogs(c *vcs.Change) error {
+	// Commits reachable from the merged parents but not from the first parent
+	merged, err := o.log(false, "^"+c.Ref+"^1", c.Ref+"^@")
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(strings.TrimRight(c.Message, "\n"))
+	sb.WriteString("\n\nMerged changes:\n")
+	for i := len(merged) - 1; i >= 0; i-- {
+		m := merged[i]
+		fmt.Fprintf(&sb, "\n%s %s\n", shortRef(m.Ref), m.Author)
+		for line := range strings.SplitSeq(strings.TrimRight(m.Message, "\n"), "\n") {
+			sb.WriteString("  " + line + "\n")
+		}
+	}
+	c.Message = sb.String()
+	return nil
+}
+
+// shortRef abbreviates a SHA-1.
+func shortRef(ref string) string {
+	if len(ref) > 12 {
+		return ref[:12]
+	}
+	return ref
+}
+
+// CopyTo writes the tree of the checked out reference into dir.
+//
+// Submodules are handled according to the origin strategy: NO leaves them
+// out, YES writes the contents of the first-level submodules and RECURSIVE
+// writes the contents of nested submodules too.
+func (o *OriginImpl) CopyTo(dir string) error {
+	if err := o.ensureCheckout(); err != nil {
+		return err
+	}
+	if err := o.repo.Extract(o.resolved, dir); err != nil {
+		return err
+	}
+
+	switch o.origin.submodules {
+	case SubmoduleYes:
+		return extractSubmodules(o.repo, o.resolved, o.origin.url, dir, false)
+	case SubmoduleRecursive:
+		return extractSubmodules(o.repo, o.resolved, o.origin.url, dir, true)
+	default:
+		return removeGitlinkDirs(o.repo, o.resolved, dir)
+	}
+}
@@ -0,0 +1,243 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRepo is a non-bare repository used as a remote in tests.
+type testRepo struct {
+	t   *testing.T
+	dir string
+}
+
+// newTestRepo creates a repository with "main" as default branch.
+func newTestRepo(t *testing.T) *testRepo {
+	t.Helper()
+	r := &testRepo{t: t, dir: t.TempDir()}
+	r.git("init", "--quiet", "--initial-branch=main")
+	return r
+}
+
+// url returns the file:// URL of the repository.
+func (r *testRepo) url() string {
+	return "file://" + r.dir
+}
+
+// git runs a git command in the repository and returns its trimmed output.
+func (r *testRepo) git(args ...string) string {
+	r.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test Author",
+		"GIT_AUTHOR_EMAIL=author@example.com",
+		"GIT_AUTHOR_DATE=2024-01-02T03:04:05Z",
+		"GIT_COMMITTER_NAME=Test Committer",
+		"GIT_COMMITTER_EMAIL=committer@example.com",
+		"GIT_COMMITTER_DATE=2024-01-02T03:04:05Z",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"HOME="+r.dir,
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commit writes files (an empty content deletes the file) and commits them.
+func (r *testRepo) commit(message string, files map[string]string) string {
+	r.t.Helper()
+	for path, content := range files {
+		full := filepath.Join(r.dir, path)
+		if content == "" {
+			if err := os.Remove(full); err != nil {
+				r.t.Fatalf("failed to remove %s: %v", path, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			r.t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			r.t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+	r.git("add", "--all")
+	r.git("commit", "--quiet", "--allow-empty", "-m", message)
+	return r.git("rev-parse", "HEAD")
+}
+
+// newTestOrigin returns an origin implementation for the test repository
+// using a private cache directory.
+func newTestOrigin(t *testing.T, origin *Origin) *OriginImpl {
+	t.Helper()
+	return origin.Impl().WithRepoDir(filepath.Join(t.TempDir(), "cache"))
+}
+
+func TestOriginImplChanges(t *testing.T) {
+	repo := newTestRepo(t)
+	first := repo.commit("First commit\n\nBug: 123", map[string]string{"a.txt": "a\n"})
+	second := repo.commit("Second commit", map[string]string{"b.txt": "b\n", "a.txt": ""})
+
+	origin := newTestOrigin(t, &Origin{url: repo.url(), ref: "main", firstParent: true})
+
+	changes, err := origin.Changes("")
+	if err != nil {
+		t.Fatalf("Changes() error: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("len(changes) = %d, want 2", len(changes))
+	}
+
+	c := changes[0]
+	if c.Ref != first || c.Author != "Test Author <author@example.com>" {
+		t.Errorf("changes[0] = %s by %s", c.Ref, c.Author)
+	}
+	if !strings.HasPrefix(c.Message, "First commit") || c.FirstLineMessage() != "First commit" {
+		t.Errorf("changes[0].Message = %q", c.Message)
+	}
+	if !c.Date.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("changes[0].Date = %v", c.Date)
+	}
+	if !slices.Equal(c.Labels["Bug"], []string{"123"}) {
+		t.Errorf("changes[0].Labels = %v", c.Labels)
+	}
+	if !slices.Equal(changes[1].Files, []string{"a.txt", "b.txt"}) {
+		t.Errorf("changes[1].Files = %v", changes[1].Files)
+	}
+	if origin.Ref() != second {
+		t.Errorf("Ref() = %q, want %q", origin.Ref(), second)
+	}
+
+	since, err := origin.Changes(first)
+	if err != nil {
+		t.Fatalf("Changes(baseline) error: %v", err)
+	}
+	if len(since) != 1 || since[0].Ref != second {
+		t.Errorf("Changes(baseline) = %v", since)
+	}
+
+	// Baselines come from destination labels and must not be read as git
+	// options.
+	output := filepath.Join(t.TempDir(), "output")
+	for _, baseline := range []string{"--output=" + output, "0123456789012345678901234567890123456789"} {
+		if _, err := origin.Changes(baseline); err == nil {
+			t.Errorf("Changes(%q) should fail", baseline)
+		}
+	}
+	if _, err := os.Stat(output); err == nil {
+		t.Error("a baseline label value was read as a git option")
+	}
+}
+
+func TestOriginImplCheckout(t *testing.T) {
+	repo := newTestRepo(t)
+	first := repo.commit("First", map[string]string{"a.txt": "v1\n"})
+	repo.git("tag", "v1")
+	repo.commit("Second", map[string]string{"a.txt": "v2\n", "bin/run.sh": "#!/bin/sh\n"})
+	repo.git("update-index", "--chmod=+x", "bin/run.sh")
+	repo.git("commit", "--quiet", "-m", "Make executable")
+
+	for _, ref := range []string{"v1", first, first[:10]} {
+		t.Run(ref, func(t *testing.T) {
+			origin := newTestOrigin(t, &Origin{url: repo.url(), ref: "main", firstParent: true})
+			if err := origin.Checkout(ref); err != nil {
+				t.Fatalf("Checkout(%q) error: %v", ref, err)
+			}
+			if origin.Ref() != first {
+				t.Errorf("Ref() = %q, want %q", origin.Ref(), first)
+			}
+		})
+	}
+
+	origin := newTestOrigin(t, &Origin{url: repo.url(), ref: "main", firstParent: true})
+	dir := t.TempDir()
+	if err := origin.CopyTo(dir); err != nil {
+		t.Fatalf("CopyTo() error: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+	if err != nil || string(data) != "v2\n" {
+		t.Errorf("a.txt = %q, %v", data, err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "bin/run.sh"))
+	if err != nil || info.Mode().Perm()&0o100 == 0 {
+		t.Errorf("bin/run.sh should be executable: %v %v", info, err)
+	}
+
+	if err := origin.Checkout("missing"); err == nil {
+		t.Error("expected error for unknown reference")
+	}
+}
+
+func TestOriginImplMerges(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.commit("Base", map[string]string{"a.txt": "a\n"})
+	repo.git("checkout", "--quiet", "-b", "feature")
+	repo.commit("Feature work", map[string]string{"f.txt": "f\n"})
+	repo.git("checkout", "--quiet", "main")
+	repo.commit("Main work", map[string]string{"m.txt": "m\n"})
+	repo.git("merge", "--quiet", "--no-ff", "-m", "Merge feature", "feature")
+
+	t.Run("first parent", func(t *testing.T) {
+		origin := newTestOrigin(t, &Origin{url: repo.url(), ref: "main", firstParent: true})
+		changes, err := origin.Changes("")
+		if err != nil {
+			t.Fatalf("Changes() error: %v", err)
+		}
+		if len(changes) != 3 {
+			t.Fatalf("len(changes) = %d, want 3", len(changes))
+		}
+		merge := changes[2]
+		if !merge.IsMerge || !slices.Equal(merge.Files, []string{"f.txt"}) {
+			t.Errorf("merge = %+v", merge)
+		}
+		if strings.Contains(merge.Message, "Feature work") {
+			t.Errorf("merge message should not include branch logs: %q", merge.Message)
+		}
+	})
+
+	t.Run("all parents", func(t *testing.T) {
+		origin := newTestOrigin(t, &Origin{url: repo.url(), ref: "main"})
+		changes, err := origin.Changes("")
+		if err != nil {
+			t.Fatalf("Changes() error: %v", err)
+		}
+		if len(changes) != 4 {
+			t.Errorf("len(changes) = %d, want 4", len(changes))
+		}
+	})
+
+	t.Run("include branch commit logs", func(t *testing.T) {
+		origin := newTestOrigin(t, &Origin{url: repo.url(), ref: "main", firstParent: true, includeBranchCommitLogs: true})
+		changes, err := origin.Changes("")
+		if err != nil {
+			t.Fatalf("Changes() error: %v", err)
+		}
+		merge := changes[len(changes)-1]
+		if !strings.HasPrefix(merge.Message, "Merge feature\n") || !strings.Contains(merge.Message, "  Feature work\n") {
+			t.Errorf("merge message = %q", merge.Message)
+		}
+	})
+}
+
+func TestOriginImplPartialFetch(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.git("config", "uploadpack.allowFilter", "true")
+	repo.commit("First", map[string]string{"a.txt": "a\n"})
+
+	origin := newTestOrigin(t, &Origin{url: repo.url(), ref: "main", firstParent: true, partialFetch: true})
+	dir := t.TempDir()
+	if err := origin.CopyTo(dir); err != nil {
+		t.Fatalf("CopyTo() error: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "a.txt")); err != nil || string(data) != "a\n" {
+		t.Errorf("a.txt = %q, %v", data, err)
+	}
+}
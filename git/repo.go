@@ -0,0 +1,225 @@
+package git
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// commitSHA matches a full SHA-1 or SHA-256 object name.
+var commitSHA = regexp.MustCompile(`^(?:[0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// Repo is a local git repository driven through the git command line.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/git/GitRepository.java
+type Repo struct {
+	gitDir   string
+	workTree string
+	env      []string
+}
+
+// OpenRepo returns the bare repository at dir, creating it if needed.
+func OpenRepo(dir string) (*Repo, error) {
+	r := &Repo{gitDir: dir}
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); err == nil {
+		return r, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create repository directory: %w", err)
+	}
+	if _, err := r.Run("init", "--bare", "--quiet"); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// cacheDir returns the directory used to cache the repository at url.
+// kind keeps the caches of origins and destinations apart.
+func cacheDir(kind, url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(os.TempDir(), "copybara", "git", kind, hex.EncodeToString(sum[:])[:16])
+}
+
+// Dir returns the git directory.
+func (r *Repo) Dir() string {
+	return r.gitDir
+}
+
+// WithWorkTree returns a copy of the repository that uses dir as work tree.
+func (r *Repo) WithWorkTree(dir string) *Repo {
+	return &Repo{gitDir: r.gitDir, workTree: dir, env: r.env}
+}
+
+// WithEnv returns a copy of the repository that runs git with extra
+// environment variables.
+func (r *Repo) WithEnv(env ...string) *Repo {
+	return &Repo{gitDir: r.gitDir, workTree: r.workTree, env: append(append([]string(nil), r.env...), env...)}
+}
+
+// Run runs a git command and returns its standard output.
+func (r *Repo) Run(args ...string) (string, error) {
+	var stdout bytes.Buffer
+	if err := r.exec(nil, &stdout, args...); err != nil {
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// RunInput runs a git command with the given standard input and returns
+// its standard output.
+func (r *Repo) RunInput(stdin string, args ...string) (string, error) {
+	var stdout bytes.Buffer
+	if err := r.exec(strings.NewReader(stdin), &stdout, args...); err != nil {
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// exec runs a git command with the given standard input and output.
+func (r *Repo) exec(stdin io.Reader, stdout io.Writer, args ...string) error {
+	full := []string{"--git-dir", r.gitDir}
+	if r.workTree != "" {
+		full = append(full, "--work-tree", r.workTree)
+	}
+	full = append(full, args...)
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", full...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Env = append(cmd.Env, r.env...)
+	if r.workTree != "" {
+		cmd.Dir = r.workTree
+	}
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// SetRemote configures the named remote to point at url.
+func (r *Repo) SetRemote(name, url string) error {
+	if _, err := r.Run("remote", "set-url", "--", name, url); err == nil {
+		return nil
+	}
+	_, err := r.Run("remote", "add", "--", name, url)
+	return err
+}
+
+// untrustedURLSchemes are the URL schemes allowed for repositories named
+// by origin content, such as integrate labels and .gitmodules files.
+var untrustedURLSchemes = []string{"https", "ssh", "file"}
+
+// checkUntrustedURL verifies a repository URL taken from origin content:
+// it must use one of untrustedURLSchemes or be a local path, and may not
+// look like a git option. kind names the URL in errors.
+func checkUntrustedURL(kind, url string) error {
+	if strings.HasPrefix(url, "-") {
+		return fmt.Errorf("invalid %s URL %q", kind, url)
+	}
+	if scheme, _, ok := strings.Cut(url, "://"); ok {
+		if !slices.Contains(untrustedURLSchemes, scheme) {
+			return fmt.Errorf("unsupported %s URL scheme %q, expected one of %s",
+				kind, scheme, strings.Join(untrustedURLSchemes, ", "))
+		}
+	} else if strings.Contains(url, ":") {
+		// scp-like addresses and transport helpers such as ext::
+		return fmt.Errorf("unsupported %s URL %q, expected one of %s or a local path",
+			kind, url, strings.Join(untrustedURLSchemes, ", "))
+	}
+	return nil
+}
+
+// Fetch fetches refspecs from the named remote. A partial fetch skips
+// downloading file contents until they are needed.
+func (r *Repo) Fetch(remote string, partial bool, refspecs ...string) error {
+	args := []string{"fetch", "--quiet", "--force", "--no-tags"}
+	if partial {
+		args = append(args, "--filter=blob:none")
+	}
+	args = append(args, "--", remote)
+	args = append(args, refspecs...)
+	_, err := r.Run(args...)
+	return err
+}
+
+// ResolveCommit returns the commit SHA-1 of the first candidate revision
+// that exists.
+func (r *Repo) ResolveCommit(candidates ...string) (string, error) {
+	for _, rev := range candidates {
+		out, err := r.Run("rev-parse", "--verify", "--quiet", rev+"^{commit}")
+		if err == nil {
+			return strings.TrimSpace(out), nil
+		}
+	}
+	return "", fmt.Errorf("cannot resolve reference %q", candidates[0])
+}
+
+// Extract writes the tree of the given revision into dir, preserving
+// executable bits and symlinks.
+func (r *Repo) Extract(rev, dir string) error {
+	var archive bytes.Buffer
+	if err := r.exec(nil, &archive, "archive", "--format=tar", rev); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(&archive)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive of %s: %w", rev, err)
+		}
+
+		if !filepath.IsLocal(hdr.Name) {
+			return fmt.Errorf("invalid path in archive of %s: %s", rev, hdr.Name)
+		}
+		path := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, path); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode).Perm()) //nolint:gosec // path is checked to be local to dir
+			if err != nil {
+				return err
+			}
+			_, copyErr := io.Copy(f, tr) //nolint:gosec // archive comes from a local repository
+			closeErr := f.Close()
+			if copyErr != nil {
+				return copyErr
+			}
+			if closeErr != nil {
+				return closeErr
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package git
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// gitlinkMode is the tree entry mode of submodule commits.
+const gitlinkMode = "160000"
+
+// submodule is a gitlink in a tree together with its configured URL.
+type submodule struct {
+	path   string
+	commit string
+	url    string
+}
+
+// gitlinks returns the submodule commits in the tree of rev, keyed by path.
+func gitlinks(repo *Repo, rev string) (map[string]string, error) {
+	entries, err := lsTree(repo, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	links := make(map[string]string)
+	for p, entry := range entries {
+		if entry.mode == gitlinkMode {
+			links[p] = entry.sha
+		}
+	}
+	return links, nil
+}
+
+// submodules returns the gitlinks of rev with the URL configured for them
+// in .gitmodules. As .gitmodules is origin content, the URLs are checked
+// with checkUntrustedURL. Relative URLs are resolved against baseURL.
+func submodules(repo *Repo, rev, baseURL string) ([]submodule, error) {
+	links, err := gitlinks(repo, rev)
+	if err != nil || len(links) == 0 {
+		return nil, err
+	}
+
+	out, err := repo.Run("config", "--blob", rev+":.gitmodules", "--get-regexp", `^submodule\..*\.(path|url)$`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .gitmodules of %s: %w", rev, err)
+	}
+
+	paths := make(map[string]string)
+	urls := make(map[string]string)
+	for line := range strings.SplitSeq(strings.TrimSpace(out), "\n") {
+		// Keys are "submodule.<name>.<field>"; names may contain dots.
+		key, value, _ := strings.Cut(line, " ")
+		i := strings.LastIndex(key, ".")
+		if i <= len("submodule.") {
+			continue
+		}
+		name, field := key[len("submodule."):i], key[i+1:]
+		switch field {
+		case "path":
+			paths[name] = value
+		case "url":
+			urls[name] = value
+		}
+	}
+
+	var result []submodule
+	for name, p := range paths {
+		commit, ok := links[p]
+		if !ok {
+			continue
+		}
+		u, ok := urls[name]
+		if !ok {
+			return nil, fmt.Errorf("submodule %q has no url in .gitmodules", name)
+		}
+		if err := checkUntrustedURL("submodule", u); err != nil {
+			return nil, fmt.Errorf("submodule %q: %w", name, err)
+		}
+		result = append(result, submodule{path: p, commit: commit, url: resolveSubmoduleURL(baseURL, u)})
+		delete(links, p)
+	}
+	for p := range links {
+		return nil, fmt.Errorf("submodule at %q is not configured in .gitmodules", p)
+	}
+	return result, nil
+}
+
+// resolveSubmoduleURL resolves a "./" or "../" submodule URL against the
+// URL of the superproject.
+func resolveSubmoduleURL(baseURL, rawURL string) string {
+	if !strings.HasPrefix(rawURL, "./") && !strings.HasPrefix(rawURL, "../") {
+		return rawURL
+	}
+	if u, err := url.Parse(baseURL); err == nil && u.Scheme != "" {
+		u.Path = path.Join(u.Path, rawURL)
+		return u.String()
+	}
+	return path.Join(baseURL, rawURL)
+}
+
+// extractSubmodules writes the contents of the submodules of rev into dir.
+// With recursive, the submodules of the submodules are extracted too.
+func extractSubmodules(repo *Repo, rev, baseURL, dir string, recursive bool) error {
+	mods, err := submodules(repo, rev, baseURL)
+	if err != nil {
+		return err
+	}
+
+	for _, mod := range mods {
+		subRepo, err := OpenRepo(cacheDir("submodule", mod.url))
+		if err != nil {
+			return err
+		}
+		if err := subRepo.SetRemote(originRemote, mod.url); err != nil {
+			return err
+		}
+		if _, err := subRepo.ResolveCommit(mod.commit); err != nil {
+			if err := subRepo.Fetch(originRemote, false, originRefspecs...); err != nil {
+				return fmt.Errorf("failed to fetch submodule %s from %s: %w", mod.path, mod.url, err)
+			}
+		}
+		if _, err := subRepo.ResolveCommit(mod.commit); err != nil {
+			return fmt.Errorf("submodule %s: commit %s not found in %s", mod.path, mod.commit, mod.url)
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(mod.path))
+		if err := os.MkdirAll(target, 0o755); err != nil {
+			return err
+		}
+		if err := subRepo.Extract(mod.commit, target); err != nil {
+			return fmt.Errorf("failed to extract submodule %s: %w", mod.path, err)
+		}
+
+		if recursive {
+			if err := extractSubmodules(subRepo, mod.commit, mod.url, target, true); err != nil {
+				return err
+			}
+		} else if err := removeGitlinkDirs(subRepo, mod.commit, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeGitlinkDirs removes the empty directories git archive writes for
+// the gitlinks of rev.
+func removeGitlinkDirs(repo *Repo, rev, dir string) error {
+	links, err := gitlinks(repo, rev)
+	if err != nil {
+		return err
+	}
+	for p := range links {
+		if err := os.Remove(filepath.Join(dir, filepath.FromSlash(p))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// addSubmodule records sub at commit as a submodule of r at path, with the
+// given URL in .gitmodules, and commits it.
+func (r *testRepo) addSubmodule(path, url, commit string) string {
+	r.t.Helper()
+	if err := os.MkdirAll(filepath.Join(r.dir, path), 0o755); err != nil {
+		r.t.Fatal(err)
+	}
+	r.git("config", "--file", ".gitmodules", "submodule."+path+".path", path)
+	r.git("config", "--file", ".gitmodules", "submodule."+path+".url", url)
+	r.git("update-index", "--add", "--cacheinfo", gitlinkMode+","+commit+","+path)
+	return r.commit("Add "+path, nil)
+}
+
+// submoduleRepos creates a repository with a submodule "sub" (referenced
+// by a relative URL) that has a nested submodule "nested".
+func submoduleRepos(t *testing.T) (top *testRepo, subCommit string) {
+	t.Helper()
+	leaf := newTestRepo(t)
+	leafCommit := leaf.commit("Leaf", map[string]string{"leaf.txt": "leaf\n"})
+
+	mid := newTestRepo(t)
+	mid.commit("Mid", map[string]string{"mid.txt": "mid\n"})
+	subCommit = mid.addSubmodule("nested", leaf.url(), leafCommit)
+
+	top = newTestRepo(t)
+	top.commit("Top", map[string]string{"top.txt": "top\n"})
+	top.addSubmodule("sub", "../"+filepath.Base(mid.dir), subCommit)
+	return top, subCommit
+}
+
+func TestOriginImplSubmodules(t *testing.T) {
+	top, subCommit := submoduleRepos(t)
+
+	tests := []struct {
+		strategy SubmoduleStrategy
+		present  []string
+		absent   []string
+	}{
+		{SubmoduleNo, []string{"top.txt"}, []string{"sub"}},
+		{SubmoduleYes, []string{"top.txt", "sub/mid.txt"}, []string{"sub/nested"}},
+		{SubmoduleRecursive, []string{"top.txt", "sub/mid.txt", "sub/nested/leaf.txt"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			origin := newTestOrigin(t, &Origin{url: top.url(), ref: "main", firstParent: true, submodules: tt.strategy})
+			dir := t.TempDir()
+			if err := origin.CopyTo(dir); err != nil {
+				t.Fatalf("CopyTo() error: %v", err)
+			}
+
+			for _, path := range tt.present {
+				if _, err := os.Stat(filepath.Join(dir, path)); err != nil {
+					t.Errorf("%s should exist: %v", path, err)
+				}
+			}
+			for _, path := range tt.absent {
+				if _, err := os.Stat(filepath.Join(dir, path)); !os.IsNotExist(err) {
+					t.Errorf("%s should not exist", path)
+				}
+			}
+
+			changes, err := origin.Changes("")
+			if err != nil {
+				t.Fatalf("Changes() error: %v", err)
+			}
+			last := changes[len(changes)-1]
+			if tt.strategy == SubmoduleNo {
+				if last.Submodules != nil {
+					t.Errorf("Submodules = %v, want none", last.Submodules)
+				}
+			} else if last.Submodules["sub"] != subCommit {
+				t.Errorf("Submodules = %v, want sub at %s", last.Submodules, subCommit)
+			}
+		})
+	}
+}
+
+func TestOriginImplSubmoduleUnsafeURL(t *testing.T) {
+	leaf := newTestRepo(t)
+	leafCommit := leaf.commit("Leaf", map[string]string{"leaf.txt": "leaf\n"})
+	marker := filepath.Join(t.TempDir(), "pwned")
+
+	for _, url := range []string{
+		"--upload-pack=touch " + marker,
+		"ext::sh -c touch% " + marker,
+		"http://example.com/sub.git",
+	} {
+		t.Run(url, func(t *testing.T) {
+			top := newTestRepo(t)
+			top.commit("Top", map[string]string{"top.txt": "top\n"})
+			top.addSubmodule("sub", url, leafCommit)
+
+			origin := newTestOrigin(t, &Origin{url: top.url(), ref: "main", submodules: SubmoduleYes})
+			if err := origin.CopyTo(t.TempDir()); err == nil {
+				t.Errorf("CopyTo() should reject submodule URL %q", url)
+			}
+		})
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("a submodule URL ran a command")
+	}
+}
+
+func TestResolveSubmoduleURL(t *testing.T) {
+	tests := []struct {
+		base, url, want string
+	}{
+		{"https://example.com/org/repo", "../other", "https://example.com/org/other"},
+		{"file:///tmp/a/top", "../mid", "file:///tmp/a/mid"},
+		{"https://example.com/org/repo", "https://example.com/lib", "https://example.com/lib"},
+		{"/srv/git/repo", "./sub", "/srv/git/repo/sub"},
+	}
+	for _, tt := range tests {
+		if got := resolveSubmoduleURL(tt.base, tt.url); got != tt.want {
+			t.Errorf("resolveSubmoduleURL(%q, %q) = %q, want %q", tt.base, tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package git
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// labelReference matches ${LABEL} references in templates.
+var labelReference = regexp.MustCompile(`\$\{([A-Za-z][A-Za-z0-9_-]*)\}`)
+
+// expandTemplate replaces ${LABEL} references with the first value of the
+// label. It fails if a referenced label has no value.
+func expandTemplate(template string, labels map[string][]string) (string, error) {
+	var missing []string
+	result := labelReference.ReplaceAllStringFunc(template, func(match string) string {
+		name := match[2 : len(match)-1]
+		if values := labels[name]; len(values) > 0 {
+			return values[0]
+		}
+		missing = append(missing, name)
+		return match
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("cannot find label %q for template %q", missing[0], template)
+	}
+	return result, nil
+}
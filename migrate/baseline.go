@@ -0,0 +1,124 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/albertocavalcante/starlark-go-copybara/core"
+	"github.com/albertocavalcante/starlark-go-copybara/git"
+	"github.com/albertocavalcante/starlark-go-copybara/vcs"
+)
+
+// RevIDLabel returns the name of the label that records the migrated origin
+// revision in the destination: the workflow custom_rev_id, or GitOrigin-RevId.
+func RevIDLabel(wf *core.Workflow) string {
+	if label := wf.CustomRevID(); label != "" {
+		return label
+	}
+	return git.OriginRevIDLabel
+}
+
+// FindBaseline returns the last origin revision migrated to destination.
+//
+// Options.InitHistory ignores previous migrations and Options.LastRev
+// overrides the revision found in the destination. Otherwise the
+// destination history is scanned for the workflow rev-id label. An empty
+// baseline is returned when the destination does not record history or
+// no previous migration is found.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/WorkflowRunHelper.java
+func FindBaseline(wf *core.Workflow, destination vcs.Destination, opts Options) (string, error) {
+	if opts.InitHistory {
+		return "", nil
+	}
+	if opts.LastRev != "" {
+		return opts.LastRev, nil
+	}
+
+	finder, ok := destination.(vcs.LastRevFinder)
+	if !ok {
+		return "", nil
+	}
+	label := RevIDLabel(wf)
+	rev, err := finder.LastRev(label)
+	if err != nil {
+		return "", fmt.Errorf("failed to find %s in destination history: %w", label, err)
+	}
+	return rev, nil
+}
+
+// FindChangeRequestBaseline returns the destination revision a change
+// request is based on, and the changes of the request.
+//
+// history lists the origin changes up to the change request, oldest first.
+// The parents of the last change are searched, newest first, for the given
+// rev-id label; the changes after the labeled one form the request.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/WorkflowMode.java
+func FindChangeRequestBaseline(history []*vcs.Change, label string) (string, []*vcs.Change, error) {
+	for i := len(history) - 2; i >= 0; i-- {
+		if values := history[i].Labels[label]; len(values) > 0 {
+			return values[len(values)-1], history[i+1:], nil
+		}
+	}
+
+	ref := "change request"
+	if len(history) > 0 {
+		ref = history[len(history)-1].Ref
+	}
+	return "", nil, fmt.Errorf("%w: no parent of %s has a %s label; use --last-rev to set the destination baseline",
+		ErrNoBaseline, ref, label)
+}
+
+// NotExportedError is returned in CHANGE_REQUEST_FROM_SOT mode when the
+// source-of-truth revision a pending change is based on has not been
+// migrated to the destination yet.
+type NotExportedError struct {
+	// Change is the origin reference of the pending change.
+	Change string
+
+	// Revision is the origin revision the change is based on.
+	Revision string
+
+	// Label is the rev-id label searched in the destination history.
+	Label string
+}
+
+func (e *NotExportedError) Error() string {
+	return fmt.Sprintf("change %s is based on origin revision %s, which has not been exported to the destination yet "+
+		"(no commit has %s: %s); migrate it first or use --last-rev to set the destination baseline",
+		e.Change, e.Revision, e.Label, e.Revision)
+}
+
+// Is makes NotExportedError match ErrNoBaseline.
+func (e *NotExportedError) Is(target error) bool {
+	return target == ErrNoBaseline
+}
+
+// FindSOTBaseline returns the destination revision that imported the origin
+// revision the last change of history is based on.
+//
+// history lists the origin changes up to the pending change, oldest first;
+// the change before the last one is its source-of-truth parent.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/WorkflowMode.java
+func FindSOTBaseline(destination vcs.Destination, history []*vcs.Change, label string) (string, error) {
+	finder, ok := destination.(vcs.LabelFinder)
+	if !ok {
+		return "", fmt.Errorf("%w: destination cannot look up imported revisions", ErrInvalidConfig)
+	}
+	if len(history) < 2 {
+		return "", errors.New("pending change has no parent in the origin")
+	}
+
+	change := history[len(history)-1].Ref
+	parent := history[len(history)-2].Ref
+	baseline, err := finder.FindByLabel(label, parent)
+	if err != nil {
+		return "", fmt.Errorf("failed to find %s: %s in destination history: %w", label, parent, err)
+	}
+	if baseline == "" {
+		return "", &NotExportedError{Change: change, Revision: parent, Label: label}
+	}
+	return baseline, nil
+}
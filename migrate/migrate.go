@@ -0,0 +1,608 @@
+// Package migrate executes Copybara workflows.
+//
+// A migration checks out the workflow origin into a working directory,
+// keeps only the files selected by origin_files, applies the workflow
+// transformations and writes the result to the destination, replacing the
+// files selected by destination_files.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/Workflow.java
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"go.starlark.net/starlark"
+
+	"github.com/albertocavalcante/starlark-go-copybara/authoring"
+	"github.com/albertocavalcante/starlark-go-copybara/core"
+	"github.com/albertocavalcante/starlark-go-copybara/folder"
+	"github.com/albertocavalcante/starlark-go-copybara/git"
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+	"github.com/albertocavalcante/starlark-go-copybara/vcs"
+)
+
+// DefaultSquashMessage is the commit message used for SQUASH migrations
+// before metadata transformations are applied.
+const DefaultSquashMessage = "Project import generated by Copybara.\n"
+
+// ErrInvalidConfig is returned when a workflow cannot be executed because of
+// its configuration (e.g. an unsupported origin or destination).
+var ErrInvalidConfig = errors.New("invalid workflow configuration")
+
+// ErrNoBaseline is returned when the revision a migration is based on
+// cannot be found and no override is given.
+var ErrNoBaseline = errors.New("no previous migration found")
+
+// ErrNoopFailure is matched by the error of a no-op transformation when the
+// workflow noop_behavior is FAIL_IF_ANY_NOOP. Unlike transform.ErrNoop, it
+// reports a failed migration rather than a migration with nothing to do.
+var ErrNoopFailure = errors.New("no-op transformation not allowed by noop_behavior FAIL_IF_ANY_NOOP")
+
+// Options configures a migration run.
+type Options struct {
+	// WorkDir is the directory used to materialize the origin. When empty,
+	// a temporary directory is created and removed after the run.
+	WorkDir string
+
+	// DryRun computes the migration without writing to the destination.
+	DryRun bool
+
+	// Ref is the origin reference to migrate. When empty, the origin's
+	// configured reference is used.
+	Ref string
+
+	// LastRev overrides the last migrated origin revision found in the
+	// destination history (--last-rev).
+	LastRev string
+
+	// InitHistory migrates the whole origin history, ignoring previous
+	// migrations recorded in the destination (--init-history).
+	InitHistory bool
+
+	// Console receives the messages printed by transformations. When nil,
+	// they are discarded.
+	Console io.Writer
+
+	// IgnoreNoop ignores no-op transformations, whatever the workflow and
+	// core.transform noop_behavior (--ignore-noop).
+	IgnoreNoop bool
+}
+
+// Result describes the outcome of a migration run.
+type Result struct {
+	// Workflow is the name of the workflow that was run.
+	Workflow string
+
+	// Mode is the workflow mode used.
+	Mode core.WorkflowMode
+
+	// OriginRef is the origin reference that was migrated.
+	OriginRef string
+
+	// Baseline is the last origin revision migrated before this run, if any.
+	Baseline string
+
+	// DestinationRef is the reference created in the destination, if any.
+	DestinationRef string
+
+	// ChangeRequest identifies the change request created or updated in
+	// the destination, if any.
+	ChangeRequest string
+
+	// Message is the final commit message after transformations.
+	Message string
+
+	// Author is the resolved author of the migrated change.
+	Author string
+
+	// Files lists the destination files changed by the migration.
+	Files []vcs.FileChange
+
+	// NoChanges is true when the migration did not change the destination.
+	NoChanges bool
+
+	// Noops describes the no-op transformations that were ignored.
+	Noops []string
+
+	// Migrated holds the result of each origin change in ITERATIVE mode,
+	// oldest first. The fields above then describe the whole run.
+	Migrated []*Result
+}
+
+// TransformationError is returned when a workflow transformation fails.
+type TransformationError struct {
+	// Index is the position of the transformation in the workflow.
+	Index int
+
+	// Description is the transformation description.
+	Description string
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *TransformationError) Error() string {
+	return fmt.Sprintf("transformation %d (%s) failed: %v", e.Index, e.Description, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *TransformationError) Unwrap() error {
+	return e.Err
+}
+
+// IterativeError is returned when an ITERATIVE run fails to migrate one of
+// the pending changes. The changes before it were already written.
+type IterativeError struct {
+	// Change is the origin reference of the change that failed.
+	Change string
+
+	// Pending is the number of changes the run tried to migrate.
+	Pending int
+
+	// Migrated holds the results of the changes written before the failure.
+	Migrated []*Result
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *IterativeError) Error() string {
+	return fmt.Sprintf("failed to migrate change %s (%d of %d change(s) migrated): %v",
+		e.Change, len(e.Migrated), e.Pending, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *IterativeError) Unwrap() error {
+	return e.Err
+}
+
+// Run executes the given workflow.
+//
+// In SQUASH mode the pending origin changes are migrated as a single
+// destination change. In ITERATIVE mode each pending change is migrated
+// separately, oldest first. In CHANGE_REQUEST and CHANGE_REQUEST_FROM_SOT
+// modes the checked out origin change is written on top of the destination
+// revision it is based on.
+func Run(ctx context.Context, wf *core.Workflow, opts Options) (*Result, error) {
+	switch wf.Mode() {
+	case core.ModeSquash, core.ModeIterative, core.ModeChangeRequest, core.ModeChangeRequestFromSOT:
+	default:
+		return nil, fmt.Errorf("%w: workflow %q: mode %s is not supported", ErrInvalidConfig, wf.Name(), wf.Mode())
+	}
+
+	origin, err := ResolveOrigin(wf.Origin())
+	if err != nil {
+		return nil, fmt.Errorf("workflow %q: %w", wf.Name(), err)
+	}
+
+	destination, err := ResolveDestination(wf.Destination())
+	if err != nil {
+		return nil, fmt.Errorf("workflow %q: %w", wf.Name(), err)
+	}
+
+	workDir, cleanup, err := prepareWorkDir(opts.WorkDir)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	contextRef := opts.Ref
+	if contextRef == "" {
+		contextRef = origin.Ref()
+	}
+	if opts.Ref != "" {
+		if err := origin.Checkout(opts.Ref); err != nil {
+			return nil, fmt.Errorf("failed to checkout %q: %w", opts.Ref, err)
+		}
+	}
+
+	m := &migration{
+		wf:          wf,
+		origin:      origin,
+		destination: destination,
+		workDir:     workDir,
+		contextRef:  contextRef,
+		opts:        opts,
+	}
+	if m.isChangeRequest() {
+		return m.changeRequest(ctx)
+	}
+
+	baseline, err := FindBaseline(wf, destination, opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := destination.(vcs.LastRevFinder); ok && baseline == "" && !opts.InitHistory && wf.Mode() == core.ModeIterative {
+		return nil, fmt.Errorf("%w: %s not found in destination history; use --last-rev or --init-history",
+			ErrNoBaseline, RevIDLabel(wf))
+	}
+
+	changes, err := origin.Changes(baseline)
+	if err != nil {
+		if baseline != "" {
+			return nil, fmt.Errorf("failed to read origin changes since %s: %w", baseline, err)
+		}
+		return nil, fmt.Errorf("failed to read origin changes: %w", err)
+	}
+	if baseline != "" && len(changes) == 0 {
+		return &Result{
+			Workflow:  wf.Name(),
+			Mode:      wf.Mode(),
+			OriginRef: origin.Ref(),
+			Baseline:  baseline,
+			NoChanges: true,
+		}, nil
+	}
+
+	if wf.Mode() == core.ModeIterative {
+		return m.iterative(ctx, changes, baseline)
+	}
+
+	originRef := opts.Ref
+	if originRef == "" && len(changes) > 0 {
+		originRef = changes[len(changes)-1].Ref
+	}
+	tctx := NewContext(wf, "", changes)
+	tctx.Message = DefaultSquashMessage
+	return m.migrate(ctx, tctx, originRef, baseline)
+}
+
+// migration holds the state shared by the destination writes of a run.
+type migration struct {
+	wf          *core.Workflow
+	origin      vcs.Origin
+	destination vcs.Destination
+	workDir     string
+	contextRef  string
+	opts        Options
+}
+
+// iterative migrates each change on its own, stopping at the first failure.
+// Changes that do not modify the destination are skipped.
+func (m *migration) iterative(ctx context.Context, changes []*vcs.Change, baseline string) (*Result, error) {
+	result := &Result{
+		Workflow:  m.wf.Name(),
+		Mode:      m.wf.Mode(),
+		Baseline:  baseline,
+		NoChanges: true,
+	}
+
+	for _, change := range changes {
+		if err := m.origin.Checkout(change.Ref); err != nil {
+			return nil, &IterativeError{Change: change.Ref, Pending: len(changes), Migrated: result.Migrated, Err: err}
+		}
+
+		tctx := NewContext(m.wf, "", []*vcs.Change{change})
+		tctx.Message = change.Message
+		tctx.Labels = transform.ParseLabels(change.Message)
+
+		step, err := m.migrate(ctx, tctx, change.Ref, baseline)
+		if err != nil {
+			return nil, &IterativeError{Change: change.Ref, Pending: len(changes), Migrated: result.Migrated, Err: err}
+		}
+		result.Migrated = append(result.Migrated, step)
+		result.Noops = append(result.Noops, step.Noops...)
+		baseline = change.Ref
+
+		result.OriginRef = step.OriginRef
+		if !step.NoChanges {
+			result.DestinationRef = step.DestinationRef
+			result.ChangeRequest = step.ChangeRequest
+			result.Message = step.Message
+			result.Author = step.Author
+			result.Files = append(result.Files, step.Files...)
+			result.NoChanges = false
+		}
+	}
+	return result, nil
+}
+
+// changeRequest migrates the checked out origin change on top of the
+// destination revision it is based on: the revision recorded in its parents
+// in CHANGE_REQUEST mode, or the destination change that imported its
+// parent in CHANGE_REQUEST_FROM_SOT mode. Options.LastRev overrides the
+// destination baseline.
+func (m *migration) changeRequest(ctx context.Context) (*Result, error) {
+	if _, ok := m.destination.(vcs.ChangeRequestWriter); !ok {
+		return nil, fmt.Errorf("%w: workflow %q: destination %s does not support mode %s",
+			ErrInvalidConfig, m.wf.Name(), m.wf.Destination().Type(), m.wf.Mode())
+	}
+
+	history, err := m.origin.Changes("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read origin changes: %w", err)
+	}
+	if len(history) == 0 {
+		return nil, fmt.Errorf("origin %s has no changes", m.origin.URL())
+	}
+
+	var baseline string
+	var pending []*vcs.Change
+	switch {
+	case m.opts.LastRev != "":
+		baseline, pending = m.opts.LastRev, history[len(history)-1:]
+	case m.wf.Mode() == core.ModeChangeRequestFromSOT:
+		baseline, err = FindSOTBaseline(m.destination, history, RevIDLabel(m.wf))
+		pending = history[len(history)-1:]
+	default:
+		baseline, pending, err = FindChangeRequestBaseline(history, RevIDLabel(m.wf))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	change := pending[len(pending)-1]
+	tctx := NewContext(m.wf, "", pending)
+	tctx.Message = change.Message
+	tctx.Labels = transform.ParseLabels(change.Message)
+	return m.migrate(ctx, tctx, change.Ref, baseline)
+}
+
+// isChangeRequest returns true if the workflow writes changes on top of a
+// destination baseline.
+func (m *migration) isChangeRequest() bool {
+	return m.wf.Mode() == core.ModeChangeRequest || m.wf.Mode() == core.ModeChangeRequestFromSOT
+}
+
+// migrate checks out the origin, applies the workflow transformations to
+// tctx and writes the result to the destination as a single change.
+func (m *migration) migrate(ctx context.Context, tctx *transform.Context, originRef, baseline string) (*Result, error) {
+	wf := m.wf
+
+	checkoutDir, err := Checkout(m.origin, wf.OriginFiles(), m.workDir)
+	if err != nil {
+		return nil, err
+	}
+	tctx.WorkDir = checkoutDir
+	tctx.Console = m.opts.Console
+	tctx.IgnoreNoop = m.opts.IgnoreNoop
+
+	var originalDir string
+	if wf.ReversibleCheck() {
+		originalDir = filepath.Join(m.workDir, "original")
+		if err := copyTree(checkoutDir, originalDir); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ApplyTransformations(ctx, wf, tctx); err != nil {
+		return nil, err
+	}
+
+	if wf.ReversibleCheck() {
+		if err := CheckReversible(ctx, wf, originalDir, checkoutDir, m.workDir); err != nil {
+			return nil, err
+		}
+	}
+
+	transformResult := &vcs.TransformResult{
+		WorkDir:          checkoutDir,
+		DestinationFiles: wf.DestinationFiles(),
+		OriginRef:        originRef,
+		RevIDLabel:       RevIDLabel(wf),
+		Message:          tctx.Message,
+		Author:           tctx.Author,
+		Changes:          tctx.Changes.Current,
+		DryRun:           m.opts.DryRun,
+		Workflow:         m.wf.Name(),
+		ContextRef:       m.contextRef,
+	}
+	if m.wf.Mode() == core.ModeIterative {
+		// Each change is a separate destination change.
+		transformResult.ContextRef = originRef
+	}
+
+	var writeResult *vcs.WriteResult
+	if writer, ok := m.destination.(vcs.ChangeRequestWriter); ok && m.isChangeRequest() {
+		writeResult, err = writer.WriteChangeRequest(baseline, transformResult)
+	} else {
+		writeResult, err = m.destination.Write(transformResult)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write to destination: %w", err)
+	}
+
+	return &Result{
+		Workflow:       wf.Name(),
+		Mode:           wf.Mode(),
+		OriginRef:      originRef,
+		Baseline:       baseline,
+		DestinationRef: writeResult.DestinationRef,
+		ChangeRequest:  writeResult.ChangeRequest,
+		Message:        tctx.Message,
+		Author:         tctx.Author,
+		Files:          writeResult.Files,
+		NoChanges:      writeResult.Empty(),
+		Noops:          tctx.Noops,
+	}, nil
+}
+
+// ResolveOrigin returns the vcs.Origin implementation for a workflow origin.
+func ResolveOrigin(v starlark.Value) (vcs.Origin, error) {
+	switch o := v.(type) {
+	case *folder.Origin:
+		return o.Impl(), nil
+	case *git.Origin:
+		return o.Impl(), nil
+	case *git.GitHubOrigin:
+		return o.Impl(), nil
+	case *git.GerritOrigin:
+		return o.Impl(), nil
+	case nil, starlark.NoneType:
+		return nil, fmt.Errorf("%w: origin is required", ErrInvalidConfig)
+	default:
+		return nil, fmt.Errorf("%w: unsupported origin type %s", ErrInvalidConfig, v.Type())
+	}
+}
+
+// ResolveDestination returns the vcs.Destination implementation for a workflow destination.
+func ResolveDestination(v starlark.Value) (vcs.Destination, error) {
+	switch d := v.(type) {
+	case *folder.Destination:
+		return d.Impl(), nil
+	case *git.Destination:
+		return d.Impl(), nil
+	case *git.GitHubPrDestination:
+		return d.Impl(), nil
+	case *git.GerritDestination:
+		return d.Impl(), nil
+	case nil, starlark.NoneType:
+		return nil, fmt.Errorf("%w: destination is required", ErrInvalidConfig)
+	default:
+		return nil, fmt.Errorf("%w: unsupported destination type %s", ErrInvalidConfig, v.Type())
+	}
+}
+
+// Checkout materializes the origin into a "checkout" directory inside
+// workDir, keeping only the files matched by originFiles.
+func Checkout(origin vcs.Origin, originFiles *core.Glob, workDir string) (string, error) {
+	checkoutDir := filepath.Join(workDir, "checkout")
+	if err := os.RemoveAll(checkoutDir); err != nil {
+		return "", fmt.Errorf("failed to clean checkout directory: %w", err)
+	}
+	if err := os.MkdirAll(checkoutDir, 0o750); err != nil {
+		return "", fmt.Errorf("failed to create checkout directory: %w", err)
+	}
+
+	if err := origin.CopyTo(checkoutDir); err != nil {
+		return "", fmt.Errorf("failed to checkout origin: %w", err)
+	}
+
+	if originFiles != nil && !originFiles.IsAllFiles() {
+		if err := filterFiles(checkoutDir, originFiles); err != nil {
+			return "", fmt.Errorf("failed to apply origin_files: %w", err)
+		}
+	}
+
+	return checkoutDir, nil
+}
+
+// NewContext creates the transformation context for a workflow run.
+func NewContext(wf *core.Workflow, checkoutDir string, changes []*vcs.Change) *transform.Context {
+	tctx := transform.NewContext(checkoutDir)
+	tctx.Changes.Current = changes
+	tctx.Author = resolveAuthor(wf.Authoring(), changes)
+	return tctx
+}
+
+// ApplyTransformations applies the workflow transformations in order.
+//
+// No-op transformations are handled according to the workflow
+// NoopBehavior, or ignored when tctx.IgnoreNoop is set. The error of a
+// no-op workflow matches transform.ErrNoop, except with FAIL_IF_ANY_NOOP,
+// where it matches ErrNoopFailure instead.
+func ApplyTransformations(ctx context.Context, wf *core.Workflow, tctx *transform.Context) error {
+	behavior := wf.NoopBehavior()
+	if tctx.IgnoreNoop {
+		behavior = core.NoopIgnore
+	}
+
+	transformations := wf.Transformations()
+	var noops []string
+	for i, t := range transformations {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := t.Apply(tctx)
+		var noop *transform.NoopError
+		if errors.As(err, &noop) {
+			switch behavior {
+			case core.NoopIgnore, core.NoopIfAllNoop:
+				noops = append(noops, core.DescribeNoop(t, noop))
+				continue
+			case core.NoopFail:
+				err = fmt.Errorf("%w: %s", ErrNoopFailure, noop.Reason)
+			}
+		}
+		if err != nil {
+			return &TransformationError{Index: i, Description: t.Describe(), Err: err}
+		}
+	}
+
+	if behavior == core.NoopIfAllNoop && len(noops) > 0 && len(noops) == len(transformations) {
+		return &transform.NoopError{Reason: fmt.Sprintf("all the transformations of workflow %q were no-ops", wf.Name())}
+	}
+	tctx.Noops = append(tctx.Noops, noops...)
+	return nil
+}
+
+// resolveAuthor resolves the author of the migrated change using the
+// workflow authoring configuration.
+func resolveAuthor(v starlark.Value, changes []*vcs.Change) string {
+	var original *authoring.Author
+	var raw string
+	if len(changes) > 0 {
+		raw = changes[len(changes)-1].Author
+		original, _ = authoring.ParseAuthor(raw)
+	}
+
+	auth, ok := v.(authoring.Authoring)
+	if !ok {
+		return raw
+	}
+	if author := auth.ResolveAuthor(original); author != nil {
+		return author.String()
+	}
+	return raw
+}
+
+// prepareWorkDir returns the working directory for a run and a cleanup
+// function that removes it if it was created by the run.
+func prepareWorkDir(dir string) (string, func(), error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return "", nil, fmt.Errorf("failed to create workdir: %w", err)
+		}
+		return dir, func() {}, nil
+	}
+
+	tmp, err := os.MkdirTemp("", "copybara-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create workdir: %w", err)
+	}
+	return tmp, func() { _ = os.RemoveAll(tmp) }, nil
+}
+
+// filterFiles removes every file under root that does not match glob,
+// along with directories left empty.
+func filterFiles(root string, glob *core.Glob) error {
+	var dirs []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+
+		if d.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+
+		if !glob.Matches(filepath.ToSlash(relPath)) {
+			return os.Remove(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Remove empty directories, deepest first
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = os.Remove(dirs[i])
+	}
+	return nil
+}
@@ -0,0 +1,796 @@
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+
+	"github.com/albertocavalcante/starlark-go-copybara/authoring"
+	"github.com/albertocavalcante/starlark-go-copybara/core"
+	"github.com/albertocavalcante/starlark-go-copybara/folder"
+	"github.com/albertocavalcante/starlark-go-copybara/git"
+	"github.com/albertocavalcante/starlark-go-copybara/metadata"
+	"github.com/albertocavalcante/starlark-go-copybara/migrate"
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+	"github.com/albertocavalcante/starlark-go-copybara/vcs"
+)
+
+// evalWorkflow evaluates a config and returns the workflow with the given name.
+func evalWorkflow(t *testing.T, config, name string) *core.Workflow {
+	t.Helper()
+
+	thread := &starlark.Thread{Name: "test"}
+	predeclared := starlark.StringDict{
+		"core":      core.Module,
+		"folder":    folder.Module,
+		"git":       git.Module,
+		"authoring": authoring.Module,
+		"metadata":  metadata.Module,
+		"glob":      core.Globals()["glob"],
+	}
+
+	if _, err := starlark.ExecFile(thread, "copy.bara.sky", config, predeclared); err != nil {
+		t.Fatalf("failed to evaluate config: %v", err)
+	}
+
+	for _, wf := range core.RegisteredWorkflows(thread) {
+		if wf.Name() == name {
+			return wf
+		}
+	}
+	t.Fatalf("workflow %q not found", name)
+	return nil
+}
+
+// writeFiles creates the given files under dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for path, content := range files {
+		fullPath := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+}
+
+// readFile returns the content of a file, or "" if it does not exist.
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func folderConfig(src, dst, extra string) string {
+	return `
+core.workflow(
+    name = "default",
+    origin = folder.origin(path = "` + src + `"),
+    destination = folder.destination(path = "` + dst + `"),
+    authoring = authoring.overwrite("Copybara <copybara@example.com>"),
+` + extra + `
+)
+`
+}
+
+func TestRunSquash(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"src/main.go": "package main\n",
+		"README.md":   "# Project\n",
+	})
+
+	wf := evalWorkflow(t, folderConfig(src, dst, `
+    transformations = [
+        core.move("src", "lib"),
+        core.replace(before = "package main", after = "package lib"),
+    ],`), "default")
+
+	result, err := migrate.Run(context.Background(), wf, migrate.Options{})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+
+	if got := readFile(t, filepath.Join(dst, "lib/main.go")); got != "package lib\n" {
+		t.Errorf("lib/main.go = %q, want %q", got, "package lib\n")
+	}
+	if got := readFile(t, filepath.Join(dst, "README.md")); got != "# Project\n" {
+		t.Errorf("README.md = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "src/main.go")); !os.IsNotExist(err) {
+		t.Error("src/main.go should not be written to the destination")
+	}
+
+	if result.Workflow != "default" {
+		t.Errorf("Workflow = %q, want %q", result.Workflow, "default")
+	}
+	if result.Message != migrate.DefaultSquashMessage {
+		t.Errorf("Message = %q, want %q", result.Message, migrate.DefaultSquashMessage)
+	}
+	if result.Author != "Copybara <copybara@example.com>" {
+		t.Errorf("Author = %q", result.Author)
+	}
+	if result.NoChanges {
+		t.Error("NoChanges should be false")
+	}
+
+	want := []vcs.FileChange{
+		{Path: "README.md", Op: vcs.FileAdded},
+		{Path: "lib/main.go", Op: vcs.FileAdded},
+	}
+	if len(result.Files) != len(want) {
+		t.Fatalf("Files = %v, want %v", result.Files, want)
+	}
+	for i := range want {
+		if result.Files[i] != want[i] {
+			t.Errorf("Files[%d] = %v, want %v", i, result.Files[i], want[i])
+		}
+	}
+}
+
+func TestRunNoChanges(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	writeFiles(t, src, map[string]string{"a.txt": "a\n"})
+
+	wf := evalWorkflow(t, folderConfig(src, dst, ""), "default")
+
+	if _, err := migrate.Run(context.Background(), wf, migrate.Options{}); err != nil {
+		t.Fatalf("first Run() error: %v", err)
+	}
+
+	result, err := migrate.Run(context.Background(), wf, migrate.Options{})
+	if err != nil {
+		t.Fatalf("second Run() error: %v", err)
+	}
+	if !result.NoChanges {
+		t.Errorf("expected no changes, got %v", result.Files)
+	}
+}
+
+func TestRunOriginAndDestinationFiles(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"src/a.go":      "a\n",
+		"src/a_test.go": "test\n",
+		"internal/b.go": "b\n",
+	})
+	writeFiles(t, dst, map[string]string{
+		"src/stale.go": "stale\n",
+		"LICENSE":      "keep me\n",
+	})
+
+	wf := evalWorkflow(t, folderConfig(src, dst, `
+    origin_files = glob(["src/**"], exclude = ["**/*_test.go"]),
+    destination_files = glob(["src/**"]),`), "default")
+
+	result, err := migrate.Run(context.Background(), wf, migrate.Options{})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+
+	if got := readFile(t, filepath.Join(dst, "src/a.go")); got != "a\n" {
+		t.Errorf("src/a.go = %q", got)
+	}
+	for _, path := range []string{"src/a_test.go", "internal/b.go", "src/stale.go"} {
+		if _, err := os.Stat(filepath.Join(dst, path)); !os.IsNotExist(err) {
+			t.Errorf("%s should not exist in destination", path)
+		}
+	}
+	if got := readFile(t, filepath.Join(dst, "LICENSE")); got != "keep me\n" {
+		t.Errorf("LICENSE outside destination_files was modified: %q", got)
+	}
+
+	ops := make(map[string]vcs.FileOp)
+	for _, f := range result.Files {
+		ops[f.Path] = f.Op
+	}
+	if ops["src/a.go"] != vcs.FileAdded || ops["src/stale.go"] != vcs.FileDeleted || len(ops) != 2 {
+		t.Errorf("unexpected file changes: %v", result.Files)
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	writeFiles(t, src, map[string]string{"a.txt": "a\n"})
+
+	wf := evalWorkflow(t, folderConfig(src, dst, ""), "default")
+
+	result, err := migrate.Run(context.Background(), wf, migrate.Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if len(result.Files) != 1 || result.Files[0].Op != vcs.FileAdded {
+		t.Errorf("unexpected file changes: %v", result.Files)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "a.txt")); !os.IsNotExist(err) {
+		t.Error("dry run should not write to the destination")
+	}
+}
+
+func TestRunMetadataMessage(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	writeFiles(t, src, map[string]string{"a.txt": "a\n"})
+
+	wf := evalWorkflow(t, folderConfig(src, dst, `
+    transformations = [
+        metadata.replace_message("Imported from folder"),
+    ],`), "default")
+
+	result, err := migrate.Run(context.Background(), wf, migrate.Options{})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if result.Message != "Imported from folder" {
+		t.Errorf("Message = %q, want %q", result.Message, "Imported from folder")
+	}
+}
+
+func TestRunTransformationError(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	writeFiles(t, src, map[string]string{"a.txt": "a\n"})
+
+	wf := evalWorkflow(t, folderConfig(src, dst, `
+    transformations = [
+        core.move("missing", "other"),
+    ],`), "default")
+
+	_, err := migrate.Run(context.Background(), wf, migrate.Options{})
+	var terr *migrate.TransformationError
+	if !errors.As(err, &terr) {
+		t.Fatalf("expected TransformationError, got %v", err)
+	}
+	if terr.Index != 0 || !strings.Contains(terr.Description, "missing") {
+		t.Errorf("unexpected error: %v", terr)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "a.txt")); !os.IsNotExist(err) {
+		t.Error("failed run should not write to the destination")
+	}
+}
+
+func TestRunNoop(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	writeFiles(t, src, map[string]string{"a.txt": "a\n"})
+
+	wf := evalWorkflow(t, folderConfig(src, dst, `
+    transformations = [
+        core.replace("missing", "other"),
+    ],`), "default")
+
+	_, err := migrate.Run(context.Background(), wf, migrate.Options{})
+	var terr *migrate.TransformationError
+	if !errors.As(err, &terr) || !errors.Is(err, migrate.ErrNoopFailure) || errors.Is(err, transform.ErrNoop) {
+		t.Fatalf("expected a no-op failure TransformationError, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "a.txt")); !os.IsNotExist(err) {
+		t.Error("failed run should not write to the destination")
+	}
+
+	result, err := migrate.Run(context.Background(), wf, migrate.Options{IgnoreNoop: true})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if len(result.Noops) != 1 || !strings.Contains(result.Noops[0], "missing") {
+		t.Errorf("Noops = %q, want one entry describing the replace", result.Noops)
+	}
+	if got := readFile(t, filepath.Join(dst, "a.txt")); got != "a\n" {
+		t.Errorf("a.txt = %q, want %q", got, "a\n")
+	}
+}
+
+func TestRunNoopBehavior(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	writeFiles(t, src, map[string]string{"a.txt": "a\n"})
+
+	wf := evalWorkflow(t, folderConfig(src, dst, `
+    noop_behavior = "NOOP_IF_ALL_NOOP",
+    transformations = [
+        core.replace("missing", "other"),
+        core.replace("a", "b"),
+    ],`), "default")
+
+	result, err := migrate.Run(context.Background(), wf, migrate.Options{})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if len(result.Noops) != 1 {
+		t.Errorf("Noops = %q, want 1 entry", result.Noops)
+	}
+	if got := readFile(t, filepath.Join(dst, "a.txt")); got != "b\n" {
+		t.Errorf("a.txt = %q, want %q", got, "b\n")
+	}
+}
+
+func TestRunNoopIfAnyNoop(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	writeFiles(t, src, map[string]string{"a.txt": "a\n"})
+
+	wf := evalWorkflow(t, folderConfig(src, dst, `
+    noop_behavior = "NOOP_IF_ANY_NOOP",
+    transformations = [
+        core.replace("missing", "other"),
+    ],`), "default")
+
+	_, err := migrate.Run(context.Background(), wf, migrate.Options{})
+	if !errors.Is(err, transform.ErrNoop) || errors.Is(err, migrate.ErrNoopFailure) {
+		t.Errorf("expected a no-op error, got %v", err)
+	}
+}
+
+func TestRunUnsupportedOrigin(t *testing.T) {
+	wf := evalWorkflow(t, `core.workflow(name = "default", destination = folder.destination())`, "default")
+
+	_, err := migrate.Run(context.Background(), wf, migrate.Options{})
+	if !errors.Is(err, migrate.ErrInvalidConfig) {
+		t.Errorf("expected ErrInvalidConfig, got %v", err)
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	writeFiles(t, src, map[string]string{"a.txt": "a\n"})
+
+	wf := evalWorkflow(t, folderConfig(src, dst, `
+    transformations = [core.replace("a", "b")],`), "default")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := migrate.Run(ctx, wf, migrate.Options{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestRunReversibleCheck(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	writeFiles(t, src, map[string]string{"src/a.txt": "foo\n"})
+
+	wf := evalWorkflow(t, folderConfig(src, dst, `
+    reversible_check = True,
+    transformations = [
+        core.move("src", "lib"),
+        core.replace("foo", "bar"),
+    ],`), "default")
+
+	if _, err := migrate.Run(context.Background(), wf, migrate.Options{}); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if got := readFile(t, filepath.Join(dst, "lib/a.txt")); got != "bar\n" {
+		t.Errorf("lib/a.txt = %q, want %q", got, "bar\n")
+	}
+}
+
+func TestRunReversibleCheckFails(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	// "bar" already exists in the origin, so reversing the replace turns it
+	// into "foo" and the round trip does not reproduce the origin.
+	writeFiles(t, src, map[string]string{
+		"a.txt": "foo\nbar\n",
+		"b.txt": "unchanged\n",
+	})
+
+	wf := evalWorkflow(t, folderConfig(src, dst, `
+    reversible_check = True,
+    transformations = [core.replace("foo", "bar")],`), "default")
+
+	_, err := migrate.Run(context.Background(), wf, migrate.Options{})
+	var nrerr *migrate.NonReversibleError
+	if !errors.As(err, &nrerr) {
+		t.Fatalf("expected NonReversibleError, got %v", err)
+	}
+	if len(nrerr.Files) != 1 || nrerr.Files[0].Path != "a.txt" || nrerr.Files[0].Op != vcs.FileModified {
+		t.Fatalf("unexpected files: %v", nrerr.Files)
+	}
+	if !strings.Contains(nrerr.Files[0].Diff, "-bar\n+foo\n") {
+		t.Errorf("unexpected diff:\n%s", nrerr.Files[0].Diff)
+	}
+	if !strings.Contains(err.Error(), "--- a/a.txt") {
+		t.Errorf("error should include the diff report, got %q", err.Error())
+	}
+	if _, err := os.Stat(filepath.Join(dst, "a.txt")); !os.IsNotExist(err) {
+		t.Error("failed reversibility check should not write to the destination")
+	}
+}
+
+func TestRunReversibleCheckDisabled(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	writeFiles(t, src, map[string]string{"a.txt": "foo\nbar\n"})
+
+	wf := evalWorkflow(t, folderConfig(src, dst, `
+    reversible_check = False,
+    transformations = [core.replace("foo", "bar")],`), "default")
+
+	if _, err := migrate.Run(context.Background(), wf, migrate.Options{}); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+}
+
+// runGit runs a git command in dir with a fixed identity and returns its
+// trimmed output.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Origin Author", "GIT_AUTHOR_EMAIL=origin@example.com",
+		"GIT_COMMITTER_NAME=Origin Author", "GIT_COMMITTER_EMAIL=origin@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// gitCommit commits the given files to the repository at dir and returns
+// the new commit SHA-1.
+func gitCommit(t *testing.T, dir, message string, files map[string]string) string {
+	t.Helper()
+	writeFiles(t, dir, files)
+	runGit(t, dir, "add", "--all")
+	runGit(t, dir, "commit", "--quiet", "-m", message)
+	return runGit(t, dir, "rev-parse", "HEAD")
+}
+
+// gitRepo creates a git repository on branch "main" with the given files
+// committed and returns its file:// URL.
+func gitRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	runGit(t, dir, "init", "--quiet", "--initial-branch=main")
+	gitCommit(t, dir, "Initial commit", files)
+	return "file://" + dir
+}
+
+// bareGitRepo creates an empty bare repository and returns its file:// URL.
+func bareGitRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	runGit(t, dir, "init", "--quiet", "--bare", "--initial-branch=main")
+	return "file://" + dir
+}
+
+func TestRunGitOrigin(t *testing.T) {
+	url := gitRepo(t, map[string]string{"src/a.txt": "a\n"})
+	dst := t.TempDir()
+
+	wf := evalWorkflow(t, `
+core.workflow(
+    name = "default",
+    origin = git.origin(url = "`+url+`", ref = "main"),
+    destination = folder.destination(path = "`+dst+`"),
+    authoring = authoring.pass_thru("Default <default@example.com>"),
+    transformations = [core.move("src", "")],
+)
+`, "default")
+
+	result, err := migrate.Run(context.Background(), wf, migrate.Options{})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if got := readFile(t, filepath.Join(dst, "a.txt")); got != "a\n" {
+		t.Errorf("a.txt = %q", got)
+	}
+	if result.Author != "Origin Author <origin@example.com>" {
+		t.Errorf("Author = %q", result.Author)
+	}
+	if len(result.OriginRef) != 40 {
+		t.Errorf("OriginRef = %q, want a commit SHA-1", result.OriginRef)
+	}
+}
+
+func gitToGitConfig(originURL, destinationURL, extra string) string {
+	return `
+core.workflow(
+    name = "default",
+    origin = git.origin(url = "` + originURL + `", ref = "main"),
+    destination = git.destination(url = "` + destinationURL + `", push = "main"),
+    authoring = authoring.pass_thru("Default <default@example.com>"),
+` + extra + `
+)
+`
+}
+
+func TestRunBaselineFromDestination(t *testing.T) {
+	originURL := gitRepo(t, map[string]string{"a.txt": "a\n"})
+	originDir := strings.TrimPrefix(originURL, "file://")
+	destinationURL := bareGitRepo(t)
+	wf := evalWorkflow(t, gitToGitConfig(originURL, destinationURL, ""), "default")
+
+	first, err := migrate.Run(context.Background(), wf, migrate.Options{})
+	if err != nil {
+		t.Fatalf("first Run() error: %v", err)
+	}
+	if first.Baseline != "" {
+		t.Errorf("first Baseline = %q, want none", first.Baseline)
+	}
+
+	second, err := migrate.Run(context.Background(), wf, migrate.Options{})
+	if err != nil {
+		t.Fatalf("second Run() error: %v", err)
+	}
+	if !second.NoChanges || second.Baseline != first.OriginRef {
+		t.Errorf("second run = %+v, want no changes since %s", second, first.OriginRef)
+	}
+
+	head := gitCommit(t, originDir, "Second change", map[string]string{"b.txt": "b\n"})
+	third, err := migrate.Run(context.Background(), wf, migrate.Options{})
+	if err != nil {
+		t.Fatalf("third Run() error: %v", err)
+	}
+	if third.Baseline != first.OriginRef || third.OriginRef != head {
+		t.Errorf("third run migrated %s..%s, want %s..%s", third.Baseline, third.OriginRef, first.OriginRef, head)
+	}
+	if len(third.Files) != 1 || third.Files[0].Path != "b.txt" {
+		t.Errorf("third run Files = %v", third.Files)
+	}
+}
+
+func TestRunBaselineOverrides(t *testing.T) {
+	originURL := gitRepo(t, map[string]string{"a.txt": "a\n"})
+	originDir := strings.TrimPrefix(originURL, "file://")
+	first := runGit(t, originDir, "rev-parse", "HEAD")
+	gitCommit(t, originDir, "Second change", map[string]string{"b.txt": "b\n"})
+
+	destinationURL := bareGitRepo(t)
+	wf := evalWorkflow(t, gitToGitConfig(originURL, destinationURL, `    custom_rev_id = "Custom-RevId",`), "default")
+
+	result, err := migrate.Run(context.Background(), wf, migrate.Options{LastRev: first})
+	if err != nil {
+		t.Fatalf("Run() with LastRev error: %v", err)
+	}
+	if result.Baseline != first {
+		t.Errorf("Baseline = %q, want %q", result.Baseline, first)
+	}
+	destinationDir := strings.TrimPrefix(destinationURL, "file://")
+	if msg := runGit(t, destinationDir, "log", "-1", "--format=%B", "main"); !strings.Contains(msg, "Custom-RevId: "+result.OriginRef) {
+		t.Errorf("destination message = %q, want custom rev-id label", msg)
+	}
+
+	result, err = migrate.Run(context.Background(), wf, migrate.Options{InitHistory: true})
+	if err != nil {
+		t.Fatalf("Run() with InitHistory error: %v", err)
+	}
+	if result.Baseline != "" || !result.NoChanges {
+		t.Errorf("InitHistory run = %+v, want no baseline and no changes", result)
+	}
+}
+
+func TestRunIterative(t *testing.T) {
+	originURL := gitRepo(t, map[string]string{"a.txt": "a\n"})
+	originDir := strings.TrimPrefix(originURL, "file://")
+	destinationURL := bareGitRepo(t)
+	destinationDir := strings.TrimPrefix(destinationURL, "file://")
+	wf := evalWorkflow(t, gitToGitConfig(originURL, destinationURL, `    mode = "ITERATIVE",`), "default")
+
+	if _, err := migrate.Run(context.Background(), wf, migrate.Options{}); !errors.Is(err, migrate.ErrNoBaseline) {
+		t.Fatalf("expected ErrNoBaseline without --init-history, got %v", err)
+	}
+
+	first, err := migrate.Run(context.Background(), wf, migrate.Options{InitHistory: true})
+	if err != nil {
+		t.Fatalf("first Run() error: %v", err)
+	}
+	if len(first.Migrated) != 1 {
+		t.Fatalf("first run migrated %d changes, want 1", len(first.Migrated))
+	}
+
+	second := gitCommit(t, originDir, "Add b\n\nBug: 1", map[string]string{"b.txt": "b\n"})
+	third := gitCommit(t, originDir, "Add c", map[string]string{"c.txt": "c\n"})
+
+	result, err := migrate.Run(context.Background(), wf, migrate.Options{})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if len(result.Migrated) != 2 || result.Migrated[0].OriginRef != second || result.Migrated[1].OriginRef != third {
+		t.Fatalf("unexpected migrated changes: %+v", result.Migrated)
+	}
+	if result.Baseline != first.OriginRef || result.OriginRef != third {
+		t.Errorf("run migrated %s..%s, want %s..%s", result.Baseline, result.OriginRef, first.OriginRef, third)
+	}
+	if result.Migrated[1].Baseline != second {
+		t.Errorf("second change baseline = %q, want %q", result.Migrated[1].Baseline, second)
+	}
+
+	log := runGit(t, destinationDir, "log", "--format=%s|%an", "main")
+	if log != "Add c|Origin Author\nAdd b|Origin Author\nInitial commit|Origin Author" {
+		t.Errorf("destination log = %q", log)
+	}
+	if msg := runGit(t, destinationDir, "log", "-1", "--format=%B", "main~1"); msg != "Add b\n\nBug: 1\nGitOrigin-RevId: "+second {
+		t.Errorf("destination message = %q", msg)
+	}
+}
+
+func TestRunIterativeStopsAtFailure(t *testing.T) {
+	originURL := gitRepo(t, map[string]string{"src/a.txt": "a\n"})
+	originDir := strings.TrimPrefix(originURL, "file://")
+	destinationURL := bareGitRepo(t)
+	destinationDir := strings.TrimPrefix(destinationURL, "file://")
+	wf := evalWorkflow(t, gitToGitConfig(originURL, destinationURL, `
+    mode = "ITERATIVE",
+    transformations = [core.move("src", "lib")],`), "default")
+
+	first, err := migrate.Run(context.Background(), wf, migrate.Options{InitHistory: true})
+	if err != nil {
+		t.Fatalf("first Run() error: %v", err)
+	}
+
+	good := gitCommit(t, originDir, "Update a", map[string]string{"src/a.txt": "a2\n"})
+	runGit(t, originDir, "mv", "src", "other")
+	bad := gitCommit(t, originDir, "Rename src", nil)
+	gitCommit(t, originDir, "Never migrated", map[string]string{"d.txt": "d\n"})
+
+	_, err = migrate.Run(context.Background(), wf, migrate.Options{})
+	var iterr *migrate.IterativeError
+	if !errors.As(err, &iterr) {
+		t.Fatalf("expected IterativeError, got %v", err)
+	}
+	if iterr.Change != bad || iterr.Pending != 3 || len(iterr.Migrated) != 1 || iterr.Migrated[0].OriginRef != good {
+		t.Errorf("unexpected error: %v", iterr)
+	}
+	var terr *migrate.TransformationError
+	if !errors.As(err, &terr) {
+		t.Errorf("expected the TransformationError to be wrapped, got %v", err)
+	}
+
+	if rev := runGit(t, destinationDir, "log", "-1", "--format=%B", "main"); !strings.Contains(rev, "GitOrigin-RevId: "+good) {
+		t.Errorf("destination should stop at %s, got %q", good, rev)
+	}
+	if count := runGit(t, destinationDir, "rev-list", "--count", "main"); count != "2" {
+		t.Errorf("destination has %s commits, want 2 (baseline %s and %s)", count, first.OriginRef, good)
+	}
+}
+
+func TestRunChangeRequest(t *testing.T) {
+	destinationURL := gitRepo(t, map[string]string{"a.txt": "a\n", "b.txt": "b\n"})
+	destinationDir := strings.TrimPrefix(destinationURL, "file://")
+	base := runGit(t, destinationDir, "rev-parse", "HEAD")
+	gitCommit(t, destinationDir, "Moved on", map[string]string{"c.txt": "c\n"})
+
+	originURL := gitRepo(t, map[string]string{"a.txt": "a\n", "b.txt": "b\n"})
+	originDir := strings.TrimPrefix(originURL, "file://")
+	gitCommit(t, originDir, "Export\n\nGitOrigin-RevId: "+base, map[string]string{"b.txt": "b\n\n"})
+	change := gitCommit(t, originDir, "Fix a", map[string]string{"a.txt": "fixed\n"})
+
+	wf := evalWorkflow(t, `
+core.workflow(
+    name = "default",
+    mode = "CHANGE_REQUEST",
+    origin = git.origin(url = "`+originURL+`", ref = "main"),
+    destination = git.destination(url = "`+destinationURL+`", fetch = "main", push = "review"),
+    authoring = authoring.pass_thru("Default <default@example.com>"),
+)
+`, "default")
+
+	result, err := migrate.Run(context.Background(), wf, migrate.Options{})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if result.Baseline != base || result.OriginRef != change {
+		t.Errorf("migrated %s onto %s, want %s onto %s", result.OriginRef, result.Baseline, change, base)
+	}
+
+	ops := make(map[string]vcs.FileOp)
+	for _, f := range result.Files {
+		ops[f.Path] = f.Op
+	}
+	// b.txt differs from the baseline too: the origin tree is applied as a whole.
+	if len(ops) != 2 || ops["a.txt"] != vcs.FileModified || ops["b.txt"] != vcs.FileModified {
+		t.Errorf("Files = %v", result.Files)
+	}
+
+	if parent := runGit(t, destinationDir, "rev-parse", "review^"); parent != base {
+		t.Errorf("review parent = %s, want baseline %s", parent, base)
+	}
+	if msg := runGit(t, destinationDir, "log", "-1", "--format=%B", "review"); msg != "Fix a\n\nGitOrigin-RevId: "+change {
+		t.Errorf("review message = %q", msg)
+	}
+	if content := runGit(t, destinationDir, "show", "review:a.txt"); content != "fixed" {
+		t.Errorf("a.txt = %q", content)
+	}
+}
+
+func TestRunChangeRequestErrors(t *testing.T) {
+	originURL := gitRepo(t, map[string]string{"a.txt": "a\n"})
+	gitCommit(t, strings.TrimPrefix(originURL, "file://"), "Unlabeled", map[string]string{"a.txt": "b\n"})
+
+	wf := evalWorkflow(t, `
+core.workflow(
+    name = "default",
+    mode = "CHANGE_REQUEST",
+    origin = git.origin(url = "`+originURL+`", ref = "main"),
+    destination = git.destination(url = "`+bareGitRepo(t)+`"),
+)
+`, "default")
+	if _, err := migrate.Run(context.Background(), wf, migrate.Options{}); !errors.Is(err, migrate.ErrNoBaseline) {
+		t.Errorf("expected ErrNoBaseline, got %v", err)
+	}
+
+	wf = evalWorkflow(t, `
+core.workflow(
+    name = "default",
+    mode = "CHANGE_REQUEST",
+    origin = git.origin(url = "`+originURL+`", ref = "main"),
+    destination = folder.destination(path = "`+t.TempDir()+`"),
+)
+`, "default")
+	if _, err := migrate.Run(context.Background(), wf, migrate.Options{}); !errors.Is(err, migrate.ErrInvalidConfig) {
+		t.Errorf("expected ErrInvalidConfig for folder destination, got %v", err)
+	}
+}
+
+func TestRunChangeRequestFromSOT(t *testing.T) {
+	originURL := gitRepo(t, map[string]string{"a.txt": "a\n"})
+	originDir := strings.TrimPrefix(originURL, "file://")
+	exported := runGit(t, originDir, "rev-parse", "HEAD")
+
+	destinationURL := gitRepo(t, map[string]string{"a.txt": "a\n"})
+	destinationDir := strings.TrimPrefix(destinationURL, "file://")
+	imported := gitCommit(t, destinationDir, "Import\n\nGitOrigin-RevId: "+exported, map[string]string{"LICENSE": "mit\n"})
+	gitCommit(t, destinationDir, "Later change", map[string]string{"b.txt": "b\n"})
+
+	pending := gitCommit(t, originDir, "Pending change", map[string]string{"a.txt": "pending\n"})
+
+	config := `
+core.workflow(
+    name = "default",
+    mode = "CHANGE_REQUEST_FROM_SOT",
+    origin = git.origin(url = "` + originURL + `", ref = "main"),
+    destination = git.destination(url = "` + destinationURL + `", fetch = "main", push = "review"),
+    destination_files = glob(["a.txt"]),
+    authoring = authoring.pass_thru("Default <default@example.com>"),
+)
+`
+	result, err := migrate.Run(context.Background(), evalWorkflow(t, config, "default"), migrate.Options{})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if result.Baseline != imported || result.OriginRef != pending {
+		t.Errorf("migrated %s onto %s, want %s onto %s", result.OriginRef, result.Baseline, pending, imported)
+	}
+	if parent := runGit(t, destinationDir, "rev-parse", "review^"); parent != imported {
+		t.Errorf("review parent = %s, want %s", parent, imported)
+	}
+	if content := runGit(t, destinationDir, "show", "review:a.txt"); content != "pending" {
+		t.Errorf("a.txt = %q", content)
+	}
+
+	next := gitCommit(t, originDir, "Based on an unexported change", map[string]string{"a.txt": "next\n"})
+	_, err = migrate.Run(context.Background(), evalWorkflow(t, config, "default"), migrate.Options{})
+	var neerr *migrate.NotExportedError
+	if !errors.As(err, &neerr) || !errors.Is(err, migrate.ErrNoBaseline) {
+		t.Fatalf("expected NotExportedError, got %v", err)
+	}
+	if neerr.Change != next || neerr.Revision != pending || neerr.Label != "GitOrigin-RevId" {
+		t.Errorf("unexpected error: %+v", neerr)
+	}
+	if !strings.Contains(err.Error(), "has not been exported") {
+		t.Errorf("error should explain the missing export, got %q", err)
+	}
+}
@@ -0,0 +1,108 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/albertocavalcante/starlark-go-copybara/core"
+	"github.com/albertocavalcante/starlark-go-copybara/diff"
+	"github.com/albertocavalcante/starlark-go-copybara/folder"
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+)
+
+// NonReversibleError is returned when reversing the workflow transformations
+// does not reproduce the original origin files.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/NonReversibleValidationException.java
+type NonReversibleError struct {
+	// Workflow is the name of the workflow that failed the check.
+	Workflow string
+
+	// Files lists the files that differ between the original checkout
+	// (a/) and the result of the round trip (b/).
+	Files []diff.FileDiff
+
+	// Err is set when a reversed transformation failed to apply.
+	Err error
+}
+
+func (e *NonReversibleError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("workflow %q is not reversible: %v", e.Workflow, e.Err)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "workflow %q is not reversible: %d file(s) differ after reversing the transformations", e.Workflow, len(e.Files))
+	for _, f := range e.Files {
+		fmt.Fprintf(&sb, "\n%s %s\n%s", f.Op, f.Path, f.Diff)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// Unwrap returns the underlying error, if any.
+func (e *NonReversibleError) Unwrap() error {
+	return e.Err
+}
+
+// CheckReversible verifies that reversing the workflow transformations on
+// transformedDir reproduces originalDir. The round trip runs on a copy
+// inside workDir, so transformedDir is left untouched.
+//
+// Reversed transformations are applied in reverse order, each one being
+// the Reverse() of the corresponding forward step.
+func CheckReversible(ctx context.Context, wf *core.Workflow, originalDir, transformedDir, workDir string) error {
+	reverseDir := filepath.Join(workDir, "reverse")
+	if err := copyTree(transformedDir, reverseDir); err != nil {
+		return err
+	}
+
+	// No-op reverse transformations are fine: comparing the round trip
+	// with the original catches any difference they should have undone.
+	tctx := transform.NewContext(reverseDir)
+	tctx.IgnoreNoop = true
+	transformations := wf.Transformations()
+	for i := len(transformations) - 1; i >= 0; i-- {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		reverse := transformations[i].Reverse()
+		if err := reverse.Apply(tctx); err != nil && !errors.Is(err, transform.ErrNoop) {
+			return &NonReversibleError{
+				Workflow: wf.Name(),
+				Err:      &TransformationError{Index: i, Description: reverse.Describe(), Err: err},
+			}
+		}
+	}
+
+	original, err := diff.Snapshot(originalDir)
+	if err != nil {
+		return err
+	}
+	roundTrip, err := diff.Snapshot(reverseDir)
+	if err != nil {
+		return err
+	}
+
+	if files := diff.Compare(original, roundTrip); len(files) > 0 {
+		return &NonReversibleError{Workflow: wf.Name(), Files: files}
+	}
+	return nil
+}
+
+// copyTree replaces dst with a copy of the files under src.
+func copyTree(src, dst string) error {
+	if err := os.RemoveAll(dst); err != nil {
+		return fmt.Errorf("failed to clean %s: %w", dst, err)
+	}
+	if err := os.MkdirAll(dst, 0o750); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	if err := folder.CopyDir(folder.NewOSFileSystem(), src, dst); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	return nil
+}
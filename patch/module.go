@@ -0,0 +1,460 @@
+// Package patch provides the patch.* Starlark module for applying patches.
+//
+// The patch module provides:
+//   - patch.apply() - Apply unified diffs to the workdir
+//
+// Patches are applied in pure Go, without an external patch binary.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/transform/patch/PatchModule.java
+package patch
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+)
+
+// Module is the patch.* Starlark module.
+var Module = &starlarkstruct.Module{
+	Name: "patch",
+	Members: starlark.StringDict{
+		"apply": starlark.NewBuiltin("patch.apply", applyFn),
+	},
+}
+
+// Apply is a transformation applying unified diffs to the workdir.
+//
+// Patch files are read when the config is evaluated. All the patches are
+// applied in memory before the workdir is written, so a patch that does
+// not apply leaves the workdir untouched.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/transform/patch/PatchTransformation.java
+type Apply struct {
+	patches  []*patchFile
+	excluded []string
+	series   string
+	strip    int
+	reversed bool
+}
+
+// patchFile is a parsed patch file.
+type patchFile struct {
+	name  string
+	files []*File
+}
+
+// String implements starlark.Value.
+func (a *Apply) String() string {
+	names := make([]string, len(a.patches))
+	for i, p := range a.patches {
+		names[i] = strconv.Quote(p.name)
+	}
+	return fmt.Sprintf("patch.apply(patches = [%s])", strings.Join(names, ", "))
+}
+
+// Type implements starlark.Value.
+func (a *Apply) Type() string {
+	return "patch.apply"
+}
+
+// Freeze implements starlark.Value.
+func (a *Apply) Freeze() {}
+
+// Truth implements starlark.Value.
+func (a *Apply) Truth() starlark.Bool {
+	return starlark.True
+}
+
+// Hash implements starlark.Value.
+func (a *Apply) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: patch.apply")
+}
+
+// Patches returns the names of the patch files, including those listed in
+// the series file, in application order.
+func (a *Apply) Patches() []string {
+	names := make([]string, len(a.patches))
+	for i, p := range a.patches {
+		names[i] = p.name
+	}
+	return names
+}
+
+// ExcludedPaths returns the patterns of the paths excluded from the patches.
+func (a *Apply) ExcludedPaths() []string {
+	return a.excluded
+}
+
+// Series returns the series file, or "" if none was given.
+func (a *Apply) Series() string {
+	return a.series
+}
+
+// Strip returns the number of leading path components removed from the
+// file names in the patches.
+func (a *Apply) Strip() int {
+	return a.strip
+}
+
+// Attr implements starlark.HasAttrs.
+func (a *Apply) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "patches":
+		return stringList(a.Patches()), nil
+	case "excluded_patch_paths":
+		return stringList(a.excluded), nil
+	case "series":
+		return starlark.String(a.series), nil
+	case "strip":
+		return starlark.MakeInt(a.strip), nil
+	default:
+		return nil, nil
+	}
+}
+
+// AttrNames implements starlark.HasAttrs.
+func (a *Apply) AttrNames() []string {
+	return []string{"excluded_patch_paths", "patches", "series", "strip"}
+}
+
+// Apply implements Transformation.
+func (a *Apply) Apply(ctx *transform.Context) error {
+	if ctx.WorkDir == "" {
+		return fmt.Errorf("workdir is required for patch transformation")
+	}
+
+	w := &workTree{dir: ctx.WorkDir, changes: make(map[string]*string)}
+
+	patches := a.patches
+	if a.reversed {
+		patches = slices.Clone(patches)
+		slices.Reverse(patches)
+	}
+	for _, p := range patches {
+		for _, f := range p.files {
+			if a.reversed {
+				f = f.reverse()
+			}
+			if err := w.apply(p.name, f); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(w.changes) == 0 {
+		return &transform.NoopError{Reason: "no file was patched"}
+	}
+	return w.write()
+}
+
+// Reverse implements Transformation.
+//
+// The reverse un-applies the patches, last patch first.
+func (a *Apply) Reverse() transform.Transformation {
+	r := *a
+	r.reversed = !a.reversed
+	return &r
+}
+
+// Describe implements Transformation.
+func (a *Apply) Describe() string {
+	if a.reversed {
+		return fmt.Sprintf("Reverting patches %s", strings.Join(a.Patches(), ", "))
+	}
+	return fmt.Sprintf("Applying patches %s", strings.Join(a.Patches(), ", "))
+}
+
+// workTree tracks the patched files in memory until they are written.
+type workTree struct {
+	dir string
+
+	// changes maps slash-separated paths to their new content. A nil
+	// content means the file is deleted.
+	changes map[string]*string
+}
+
+// read returns the content of a file and whether it exists.
+func (w *workTree) read(name string) (string, bool, error) {
+	if content, ok := w.changes[name]; ok {
+		if content == nil {
+			return "", false, nil
+		}
+		return *content, true, nil
+	}
+	data, err := os.ReadFile(filepath.Join(w.dir, filepath.FromSlash(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return string(data), true, nil
+}
+
+// apply applies a file diff of the patch named patchName.
+func (w *workTree) apply(patchName string, f *File) error {
+	source := f.OldName
+	if f.Created() {
+		source = f.NewName
+	}
+	content, exists, err := w.read(source)
+	if err != nil {
+		return err
+	}
+	switch {
+	case f.Created() && exists:
+		return fmt.Errorf("%s: cannot create %s: file already exists", patchName, f.NewName)
+	case !f.Created() && !exists:
+		return fmt.Errorf("%s: cannot patch %s: file does not exist", patchName, f.OldName)
+	}
+
+	result, err := f.apply(patchName, content)
+	if err != nil {
+		return err
+	}
+
+	if f.Deleted() {
+		if result != "" {
+			return fmt.Errorf("%s: cannot delete %s: file is not empty after applying the patch", patchName, f.OldName)
+		}
+		w.changes[f.OldName] = nil
+		return nil
+	}
+	if !f.Created() && f.OldName != f.NewName {
+		w.changes[f.OldName] = nil
+	}
+	w.changes[f.NewName] = &result
+	return nil
+}
+
+// write writes the patched files to the workdir.
+func (w *workTree) write() error {
+	names := make([]string, 0, len(w.changes))
+	for name := range w.changes {
+		names = append(names, name)
+	}
+	// Deletions first, so a file can replace a deleted directory
+	slices.SortFunc(names, func(a, b string) int {
+		if da, db := w.changes[a] == nil, w.changes[b] == nil; da != db {
+			if da {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+
+	for _, name := range names {
+		fullPath := filepath.Join(w.dir, filepath.FromSlash(name))
+		content := w.changes[name]
+		if content == nil {
+			if err := os.Remove(fullPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("failed to remove %s: %w", name, err)
+			}
+			continue
+		}
+
+		mode := fs.FileMode(0o644)
+		if info, err := os.Stat(fullPath); err == nil {
+			mode = info.Mode().Perm()
+		}
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", name, err)
+		}
+		if err := os.WriteFile(fullPath, []byte(*content), mode); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// applyFn implements patch.apply().
+//
+// Parameters:
+//   - patches (optional): Patch files to apply, relative to the config file.
+//     They are unified diffs, as produced by diff -u or git diff
+//   - excluded_patch_paths (optional): Paths, or path.Match patterns, of files
+//     to leave out of every patch. They are relative to the patch root, after
+//     stripping
+//   - series (optional): A quilt series file listing more patches to apply,
+//     one per line, relative to the series file. Entries may set their own
+//     -pN strip level. Blank lines and lines starting with '#' are ignored
+//   - strip (optional): Number of leading path components removed from the
+//     file names in the patches. Defaults to 1, as with patch -p1
+//
+// Reference: PatchModule.java apply()
+func applyFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		patchesList  *starlark.List
+		excludedList *starlark.List
+		series       string
+		strip        = 1
+	)
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+		"patches?", &patchesList,
+		"excluded_patch_paths?", &excludedList,
+		"series?", &series,
+		"strip?", &strip,
+	); err != nil {
+		return nil, err
+	}
+
+	patches, err := listStrings(fn.Name(), "patches", patchesList)
+	if err != nil {
+		return nil, err
+	}
+	excluded, err := listStrings(fn.Name(), "excluded_patch_paths", excludedList)
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range excluded {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s: invalid excluded path %q: %w", fn.Name(), pattern, err)
+		}
+	}
+	if len(patches) == 0 && series == "" {
+		return nil, fmt.Errorf("%s: patches or series is required", fn.Name())
+	}
+	if strip < 0 {
+		return nil, fmt.Errorf("%s: strip cannot be negative", fn.Name())
+	}
+
+	// Patch files are relative to the file calling patch.apply()
+	dir := "."
+	if thread.CallStackDepth() > 1 {
+		dir = filepath.Dir(thread.CallFrame(1).Pos.Filename())
+	}
+
+	a := &Apply{excluded: excluded, series: series, strip: strip}
+	for _, name := range patches {
+		p, err := loadPatch(dir, name, strip, excluded)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+		}
+		a.patches = append(a.patches, p)
+	}
+	if series != "" {
+		if err := a.loadSeries(dir, series); err != nil {
+			return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+		}
+	}
+	return a, nil
+}
+
+// loadSeries loads the patches listed in a quilt series file.
+func (a *Apply) loadSeries(dir, series string) error {
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(series)))
+	if err != nil {
+		return fmt.Errorf("failed to read series: %w", err)
+	}
+
+	seriesDir := path.Dir(series)
+	for i, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		strip := a.strip
+		for _, opt := range fields[1:] {
+			if strings.HasPrefix(opt, "#") {
+				break
+			}
+			level, ok := strings.CutPrefix(opt, "-p")
+			n, err := strconv.Atoi(level)
+			if !ok || err != nil || n < 0 {
+				return fmt.Errorf("%s:%d: unsupported option %q", series, i+1, opt)
+			}
+			strip = n
+		}
+
+		p, err := loadPatch(dir, path.Join(seriesDir, fields[0]), strip, a.excluded)
+		if err != nil {
+			return err
+		}
+		a.patches = append(a.patches, p)
+	}
+	return nil
+}
+
+// loadPatch reads and parses a patch file relative to dir, stripping its
+// file names and dropping excluded files.
+func loadPatch(dir, name string, strip int, excluded []string) (*patchFile, error) {
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read patch: %w", err)
+	}
+
+	files, err := Parse(name, string(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: no file diff found", name)
+	}
+
+	p := &patchFile{name: name}
+	for _, f := range files {
+		if err := f.strip(strip); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		for _, n := range []string{f.OldName, f.NewName} {
+			if n != devNull && !filepath.IsLocal(filepath.FromSlash(n)) {
+				return nil, fmt.Errorf("%s: path %q escapes the workdir", name, n)
+			}
+		}
+		if !isExcluded(f, excluded) {
+			p.files = append(p.files, f)
+		}
+	}
+	return p, nil
+}
+
+// isExcluded reports whether either name of f matches an excluded pattern.
+func isExcluded(f *File, excluded []string) bool {
+	for _, pattern := range excluded {
+		for _, name := range []string{f.OldName, f.NewName} {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// listStrings converts an optional Starlark list to a string slice.
+func listStrings(fnName, param string, list *starlark.List) ([]string, error) {
+	if list == nil {
+		return nil, nil
+	}
+	result := make([]string, list.Len())
+	for i := range list.Len() {
+		s, ok := starlark.AsString(list.Index(i))
+		if !ok {
+			return nil, fmt.Errorf("%s: %s must contain strings, got %s", fnName, param, list.Index(i).Type())
+		}
+		result[i] = s
+	}
+	return result, nil
+}
+
+// stringList converts a string slice to a Starlark list.
+func stringList(values []string) *starlark.List {
+	elems := make([]starlark.Value, len(values))
+	for i, v := range values {
+		elems[i] = starlark.String(v)
+	}
+	return starlark.NewList(elems)
+}
@@ -0,0 +1,392 @@
+package patch_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+
+	"github.com/albertocavalcante/starlark-go-copybara/patch"
+	"github.com/albertocavalcante/starlark-go-copybara/transform"
+)
+
+// writeFiles creates the given files under a new temporary directory and
+// returns it.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+	return dir
+}
+
+// readTree returns the content of all the files under dir.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", dir, err)
+	}
+	return files
+}
+
+// evalApply evaluates expr in a config file stored in configDir.
+func evalApply(t *testing.T, configDir, expr string) (*patch.Apply, error) {
+	t.Helper()
+	thread := &starlark.Thread{Name: "test"}
+	predeclared := starlark.StringDict{
+		"patch": patch.Module,
+	}
+
+	globals, err := starlark.ExecFile(thread, filepath.Join(configDir, "copy.bara.sky"), "p = "+expr, predeclared)
+	if err != nil {
+		return nil, err
+	}
+	return globals["p"].(*patch.Apply), nil
+}
+
+func TestModule(t *testing.T) {
+	if patch.Module.Name != "patch" {
+		t.Errorf("expected module name 'patch', got %q", patch.Module.Name)
+	}
+}
+
+const mainPatch = `--- a/main.go
++++ b/main.go
+@@ -2,3 +2,3 @@
+
+-var x = 1
++var x = 2
+
+@@ -5,3 +5,4 @@
+ func main() {
+ 	println(x)
++	println(x + 1)
+ }
+`
+
+const mainGo = `package main
+
+var x = 1
+
+func main() {
+	println(x)
+}
+`
+
+const mainGoPatched = `package main
+
+var x = 2
+
+func main() {
+	println(x)
+	println(x + 1)
+}
+`
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  map[string]string
+		expr    string
+		workdir map[string]string
+		want    map[string]string
+	}{
+		{
+			name:    "modify",
+			config:  map[string]string{"fix.patch": mainPatch},
+			expr:    `patch.apply(patches = ["fix.patch"])`,
+			workdir: map[string]string{"main.go": mainGo},
+			want:    map[string]string{"main.go": mainGoPatched},
+		},
+		{
+			name:    "offset",
+			config:  map[string]string{"fix.patch": mainPatch},
+			expr:    `patch.apply(patches = ["fix.patch"])`,
+			workdir: map[string]string{"main.go": "// header\n// more\n" + mainGo},
+			want:    map[string]string{"main.go": "// header\n// more\n" + mainGoPatched},
+		},
+		{
+			name: "create, delete and rename",
+			config: map[string]string{"patches/files.patch": `diff --git a/new.txt b/new.txt
+new file mode 100644
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1,2 @@
++hello
++world
+\ No newline at end of file
+diff --git a/old.txt b/old.txt
+deleted file mode 100644
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-old
+--- a/a.txt
++++ b/dir/b.txt
+@@ -1 +1 @@
+-a
++b
+`},
+			expr:    `patch.apply(patches = ["patches/files.patch"])`,
+			workdir: map[string]string{"old.txt": "old\n", "a.txt": "a\n", "keep.txt": "keep\n"},
+			want:    map[string]string{"new.txt": "hello\nworld", "dir/b.txt": "b\n", "keep.txt": "keep\n"},
+		},
+		{
+			name: "series",
+			config: map[string]string{
+				"patches/series": "# applied in order\n\none.patch\nsub/two.patch -p0\n",
+				"patches/one.patch": `--- a/f.txt
++++ b/f.txt
+@@ -1 +1 @@
+-one
++two
+`,
+				"patches/sub/two.patch": `--- f.txt
++++ f.txt
+@@ -1 +1 @@
+-two
++three
+`,
+			},
+			expr:    `patch.apply(series = "patches/series")`,
+			workdir: map[string]string{"f.txt": "one\n"},
+			want:    map[string]string{"f.txt": "three\n"},
+		},
+		{
+			name: "excluded paths",
+			config: map[string]string{"fix.patch": `--- a/docs/README
++++ b/docs/README
+@@ -1 +1 @@
+-docs
++changed docs
+--- a/f.txt
++++ b/f.txt
+@@ -1 +1 @@
+-one
++two
+`},
+			expr:    `patch.apply(patches = ["fix.patch"], excluded_patch_paths = ["docs/*"])`,
+			workdir: map[string]string{"f.txt": "one\n", "docs/README": "docs\n"},
+			want:    map[string]string{"f.txt": "two\n", "docs/README": "docs\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configDir := writeFiles(t, tt.config)
+			a, err := evalApply(t, configDir, tt.expr)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			workDir := writeFiles(t, tt.workdir)
+			if err := a.Apply(&transform.Context{WorkDir: workDir}); err != nil {
+				t.Fatalf("Apply() error: %v", err)
+			}
+			got := readTree(t, workDir)
+			if !equalTrees(got, tt.want) {
+				t.Errorf("after Apply() = %q, want %q", got, tt.want)
+			}
+
+			if err := a.Reverse().Apply(&transform.Context{WorkDir: workDir}); err != nil {
+				t.Fatalf("Reverse().Apply() error: %v", err)
+			}
+			if got := readTree(t, workDir); !equalTrees(got, tt.workdir) {
+				t.Errorf("after Reverse().Apply() = %q, want %q", got, tt.workdir)
+			}
+		})
+	}
+}
+
+func equalTrees(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, content := range a {
+		if other, ok := b[name]; !ok || other != content {
+			return false
+		}
+	}
+	return true
+}
+
+func TestApplyHunkError(t *testing.T) {
+	configDir := writeFiles(t, map[string]string{"fix.patch": `--- a/a.txt
++++ b/a.txt
+@@ -1 +1 @@
+-a
++b
+` + mainPatch})
+	a, err := evalApply(t, configDir, `patch.apply(patches = ["fix.patch"])`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	workdir := map[string]string{
+		"a.txt":   "a\n",
+		"main.go": strings.Replace(mainGo, "println(x)", "println(y)", 1),
+	}
+	workDir := writeFiles(t, workdir)
+	err = a.Apply(&transform.Context{WorkDir: workDir})
+
+	var herr *patch.HunkError
+	if !errors.As(err, &herr) {
+		t.Fatalf("expected HunkError, got %v", err)
+	}
+	if herr.Patch != "fix.patch" || herr.Path != "main.go" || herr.Index != 2 {
+		t.Errorf("unexpected hunk error: %+v", herr)
+	}
+	want := `fix.patch: hunk #2 (@@ -5,3 +5,4 @@) does not apply to main.go: line 6 is "\tprintln(y)", expected "\tprintln(x)"`
+	if err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+	if got := readTree(t, workDir); !equalTrees(got, workdir) {
+		t.Errorf("a failed patch should not change the workdir, got %q", got)
+	}
+}
+
+func TestApplyNoop(t *testing.T) {
+	configDir := writeFiles(t, map[string]string{"fix.patch": mainPatch})
+	a, err := evalApply(t, configDir, `patch.apply(patches = ["fix.patch"], excluded_patch_paths = ["*.go"])`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = a.Apply(&transform.Context{WorkDir: writeFiles(t, map[string]string{"main.go": mainGo})})
+	if !errors.Is(err, transform.ErrNoop) {
+		t.Errorf("expected a no-op error, got %v", err)
+	}
+}
+
+func TestApplyFileErrors(t *testing.T) {
+	configDir := writeFiles(t, map[string]string{
+		"fix.patch": mainPatch,
+		"create.patch": `--- /dev/null
++++ b/main.go
+@@ -0,0 +1 @@
++package main
+`,
+	})
+
+	tests := []struct {
+		name    string
+		expr    string
+		workdir map[string]string
+		wantErr string
+	}{
+		{
+			name:    "missing file",
+			expr:    `patch.apply(patches = ["fix.patch"])`,
+			workdir: map[string]string{},
+			wantErr: "fix.patch: cannot patch main.go: file does not exist",
+		},
+		{
+			name:    "existing file",
+			expr:    `patch.apply(patches = ["create.patch"])`,
+			workdir: map[string]string{"main.go": mainGo},
+			wantErr: "create.patch: cannot create main.go: file already exists",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := evalApply(t, configDir, tt.expr)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err = a.Apply(&transform.Context{WorkDir: writeFiles(t, tt.workdir)})
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyFnErrors(t *testing.T) {
+	configDir := writeFiles(t, map[string]string{
+		"fix.patch":    mainPatch,
+		"escape.patch": "--- a/../x\n+++ b/../x\n@@ -1 +1 @@\n-a\n+b\n",
+		"series":       "fix.patch -R\n",
+		"empty.patch":  "just a message\n",
+	})
+
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr string
+	}{
+		{"nothing to apply", `patch.apply()`, "patches or series is required"},
+		{"missing patch", `patch.apply(patches = ["missing.patch"])`, "failed to read patch"},
+		{"missing series", `patch.apply(series = "missing")`, "failed to read series"},
+		{"empty patch", `patch.apply(patches = ["empty.patch"])`, "empty.patch: no file diff found"},
+		{"strip too large", `patch.apply(patches = ["fix.patch"], strip = 2)`, `cannot strip 2 components from "a/main.go"`},
+		{"negative strip", `patch.apply(patches = ["fix.patch"], strip = -1)`, "strip cannot be negative"},
+		{"escaping path", `patch.apply(patches = ["escape.patch"])`, `path "../x" escapes the workdir`},
+		{"bad pattern", `patch.apply(patches = ["fix.patch"], excluded_patch_paths = ["["])`, "invalid excluded path"},
+		{"bad series option", `patch.apply(series = "series")`, `series:1: unsupported option "-R"`},
+		{"non-string patch", `patch.apply(patches = [1])`, "patches must contain strings"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := evalApply(t, configDir, tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestApplyAccessors(t *testing.T) {
+	configDir := writeFiles(t, map[string]string{
+		"fix.patch":         mainPatch,
+		"patches/series":    "one.patch\n",
+		"patches/one.patch": mainPatch,
+	})
+	a, err := evalApply(t, configDir, `patch.apply(patches = ["fix.patch"], series = "patches/series", excluded_patch_paths = ["docs/*"], strip = 1)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := a.Patches(); len(got) != 2 || got[0] != "fix.patch" || got[1] != "patches/one.patch" {
+		t.Errorf("Patches() = %q", got)
+	}
+	if got := a.ExcludedPaths(); len(got) != 1 || got[0] != "docs/*" {
+		t.Errorf("ExcludedPaths() = %q", got)
+	}
+	if a.Series() != "patches/series" || a.Strip() != 1 {
+		t.Errorf("Series() = %q, Strip() = %d", a.Series(), a.Strip())
+	}
+	if got := a.Describe(); got != "Applying patches fix.patch, patches/one.patch" {
+		t.Errorf("Describe() = %q", got)
+	}
+	if got := a.Reverse().Describe(); got != "Reverting patches fix.patch, patches/one.patch" {
+		t.Errorf("Reverse().Describe() = %q", got)
+	}
+	if got := a.String(); got != `patch.apply(patches = ["fix.patch", "patches/one.patch"])` {
+		t.Errorf("String() = %q", got)
+	}
+}
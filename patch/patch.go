@@ -0,0 +1,385 @@
+package patch
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/albertocavalcante/starlark-go-copybara/diff"
+)
+
+// devNull is the file name used for the missing side of a created or
+// deleted file.
+const devNull = "/dev/null"
+
+// noNewline marks a line without a trailing newline.
+const noNewline = `\ No newline at end of file`
+
+// hunkHeader matches a hunk header, e.g. "@@ -1,3 +1,4 @@".
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// File is the diff of a single file in a unified diff.
+type File struct {
+	// OldName is the path before the change, or "/dev/null" for created files.
+	OldName string
+
+	// NewName is the path after the change, or "/dev/null" for deleted files.
+	NewName string
+
+	// Hunks are the changed regions of the file, in file order.
+	Hunks []*Hunk
+}
+
+// Hunk is a changed region of a file.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+
+	// Lines are the hunk lines. Each line starts with ' ', '-' or '+' and
+	// keeps its trailing newline, if any.
+	Lines []string
+}
+
+// Header returns the hunk header, e.g. "@@ -1,3 +1,4 @@".
+func (h *Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+// old returns the lines the hunk expects to find.
+func (h *Hunk) old() []string {
+	return h.side('+')
+}
+
+// new returns the lines the hunk replaces the old lines with.
+func (h *Hunk) new() []string {
+	return h.side('-')
+}
+
+// side returns the hunk lines, without prefix, skipping lines of the given kind.
+func (h *Hunk) side(skip byte) []string {
+	var lines []string
+	for _, l := range h.Lines {
+		if l[0] != skip {
+			lines = append(lines, l[1:])
+		}
+	}
+	return lines
+}
+
+// reverse returns a hunk undoing h.
+func (h *Hunk) reverse() *Hunk {
+	r := &Hunk{
+		OldStart: h.NewStart,
+		OldLines: h.NewLines,
+		NewStart: h.OldStart,
+		NewLines: h.OldLines,
+		Lines:    make([]string, len(h.Lines)),
+	}
+	for i, l := range h.Lines {
+		switch l[0] {
+		case '-':
+			l = "+" + l[1:]
+		case '+':
+			l = "-" + l[1:]
+		}
+		r.Lines[i] = l
+	}
+	return r
+}
+
+// Created reports whether the diff creates the file.
+func (f *File) Created() bool {
+	return f.OldName == devNull
+}
+
+// Deleted reports whether the diff deletes the file.
+func (f *File) Deleted() bool {
+	return f.NewName == devNull
+}
+
+// Path returns the path of the patched file.
+func (f *File) Path() string {
+	if f.Deleted() {
+		return f.OldName
+	}
+	return f.NewName
+}
+
+// reverse returns a file diff undoing f.
+func (f *File) reverse() *File {
+	r := &File{OldName: f.NewName, NewName: f.OldName}
+	for _, h := range f.Hunks {
+		r.Hunks = append(r.Hunks, h.reverse())
+	}
+	return r
+}
+
+// strip removes the first n path components from the file names.
+func (f *File) strip(n int) error {
+	for _, name := range []*string{&f.OldName, &f.NewName} {
+		if *name == devNull {
+			continue
+		}
+		parts := strings.Split(*name, "/")
+		if len(parts) <= n {
+			return fmt.Errorf("cannot strip %d components from %q", n, *name)
+		}
+		*name = path.Clean(strings.Join(parts[n:], "/"))
+	}
+	return nil
+}
+
+// Parse parses a unified diff, as produced by diff -u or git diff.
+//
+// Lines outside file diffs, such as commit messages and git extended
+// headers, are ignored. name is only used in error messages.
+func Parse(name, data string) ([]*File, error) {
+	lines := diff.SplitLines(data)
+
+	var (
+		files []*File
+		file  *File
+	)
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			file = &File{
+				OldName: fileName(line[4:]),
+				NewName: fileName(lines[i+1][4:]),
+			}
+			files = append(files, file)
+			i++
+		case strings.HasPrefix(line, "@@ "):
+			if file == nil {
+				return nil, fmt.Errorf("%s:%d: hunk outside of a file diff", name, i+1)
+			}
+			hunk, next, err := parseHunk(name, lines, i)
+			if err != nil {
+				return nil, err
+			}
+			file.Hunks = append(file.Hunks, hunk)
+			i = next - 1
+		default:
+			// A file diff ends at the first line that is not a hunk
+			file = nil
+		}
+	}
+
+	for _, f := range files {
+		if len(f.Hunks) == 0 {
+			return nil, fmt.Errorf("%s: diff of %s has no hunks", name, f.Path())
+		}
+	}
+	return files, nil
+}
+
+// parseHunk parses the hunk starting at lines[start]. It returns the hunk
+// and the index of the first line after it.
+func parseHunk(name string, lines []string, start int) (*Hunk, int, error) {
+	m := hunkHeader.FindStringSubmatch(strings.TrimRight(lines[start], "\n"))
+	if m == nil {
+		return nil, 0, fmt.Errorf("%s:%d: malformed hunk header %q", name, start+1, strings.TrimRight(lines[start], "\n"))
+	}
+	h := &Hunk{
+		OldStart: atoi(m[1], 0),
+		OldLines: atoi(m[2], 1),
+		NewStart: atoi(m[3], 0),
+		NewLines: atoi(m[4], 1),
+	}
+
+	oldLeft, newLeft := h.OldLines, h.NewLines
+	i := start + 1
+	for ; i < len(lines) && (oldLeft > 0 || newLeft > 0); i++ {
+		line := lines[i]
+		switch line[0] {
+		case ' ':
+			oldLeft--
+			newLeft--
+		case '\n':
+			// Some tools strip the trailing space of empty context lines
+			line = " " + line
+			oldLeft--
+			newLeft--
+		case '-':
+			oldLeft--
+		case '+':
+			newLeft--
+		case '\\':
+			if err := trimNewline(h); err != nil {
+				return nil, 0, fmt.Errorf("%s:%d: %w", name, i+1, err)
+			}
+			continue
+		default:
+			return nil, 0, fmt.Errorf("%s:%d: unexpected line %q in hunk %s", name, i+1, strings.TrimRight(line, "\n"), h.Header())
+		}
+		if oldLeft < 0 || newLeft < 0 {
+			return nil, 0, fmt.Errorf("%s:%d: hunk %s has more lines than its header declares", name, i+1, h.Header())
+		}
+		h.Lines = append(h.Lines, line)
+	}
+	if oldLeft > 0 || newLeft > 0 {
+		return nil, 0, fmt.Errorf("%s: hunk %s is truncated", name, h.Header())
+	}
+
+	// The last line of the hunk may lack a trailing newline
+	if i < len(lines) && strings.HasPrefix(lines[i], noNewline) {
+		if err := trimNewline(h); err != nil {
+			return nil, 0, fmt.Errorf("%s:%d: %w", name, i+1, err)
+		}
+		i++
+	}
+	return h, i, nil
+}
+
+// trimNewline removes the trailing newline of the last hunk line.
+func trimNewline(h *Hunk) error {
+	if len(h.Lines) == 0 {
+		return fmt.Errorf("%q before any hunk line", noNewline)
+	}
+	last := len(h.Lines) - 1
+	h.Lines[last] = strings.TrimSuffix(h.Lines[last], "\n")
+	return nil
+}
+
+// fileName extracts the file name from a "---" or "+++" header value,
+// dropping the timestamp diff -u appends after a tab.
+func fileName(s string) string {
+	s = strings.TrimRight(s, "\n")
+	if before, _, ok := strings.Cut(s, "\t"); ok {
+		s = before
+	}
+	s = strings.TrimSpace(s)
+	if unquoted, err := strconv.Unquote(s); err == nil && strings.HasPrefix(s, `"`) {
+		s = unquoted
+	}
+	return s
+}
+
+// atoi parses a hunk header number, returning def for an empty string.
+func atoi(s string, def int) int {
+	if s == "" {
+		return def
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// HunkError reports a hunk that could not be applied.
+type HunkError struct {
+	// Patch is the name of the patch file.
+	Patch string
+
+	// Path is the patched file.
+	Path string
+
+	// Index is the 1-based index of the hunk in the file diff.
+	Index int
+
+	// Hunk is the hunk that did not apply.
+	Hunk *Hunk
+
+	// Reason describes the mismatch.
+	Reason string
+}
+
+// Error implements error.
+func (e *HunkError) Error() string {
+	return fmt.Sprintf("%s: hunk #%d (%s) does not apply to %s: %s", e.Patch, e.Index, e.Hunk.Header(), e.Path, e.Reason)
+}
+
+// apply applies the hunks of f to content. patchName is only used in
+// error messages.
+//
+// Each hunk is looked up at the position its header declares, adjusted by
+// the offset of previous hunks. If the lines do not match there, the
+// nearest position where they do is used instead. Hunks never overlap.
+func (f *File) apply(patchName, content string) (string, error) {
+	lines := diff.SplitLines(content)
+
+	var (
+		sb     strings.Builder
+		pos    int
+		offset int
+	)
+	for i, h := range f.Hunks {
+		old := h.old()
+		start := h.OldStart - 1
+		if h.OldLines == 0 {
+			// An insertion goes after line OldStart
+			start = h.OldStart
+		}
+
+		at := find(lines, old, pos, start+offset)
+		if at < 0 {
+			return "", &HunkError{
+				Patch:  patchName,
+				Path:   f.Path(),
+				Index:  i + 1,
+				Hunk:   h,
+				Reason: mismatch(lines, old, max(pos, start+offset)),
+			}
+		}
+
+		for _, l := range lines[pos:at] {
+			sb.WriteString(l)
+		}
+		for _, l := range h.new() {
+			sb.WriteString(l)
+		}
+		pos = at + len(old)
+		offset = at - start
+	}
+	for _, l := range lines[pos:] {
+		sb.WriteString(l)
+	}
+	return sb.String(), nil
+}
+
+// find returns the index of the occurrence of want in lines, at or after
+// from, that is nearest to expected. It returns -1 if there is none.
+func find(lines, want []string, from, expected int) int {
+	last := len(lines) - len(want)
+	if last < from {
+		return -1
+	}
+	expected = min(max(expected, from), last)
+	for d := 0; expected-d >= from || expected+d <= last; d++ {
+		if at := expected + d; at <= last && matches(lines[at:], want) {
+			return at
+		}
+		if at := expected - d; d > 0 && at >= from && matches(lines[at:], want) {
+			return at
+		}
+	}
+	return -1
+}
+
+// matches reports whether lines starts with want.
+func matches(lines, want []string) bool {
+	for i, w := range want {
+		if lines[i] != w {
+			return false
+		}
+	}
+	return true
+}
+
+// mismatch describes why want does not match lines at index at.
+func mismatch(lines, want []string, at int) string {
+	for i, w := range want {
+		n := at + i
+		if n >= len(lines) {
+			return fmt.Sprintf("file has %d lines, expected %q at line %d", len(lines), strings.TrimSuffix(w, "\n"), n+1)
+		}
+		if lines[n] != w {
+			if strings.TrimSuffix(lines[n], "\n") == strings.TrimSuffix(w, "\n") {
+				return fmt.Sprintf("line %d differs in its trailing newline", n+1)
+			}
+			return fmt.Sprintf("line %d is %q, expected %q", n+1, strings.TrimSuffix(lines[n], "\n"), strings.TrimSuffix(w, "\n"))
+		}
+	}
+	return "lines do not match"
+}
@@ -0,0 +1,109 @@
+package patch_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/albertocavalcante/starlark-go-copybara/patch"
+)
+
+func TestParse(t *testing.T) {
+	data := `commit message
+
+diff --git a/src/main.go b/src/main.go
+index 1234567..89abcde 100644
+--- a/src/main.go	2024-01-01 00:00:00.000000000 +0000
++++ b/src/main.go	2024-01-02 00:00:00.000000000 +0000
+@@ -1,3 +1,3 @@
+ package main
+-var x = 1
++var x = 2
+
+@@ -10 +10,2 @@ func main() {
+ end
++more
+\ No newline at end of file
+diff --git a/NEW b/NEW
+new file mode 100644
+--- /dev/null
++++ b/NEW
+@@ -0,0 +1 @@
++new
+`
+
+	files, err := patch.Parse("test.patch", data)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+
+	main := files[0]
+	if main.OldName != "a/src/main.go" || main.NewName != "b/src/main.go" {
+		t.Errorf("names = %q, %q", main.OldName, main.NewName)
+	}
+	if len(main.Hunks) != 2 {
+		t.Fatalf("got %d hunks, want 2", len(main.Hunks))
+	}
+	wantLines := []string{" package main\n", "-var x = 1\n", "+var x = 2\n", " \n"}
+	if !slices.Equal(main.Hunks[0].Lines, wantLines) {
+		t.Errorf("hunk 1 lines = %q, want %q", main.Hunks[0].Lines, wantLines)
+	}
+	h := main.Hunks[1]
+	if h.OldStart != 10 || h.OldLines != 1 || h.NewStart != 10 || h.NewLines != 2 {
+		t.Errorf("hunk 2 header = %s", h.Header())
+	}
+	if last := h.Lines[len(h.Lines)-1]; last != "+more" {
+		t.Errorf("last line = %q, want %q", last, "+more")
+	}
+
+	created := files[1]
+	if !created.Created() || created.Deleted() || created.Path() != "b/NEW" {
+		t.Errorf("unexpected created file: %+v", created)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name:    "hunk outside file",
+			data:    "@@ -1 +1 @@\n-a\n+b\n",
+			wantErr: "test.patch:1: hunk outside of a file diff",
+		},
+		{
+			name:    "malformed header",
+			data:    "--- a/f\n+++ b/f\n@@ -x +1 @@\n",
+			wantErr: "test.patch:3: malformed hunk header",
+		},
+		{
+			name:    "truncated hunk",
+			data:    "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n",
+			wantErr: "hunk @@ -1,2 +1,2 @@ is truncated",
+		},
+		{
+			name:    "unexpected line",
+			data:    "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n?b\n",
+			wantErr: "test.patch:5: unexpected line",
+		},
+		{
+			name:    "no hunks",
+			data:    "--- a/f\n+++ b/f\n",
+			wantErr: "diff of b/f has no hunks",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := patch.Parse("test.patch", tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
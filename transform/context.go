@@ -4,9 +4,11 @@
 package transform
 
 import (
+	"io"
 	"io/fs"
 	"regexp"
 	"strings"
+	"time"
 )
 
 // Change represents a single change in a migration.
@@ -23,6 +25,9 @@ type Change struct {
 	// MappedAuthor is the mapped author (after transformations).
 	MappedAuthor string
 
+	// Date is the time the change was authored.
+	Date time.Time
+
 	// IsMerge indicates if this is a merge commit.
 	IsMerge bool
 
@@ -31,6 +36,10 @@ type Change struct {
 
 	// Files is the list of changed files (optional).
 	Files []string
+
+	// Submodules maps the path of each submodule in the change tree to
+	// its commit (optional).
+	Submodules map[string]string
 }
 
 // FirstLineMessage returns the first line of the commit message.
@@ -69,6 +78,17 @@ type Context struct {
 
 	// Labels contains message labels extracted from the commit message.
 	Labels map[string][]string
+
+	// Console receives the messages printed by transformations. A nil
+	// Console discards them.
+	Console io.Writer
+
+	// IgnoreNoop makes groups of transformations ignore the no-op ones,
+	// whatever their configured behavior (--ignore-noop).
+	IgnoreNoop bool
+
+	// Noops describes the no-op transformations that were ignored.
+	Noops []string
 }
 
 // NewContext creates a new transformation context.
@@ -83,6 +103,16 @@ func NewContext(workDir string) *Context {
 // labelPattern matches labels in the format "Label-Name: value" or "Label-Name=value".
 var labelPattern = regexp.MustCompile(`(?m)^([A-Za-z][A-Za-z0-9_-]*)[:=]\s*(.+)$`)
 
+// ParseLabels returns the labels found in a message, keyed by label name,
+// in order of appearance.
+func ParseLabels(message string) map[string][]string {
+	labels := make(map[string][]string)
+	for _, match := range labelPattern.FindAllStringSubmatch(message, -1) {
+		labels[match[1]] = append(labels[match[1]], strings.TrimSpace(match[2]))
+	}
+	return labels
+}
+
 // GetLabel returns the first value of a label from the message.
 func (ctx *Context) GetLabel(name string) string {
 	// First check pre-populated labels
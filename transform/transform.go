@@ -3,6 +3,31 @@
 // Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/Transformation.java
 package transform
 
+import "errors"
+
+// ErrNoop is matched by errors reporting that a transformation did not
+// change anything.
+var ErrNoop = errors.New("transformation was a no-op")
+
+// NoopError reports that a transformation did not change anything.
+type NoopError struct {
+	// Reason explains why the transformation was a no-op.
+	Reason string
+}
+
+// Error implements error.
+func (e *NoopError) Error() string {
+	if e.Reason == "" {
+		return ErrNoop.Error()
+	}
+	return ErrNoop.Error() + ": " + e.Reason
+}
+
+// Is reports whether target is ErrNoop.
+func (e *NoopError) Is(target error) bool {
+	return target == ErrNoop
+}
+
 // Transformation is the interface for all transformations.
 // This is the shared interface used by both core and metadata transformations.
 type Transformation interface {
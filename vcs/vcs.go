@@ -27,12 +27,126 @@ type Origin interface {
 
 	// Changes returns changes since the given baseline reference.
 	Changes(baseline string) ([]*Change, error)
+
+	// CopyTo materializes the checked out tree into the given directory.
+	CopyTo(dir string) error
 }
 
 // Destination is a target repository for migrations.
 type Destination interface {
 	Repository
 
-	// Write writes changes to the destination.
-	Write(changes []*Change) error
+	// Write writes the transformed tree to the destination.
+	Write(result *TransformResult) (*WriteResult, error)
+}
+
+// ChangeRequestWriter is implemented by destinations that accept changes
+// based on an older destination revision, as done in CHANGE_REQUEST mode.
+type ChangeRequestWriter interface {
+	Destination
+
+	// WriteChangeRequest writes the transformed tree as a change on top of
+	// the destination revision baseline instead of the destination head.
+	WriteChangeRequest(baseline string, result *TransformResult) (*WriteResult, error)
+}
+
+// LastRevFinder is implemented by destinations that record the migrated
+// origin revision in their history.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/Destination.java
+type LastRevFinder interface {
+	// LastRev returns the value of the most recent occurrence of the given
+	// label in the destination history, or "" if no commit carries it.
+	LastRev(label string) (string, error)
+}
+
+// LabelFinder is implemented by destinations that can look up the change
+// that imported a given origin revision.
+type LabelFinder interface {
+	// FindByLabel returns the destination revision whose message has the
+	// label with the given value, or "" if no commit carries it.
+	FindByLabel(label, value string) (string, error)
+}
+
+// Matcher reports whether a relative path belongs to a set of files.
+// It is satisfied by core.Glob.
+type Matcher interface {
+	Matches(path string) bool
+}
+
+// TransformResult is the outcome of applying a workflow's transformations,
+// ready to be written to a destination.
+//
+// Reference: https://github.com/google/copybara/blob/master/java/com/google/copybara/TransformResult.java
+type TransformResult struct {
+	// WorkDir is the directory holding the transformed tree.
+	WorkDir string
+
+	// DestinationFiles selects the destination paths owned by the migration.
+	// Destination files outside of it are left untouched. A nil matcher
+	// selects every file.
+	DestinationFiles Matcher
+
+	// OriginRef is the origin reference being migrated.
+	OriginRef string
+
+	// RevIDLabel is the name of the label that records OriginRef in the
+	// destination. Destinations use their default label when empty.
+	RevIDLabel string
+
+	// Message is the final commit message.
+	Message string
+
+	// Author is the resolved author in "Name <email>" format.
+	Author string
+
+	// Changes are the origin changes included in this write.
+	Changes []*Change
+
+	// DryRun computes the result without modifying the destination.
+	DryRun bool
+
+	// Workflow is the name of the workflow being run.
+	Workflow string
+
+	// ContextRef is the origin reference the migration was requested for,
+	// such as a pull request number or a branch name. Together with
+	// Workflow it identifies the change request across runs.
+	ContextRef string
+}
+
+// FileOp describes how a file changed in the destination.
+type FileOp string
+
+const (
+	// FileAdded means the file did not exist in the destination.
+	FileAdded FileOp = "ADDED"
+	// FileModified means the file content or mode changed.
+	FileModified FileOp = "MODIFIED"
+	// FileDeleted means the file was removed from the destination.
+	FileDeleted FileOp = "DELETED"
+)
+
+// FileChange is a single file touched by a destination write.
+type FileChange struct {
+	Path string
+	Op   FileOp
+}
+
+// WriteResult describes what a destination write did.
+type WriteResult struct {
+	// DestinationRef is the reference created in the destination, if any.
+	DestinationRef string
+
+	// ChangeRequest identifies the change request created or updated by
+	// the write, if any (e.g. a pull request URL).
+	ChangeRequest string
+
+	// Files lists the files changed, sorted by path.
+	Files []FileChange
+}
+
+// Empty returns true if the write did not change any file.
+func (w *WriteResult) Empty() bool {
+	return len(w.Files) == 0
 }